@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// subjectFor builds the policy subject for a stored user
+
+func subjectFor(dbUser database.User) auth.Subject {
+	return auth.Subject{
+		ID:       dbUser.ID,
+		Role:     userRole(dbUser),
+		Premium:  dbUser.Premium,
+		Verified: !dbUser.Unverified,
+	}
+}
+
+/* authorize asks the policy whether the user may perform action on resource
+the user is re-read from the database so role, premium and verification changes apply immediately */
+
+func (cfg *apiConfig) authorize(userID int, action auth.Action, resource auth.Resource) (auth.Grant, error) {
+	dbUser, err := cfg.DB.GetSingleUser(userID)
+	if err != nil {
+		return auth.Grant{}, err
+	}
+	return cfg.Policy.Can(subjectFor(dbUser), action, resource)
+}
+
+// respondWithAuthorizeError answers a failed authorize call, 403 for denials, 404 for users who no longer exist and 500 otherwise
+
+func respondWithAuthorizeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrForbidden) {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, err.Error())
+}
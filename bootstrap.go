@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+/* createAdmin implements `chirpy create-admin -email EMAIL`, which makes the first admin
+an existing account is promoted, otherwise a verified account is created with the password
+from CHIRPY_ADMIN_PASSWORD so it never appears in shell history or process listings */
+
+func createAdmin(store *database.DB, policy auth.PasswordPolicy, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the admin account")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("create-admin: -email is required")
+	}
+
+	dbUser, err := store.GetUserByEmail(*email)
+	if errors.Is(err, database.ErrNotExist) {
+		dbUser, err = createAdminAccount(store, policy, *email)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = store.SetRole(dbUser.ID, string(auth.RoleAdmin))
+	if err != nil {
+		return err
+	}
+	log.Printf("BOOTSTRAP: User %v (%v) is now an admin", dbUser.ID, dbUser.Email)
+	return nil
+}
+
+func createAdminAccount(store *database.DB, policy auth.PasswordPolicy, email string) (database.User, error) {
+	email, err := validateEmail(email)
+	if err != nil {
+		return database.User{}, err
+	}
+	password := os.Getenv("CHIRPY_ADMIN_PASSWORD")
+	if password == "" {
+		return database.User{}, fmt.Errorf("create-admin: no account uses %v, set CHIRPY_ADMIN_PASSWORD to create one", email)
+	}
+	err = policy.Check(password, email)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hash, err := auth.EncryptPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	key, err := newActorKey()
+	if err != nil {
+		return database.User{}, err
+	}
+	dbUser, err := store.CreateUser(email, hash, false, key)
+	if err != nil {
+		return database.User{}, err
+	}
+	return store.SetVerified(dbUser.ID)
+}
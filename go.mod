@@ -4,6 +4,8 @@ go 1.22.1
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/crypto v0.22.0
+	golang.org/x/text v0.14.0
 )
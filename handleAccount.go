@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+/* handlerDeleteUser permanently deletes the caller's account and everything that belongs to it
+the password, and a second factor when enabled, must be given again so a stolen access token alone can't delete an account */
+
+func (cfg *apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	// 1: validate token and decode the re-authentication parameters
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	_, err = cfg.Policy.Can(subjectFor(dbUser), auth.ActionDeleteUser, auth.Resource{Owner: dbUser.ID})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	// 2: re-authenticate, with failures counting towards the login lockout so this can't be used to guess passwords
+
+	now := time.Now()
+	accountKey := "account:" + strings.ToLower(dbUser.Email)
+	attempt, wait := cfg.AccountThrottle.Begin(accountKey, now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many failed login attempts, try again later")
+		return
+	}
+	defer attempt.Release()
+	err = auth.CheckPasswords(params.Password, dbUser.Password)
+	if err == nil && dbUser.TOTPSecret != "" {
+		err = cfg.checkSecondFactor(dbUser, params.Code, params.RecoveryCode)
+	}
+	if err != nil {
+		attempt.Fail(now)
+		respondWithError(w, http.StatusUnauthorized, "password or two-factor code is incorrect")
+		return
+	}
+
+	// 3: the last admin can't leave, or nobody could manage roles afterwards
+
+	if userRole(dbUser) == auth.RoleAdmin {
+		users, err := cfg.DB.GetUsers()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		admins := 0
+		for _, u := range users {
+			if userRole(u) == auth.RoleAdmin {
+				admins++
+			}
+		}
+		if admins <= 1 {
+			respondWithError(w, http.StatusConflict, "promote another admin before deleting the last admin account")
+			return
+		}
+	}
+
+	// 4: delete everything in one write, then the files kept outside the database
+
+	deleted, err := cfg.DB.DeleteUser(subject)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted.Avatar != "" {
+		os.Remove(filepath.Join(cfg.AvatarDir, deleted.Avatar))
+	}
+	attempt.Succeed()
+
+	log.Printf("API: Deleted account of user %v", subject)
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+type exportFollow struct {
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportBookmark struct {
+	ChirpID   int       `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportVote struct {
+	ChirpID int `json:"chirp_id"`
+	Option  int `json:"option"`
+}
+
+type exportRemoteFollower struct {
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// accountExport is the archive returned by handlerExportUser, credentials and secrets are never included
+
+type accountExport struct {
+	ExportedAt       time.Time              `json:"exported_at"`
+	User             User                   `json:"user"`
+	TwoFactorEnabled bool                   `json:"two_factor_enabled"`
+	Chirps           []Chirp                `json:"chirps"`
+	Following        []exportFollow         `json:"following"`
+	Followers        []exportFollow         `json:"followers"`
+	Bookmarks        []exportBookmark       `json:"bookmarks"`
+	PollVotes        []exportVote           `json:"poll_votes"`
+	Reports          []database.Report      `json:"reports"`
+	Decisions        []database.Decision    `json:"moderation_decisions"`
+	RemoteFollowers  []exportRemoteFollower `json:"remote_followers"`
+	Blocks           []HiddenUser           `json:"blocks"`
+	Mutes            []HiddenUser           `json:"mutes"`
+}
+
+// handlerExportUser sends the caller a JSON archive of all the data stored about them as a file download
+
+func (cfg *apiConfig) handlerExportUser(w http.ResponseWriter, r *http.Request) {
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+	_, err = cfg.authorize(subject, auth.ActionExportUser, auth.Resource{Owner: subject})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	data, err := cfg.DB.ExportUser(subject)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export := accountExport{
+		ExportedAt:       time.Now().UTC(),
+		User:             cfg.presentUser(data.User, subject),
+		TwoFactorEnabled: data.User.TOTPSecret != "",
+		Chirps:           []Chirp{},
+		Following:        []exportFollow{},
+		Followers:        []exportFollow{},
+		Bookmarks:        []exportBookmark{},
+		PollVotes:        []exportVote{},
+		Reports:          data.Reports,
+		Decisions:        data.Decisions,
+		RemoteFollowers:  []exportRemoteFollower{},
+		Blocks:           []HiddenUser{},
+		Mutes:            []HiddenUser{},
+	}
+	for _, chirp := range data.Chirps {
+		export.Chirps = append(export.Chirps, newChirp(chirp, subject))
+	}
+	for _, f := range data.Following {
+		export.Following = append(export.Following, exportFollow{UserID: f.Followee, CreatedAt: f.CreatedAt})
+	}
+	for _, f := range data.Followers {
+		export.Followers = append(export.Followers, exportFollow{UserID: f.Follower, CreatedAt: f.CreatedAt})
+	}
+	for _, b := range data.Bookmarks {
+		export.Bookmarks = append(export.Bookmarks, exportBookmark{ChirpID: b.ChirpID, CreatedAt: b.CreatedAt})
+	}
+	for chirpID, option := range data.Votes {
+		export.PollVotes = append(export.PollVotes, exportVote{ChirpID: chirpID, Option: option})
+	}
+	for _, f := range data.RemoteFollowers {
+		export.RemoteFollowers = append(export.RemoteFollowers, exportRemoteFollower{Actor: f.Actor, CreatedAt: f.CreatedAt})
+	}
+	for _, b := range data.Blocks {
+		export.Blocks = append(export.Blocks, HiddenUser{UserID: b.Blocked, CreatedAt: b.CreatedAt})
+	}
+	for _, m := range data.Mutes {
+		export.Mutes = append(export.Mutes, HiddenUser{UserID: m.Muted, CreatedAt: m.CreatedAt})
+	}
+	sort.Slice(export.PollVotes, func(i, j int) bool {
+		return export.PollVotes[i].ChirpID < export.PollVotes[j].ChirpID
+	})
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"chirpy-export-%v.json\"", subject))
+	respondWithJSON(w, http.StatusOK, export)
+}
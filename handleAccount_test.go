@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// impersonationBearer returns an Authorization header value with an access token for the user issued to admin
+
+func impersonationBearer(t *testing.T, cfg *apiConfig, dbUser database.User, admin database.User) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims{
+		Role:         string(userRole(dbUser)),
+		Impersonator: admin.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy-access",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:   strconv.Itoa(dbUser.ID),
+		},
+	}).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+// newPasswordUser creates a verified user whose password is password
+
+func newPasswordUser(t *testing.T, cfg *apiConfig, email string, password string, role auth.Role) database.User {
+	t.Helper()
+	hash, err := auth.EncryptPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbUser := newTestUser(t, cfg, email, role)
+	dbUser, err = cfg.DB.UpdateUser(dbUser.ID, dbUser.Email, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbUser
+}
+
+func TestDeleteUserEndpoint(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.AvatarDir = t.TempDir()
+	cfg.AccountThrottle = auth.NewThrottle(auth.ThrottleConfig{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 1000, LockoutFor: time.Hour, ForgetAfter: time.Hour})
+	const password = "Correct-Horse-9"
+	user := newPasswordUser(t, cfg, "user@example.com", password, "")
+	admin := newPasswordUser(t, cfg, "admin@example.com", password, auth.RoleAdmin)
+
+	_, err := cfg.DB.CreateChirp(database.Chirp{Author: user.ID, Body: "mine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateToken("refresh", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(cfg.AvatarDir, "avatar.png"), []byte("png"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = cfg.DB.SetAvatar(user.ID, "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(cfg.handlerDeleteUser)
+	token := bearer(t, cfg, user)
+	body := `{"password": "` + password + `"}`
+
+	// the cases run in order, so the account is gone after the successful delete
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		want          int
+	}{
+		{name: "no token", body: body, want: http.StatusUnauthorized},
+		{name: "impersonating", authorization: impersonationBearer(t, cfg, user, admin), body: body, want: http.StatusForbidden},
+		{name: "malformed", authorization: token, body: `{`, want: http.StatusBadRequest},
+		{name: "no password", authorization: token, body: `{}`, want: http.StatusUnauthorized},
+		{name: "wrong password", authorization: token, body: `{"password": "wrong"}`, want: http.StatusUnauthorized},
+		{name: "last admin", authorization: bearer(t, cfg, admin), body: body, want: http.StatusConflict},
+		{name: "delete", authorization: token, body: body, want: http.StatusOK},
+		{name: "token of the deleted account", authorization: token, body: body, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := serve(handler, http.MethodDelete, "/api/users", tt.authorization, tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	if _, err := cfg.DB.GetSingleUser(user.ID); !errors.Is(err, database.ErrNotExist) {
+		t.Errorf("GetSingleUser() after deleting error = %v, want ErrNotExist", err)
+	}
+	if _, err := cfg.DB.GetToken("refresh"); err == nil {
+		t.Error("refresh token survived the delete")
+	}
+	chirps, err := cfg.DB.GetChirps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 0 {
+		t.Errorf("chirps = %+v, want none", chirps)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.AvatarDir, "avatar.png")); !os.IsNotExist(err) {
+		t.Errorf("avatar stat error = %v, want it removed", err)
+	}
+}
+
+func TestExportUserEndpoint(t *testing.T) {
+	cfg := newTestConfig(t)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	other := newTestUser(t, cfg, "other@example.com", auth.RoleAdmin)
+
+	chirp, err := cfg.DB.CreateChirp(database.Chirp{Author: user.ID, Body: "mine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll, err := cfg.DB.CreateChirp(database.Chirp{Author: other.ID, Body: "vote", Poll: &database.Poll{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.Vote(poll.ID, user.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateFollow(other.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateBookmark(user.ID, poll.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateMute(user.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateToken("refresh-secret", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(cfg.handlerExportUser)
+	for _, authorization := range []string{"", impersonationBearer(t, cfg, user, other)} {
+		if rec := serve(handler, http.MethodGet, "/api/me/export", authorization, ""); rec.Code == http.StatusOK {
+			t.Errorf("export with %q = %v, want refused", authorization, rec.Code)
+		}
+	}
+
+	rec := serve(handler, http.MethodGet, "/api/me/export", bearer(t, cfg, user), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="chirpy-export-`+strconv.Itoa(user.ID)+`.json"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	// credentials never leave the server, not even to their owner
+	for _, secret := range []string{"hash", "refresh-secret"} {
+		if strings.Contains(rec.Body.String(), `"`+secret+`"`) {
+			t.Errorf("export contains %q: %s", secret, rec.Body)
+		}
+	}
+
+	got := accountExport{}
+	err = json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.User.ID != user.ID || got.User.Email != user.Email {
+		t.Errorf("user = %+v", got.User)
+	}
+	if len(got.Chirps) != 1 || got.Chirps[0].ID != chirp.ID {
+		t.Errorf("chirps = %+v, want only chirp %v", got.Chirps, chirp.ID)
+	}
+	if len(got.Followers) != 1 || got.Followers[0].UserID != other.ID || len(got.Following) != 0 {
+		t.Errorf("followers, following = %+v, %+v", got.Followers, got.Following)
+	}
+	if len(got.Bookmarks) != 1 || got.Bookmarks[0].ChirpID != poll.ID {
+		t.Errorf("bookmarks = %+v", got.Bookmarks)
+	}
+	if len(got.PollVotes) != 1 || got.PollVotes[0] != (exportVote{ChirpID: poll.ID, Option: 1}) {
+		t.Errorf("poll votes = %+v", got.PollVotes)
+	}
+	if len(got.Mutes) != 1 || got.Mutes[0].UserID != other.ID || len(got.Blocks) != 0 {
+		t.Errorf("mutes, blocks = %+v, %+v", got.Mutes, got.Blocks)
+	}
+}
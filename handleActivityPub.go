@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/activitypub"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const maxInboxBody = 1 << 20
+
+// actorName is the preferredUsername a user is known by on other servers
+
+func actorName(userID int) string {
+	return "user" + strconv.Itoa(userID)
+}
+
+func actorIRI(base string, userID int) string {
+	return fmt.Sprintf("%s/ap/users/%d", base, userID)
+}
+
+// publicHost is the host part of PUBLIC_URL, which acct: resources must name
+
+func (cfg *apiConfig) publicHost() string {
+	u, err := url.Parse(cfg.PublicURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// respondWithActivity writes an ActivityStreams document
+
+func respondWithActivity(w http.ResponseWriter, code int, payload interface{}) {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", activitypub.ContentType)
+	w.WriteHeader(code)
+	w.Write(dat)
+}
+
+// newActorKey generates the signing key of a new user's actor, which is stored along with the user
+
+func newActorKey() (database.ActorKey, error) {
+	priv, pub, err := activitypub.GenerateKey()
+	if err != nil {
+		return database.ActorKey{}, err
+	}
+	return database.ActorKey{PublicKeyPEM: pub, PrivateKeyPEM: priv}, nil
+}
+
+// handlerWebFinger resolves acct:userN@host resources to the matching ActivityPub actor
+
+func (cfg *apiConfig) handlerWebFinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	base := cfg.PublicURL
+
+	// 1: accept either acct:name@host or the actor IRI itself
+
+	name := ""
+	switch {
+	case strings.HasPrefix(resource, "acct:"):
+		user, host, ok := strings.Cut(strings.TrimPrefix(resource, "acct:"), "@")
+		if !ok || !strings.EqualFold(host, cfg.publicHost()) {
+			respondWithError(w, http.StatusNotFound, "unknown resource")
+			return
+		}
+		name = user
+	case strings.HasPrefix(resource, base+"/ap/users/"):
+		name = "user" + strings.TrimPrefix(resource, base+"/ap/users/")
+	default:
+		respondWithError(w, http.StatusBadRequest, "resource must be an acct: URI or actor IRI")
+		return
+	}
+
+	// 2: look the user up by their actor name
+
+	userID, err := strconv.Atoi(strings.TrimPrefix(name, "user"))
+	if err != nil || !strings.HasPrefix(name, "user") {
+		respondWithError(w, http.StatusNotFound, "unknown resource")
+		return
+	}
+	if _, err := cfg.DB.GetSingleUser(userID); err != nil {
+		respondWithError(w, http.StatusNotFound, "unknown resource")
+		return
+	}
+
+	iri := actorIRI(base, userID)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/jrd+json")
+	dat, err := json.Marshal(activitypub.WebFinger{
+		Subject: "acct:" + actorName(userID) + "@" + cfg.publicHost(),
+		Aliases: []string{iri},
+		Links: []activitypub.WebFingerLink{
+			{Rel: "self", Type: activitypub.ContentType, Href: iri},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "application/atom+xml", Href: fmt.Sprintf("%s/api/users/%d/feed.atom", base, userID)},
+		},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
+
+// handlerActor serves the ActivityPub Person document for a user, including their public key
+
+func (cfg *apiConfig) handlerActor(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	if _, err := cfg.DB.GetSingleUser(userID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	key, err := cfg.DB.GetActorKey(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	iri := actorIRI(cfg.PublicURL, userID)
+	respondWithActivity(w, http.StatusOK, activitypub.Actor{
+		Context:           activitypub.Context,
+		ID:                iri,
+		Type:              "Person",
+		PreferredUsername: actorName(userID),
+		Inbox:             iri + "/inbox",
+		Outbox:            iri + "/outbox",
+		Followers:         iri + "/followers",
+		URL:               fmt.Sprintf("%s/api/chirps?author_id=%d", cfg.PublicURL, userID),
+		PublicKey: activitypub.PublicKey{
+			ID:           iri + "#main-key",
+			Owner:        iri,
+			PublicKeyPem: key.PublicKeyPEM,
+		},
+	})
+}
+
+// newNote renders a public chirp as an ActivityStreams Note
+
+func newNote(base string, chirp Chirp) activitypub.Note {
+	published := ""
+	if chirp.CreatedAt != nil {
+		published = chirp.CreatedAt.Format(time.RFC3339)
+	}
+	actor := actorIRI(base, chirp.Author)
+	return activitypub.Note{
+		ID:           fmt.Sprintf("%s/ap/chirps/%d", base, chirp.ID),
+		Type:         "Note",
+		AttributedTo: actor,
+		Content:      "<p>" + html.EscapeString(chirp.Body) + "</p>",
+		Published:    published,
+		URL:          fmt.Sprintf("%s/api/chirps/%d", base, chirp.ID),
+		To:           []string{activitypub.PublicIRI},
+		Cc:           []string{actor + "/followers"},
+	}
+}
+
+// handlerNote serves a single public chirp as a Note
+
+func (cfg *apiConfig) handlerNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+	dbChirp, err := cfg.DB.GetChirp(id)
+	if err != nil || !(viewer{}).canSee(dbChirp) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	note := newNote(cfg.PublicURL, newChirp(dbChirp, 0))
+	note.Context = activitypub.Context
+	respondWithActivity(w, http.StatusOK, note)
+}
+
+/* handlerOutbox lists a user's public chirps as Create activities, newest first
+the collection links to its first page and each page (page and per_page) links to the next */
+
+func (cfg *apiConfig) handlerOutbox(w http.ResponseWriter, r *http.Request) {
+
+	// 1: parse the user whose outbox is requested
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	if _, err := cfg.DB.GetSingleUser(userID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 2: collect the chirps anyone may see, newest first
+
+	dbChirps, err := cfg.DB.GetChirps()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	anonymous := viewer{}
+	chirps := []Chirp{}
+	for _, dbChirp := range dbChirps {
+		if dbChirp.Author == userID && anonymous.canSee(dbChirp) {
+			chirps = append(chirps, newChirp(dbChirp, 0))
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].ID > chirps[j].ID
+	})
+
+	// 3: without a page the collection only links to its first page, so the outbox is never sent whole
+
+	outbox := actorIRI(cfg.PublicURL, userID) + "/outbox"
+	query := r.URL.Query()
+	pageIRI := func(page int) string {
+		link := fmt.Sprintf("%s?page=%d", outbox, page)
+		if perPage := query.Get("per_page"); perPage != "" {
+			link += "&per_page=" + url.QueryEscape(perPage)
+		}
+		return link
+	}
+	if query.Get("page") == "" {
+		respondWithActivity(w, http.StatusOK, activitypub.OrderedCollection{
+			Context:    activitypub.Context,
+			ID:         outbox,
+			Type:       "OrderedCollection",
+			TotalItems: len(chirps),
+			First:      pageIRI(1),
+		})
+		return
+	}
+
+	// 4: render the requested page as Create activities
+
+	start, end, err := parsePagination(r, len(chirps))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, _ := strconv.Atoi(query.Get("page"))
+
+	items := []interface{}{}
+	for _, chirp := range chirps[start:end] {
+		note := newNote(cfg.PublicURL, chirp)
+		items = append(items, activitypub.Activity{
+			ID:        note.ID + "/activity",
+			Type:      "Create",
+			Actor:     note.AttributedTo,
+			Object:    note,
+			Published: note.Published,
+			To:        note.To,
+			Cc:        note.Cc,
+		})
+	}
+
+	collectionPage := activitypub.OrderedCollectionPage{
+		Context:      activitypub.Context,
+		ID:           pageIRI(page),
+		Type:         "OrderedCollectionPage",
+		PartOf:       outbox,
+		TotalItems:   len(chirps),
+		OrderedItems: items,
+	}
+	if end < len(chirps) {
+		collectionPage.Next = pageIRI(page + 1)
+	}
+	if page > 1 {
+		collectionPage.Prev = pageIRI(page - 1)
+	}
+	respondWithActivity(w, http.StatusOK, collectionPage)
+}
+
+// handlerFollowersCollection reports how many remote actors follow a user without listing them
+
+func (cfg *apiConfig) handlerFollowersCollection(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	followers, err := cfg.DB.GetRemoteFollowers(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithActivity(w, http.StatusOK, activitypub.OrderedCollection{
+		Context:    activitypub.Context,
+		ID:         actorIRI(cfg.PublicURL, userID) + "/followers",
+		Type:       "OrderedCollection",
+		TotalItems: len(followers),
+	})
+}
+
+/* handlerInbox accepts signed activities from other servers
+only Follow and Undo of a Follow are acted on; anything else is acknowledged and dropped */
+
+func (cfg *apiConfig) handlerInbox(w http.ResponseWriter, r *http.Request) {
+
+	// 1: parse the local user the activity is addressed to
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	if _, err := cfg.DB.GetSingleUser(userID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 2: read the body and verify the HTTP signature against the sender's published key
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInboxBody))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read activity")
+		return
+	}
+
+	var sender activitypub.Actor
+	_, err = activitypub.VerifyRequest(r, body, func(keyID string) (*rsa.PublicKey, error) {
+		actor, key, err := cfg.Federation.FetchKey(keyID)
+		sender = actor
+		return key, err
+	})
+	if err != nil {
+		log.Printf("AP: Rejected inbox delivery: %v", err)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 3: decode the activity, which must come from the actor that signed it
+
+	activity := activitypub.Activity{}
+	err = json.Unmarshal(body, &activity)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode activity")
+		return
+	}
+	if activity.Actor != sender.ID {
+		respondWithError(w, http.StatusUnauthorized, "activity actor does not match signature")
+		return
+	}
+
+	// 4: apply the activity
+
+	local := actorIRI(cfg.PublicURL, userID)
+	switch activity.Type {
+	case "Follow":
+		if activitypub.ObjectID(activity.Object) != local {
+			respondWithError(w, http.StatusBadRequest, "Follow is not addressed to this actor")
+			return
+		}
+		_, err = cfg.DB.AddRemoteFollower(userID, sender.ID, sender.Inbox)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("AP: %v now follows user %v", sender.ID, userID)
+		go cfg.deliverAccept(local, userID, sender.Inbox, activity)
+
+	case "Undo":
+		if activitypub.ObjectType(activity.Object) != "Follow" {
+			log.Printf("AP: Ignoring Undo of %v from %v", activitypub.ObjectType(activity.Object), sender.ID)
+			break
+		}
+		err = cfg.DB.RemoveRemoteFollower(userID, sender.ID)
+		if err != nil && !errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("AP: %v unfollowed user %v", sender.ID, userID)
+
+	default:
+		log.Printf("AP: Ignoring %v activity from %v", activity.Type, sender.ID)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deliverAccept tells a remote server its Follow was accepted
+
+func (cfg *apiConfig) deliverAccept(local string, userID int, inbox string, follow activitypub.Activity) {
+	key, err := cfg.DB.GetActorKey(userID)
+	if err != nil {
+		log.Printf("AP: Could not load key for user %v: %v", userID, err)
+		return
+	}
+	priv, err := activitypub.ParsePrivateKey(key.PrivateKeyPEM)
+	if err != nil {
+		log.Printf("AP: Could not parse key for user %v: %v", userID, err)
+		return
+	}
+
+	accept := activitypub.Activity{
+		Context: activitypub.Context,
+		ID:      fmt.Sprintf("%s#accepts/%d", local, time.Now().UnixNano()),
+		Type:    "Accept",
+		Actor:   local,
+		Object:  follow,
+	}
+	err = cfg.Federation.Deliver(inbox, accept, local+"#main-key", priv)
+	if err != nil {
+		log.Printf("AP: Could not deliver Accept to %v: %v", inbox, err)
+		return
+	}
+	log.Printf("AP: Delivered Accept to %v", inbox)
+}
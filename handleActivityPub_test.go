@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/activitypub"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const testPublicURL = "https://chirpy.test"
+
+// remoteServer is a stub of another server, publishing one actor and recording what is delivered to its inbox
+
+type remoteServer struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	delivered chan *http.Request
+	bodies    chan []byte
+}
+
+func newRemoteServer(t *testing.T) *remoteServer {
+	t.Helper()
+	priv, pub, err := activitypub.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := activitypub.ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &remoteServer{
+		key:       key,
+		delivered: make(chan *http.Request, 1),
+		bodies:    make(chan []byte, 1),
+	}
+	remote.srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actor":
+			respondWithActivity(w, http.StatusOK, activitypub.Actor{
+				ID:    remote.actor(),
+				Type:  "Person",
+				Inbox: remote.srv.URL + "/inbox",
+				PublicKey: activitypub.PublicKey{
+					ID:           remote.keyID(),
+					Owner:        remote.actor(),
+					PublicKeyPem: pub,
+				},
+			})
+		case "/inbox":
+			body, _ := io.ReadAll(r.Body)
+			remote.delivered <- r
+			remote.bodies <- body
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(remote.srv.Close)
+	return remote
+}
+
+func (remote *remoteServer) actor() string {
+	return remote.srv.URL + "/actor"
+}
+
+func (remote *remoteServer) keyID() string {
+	return remote.actor() + "#main-key"
+}
+
+// newFederationConfig returns a config with one local user whose federation client can only reach remote
+
+func newFederationConfig(t *testing.T, remote *remoteServer) (*apiConfig, database.ActorKey) {
+	t.Helper()
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newActorKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.CreateUser("local@example.com", "hash", false, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := activitypub.NewClient()
+	client.AllowPrivate = true
+	client.HTTP.Transport.(*http.Transport).TLSClientConfig = remote.srv.Client().Transport.(*http.Transport).TLSClientConfig
+	return &apiConfig{DB: store, Federation: client, PublicURL: testPublicURL}, key
+}
+
+// signedInbox builds a delivery of activity to user 1's inbox signed with key, with body swapped in after signing if set
+
+func signedInbox(t *testing.T, activity activitypub.Activity, keyID string, key *rsa.PrivateKey, body []byte) *http.Request {
+	t.Helper()
+	signed, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body == nil {
+		body = signed
+	}
+	req := httptest.NewRequest(http.MethodPost, testPublicURL+"/ap/users/1/inbox", bytes.NewReader(body))
+	err = activitypub.SignRequest(req, signed, keyID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetPathValue("userID", "1")
+	return req
+}
+
+func TestInboxFollowIsAccepted(t *testing.T) {
+	remote := newRemoteServer(t)
+	cfg, localKey := newFederationConfig(t, remote)
+
+	follow := activitypub.Activity{
+		ID:     remote.srv.URL + "/follows/1",
+		Type:   "Follow",
+		Actor:  remote.actor(),
+		Object: testPublicURL + "/ap/users/1",
+	}
+	rec := httptest.NewRecorder()
+	cfg.handlerInbox(rec, signedInbox(t, follow, remote.keyID(), remote.key, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("inbox returned %v: %s", rec.Code, rec.Body)
+	}
+
+	followers, err := cfg.DB.GetRemoteFollowers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followers) != 1 || followers[0].Actor != remote.actor() {
+		t.Fatalf("followers = %+v, want %v", followers, remote.actor())
+	}
+
+	// the Accept arrives at the follower's inbox signed with the local user's key
+	select {
+	case req := <-remote.delivered:
+		body := <-remote.bodies
+		localPub, err := activitypub.ParsePublicKey(localKey.PublicKeyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := activitypub.VerifyRequest(req, body, func(keyID string) (*rsa.PublicKey, error) {
+			if keyID != testPublicURL+"/ap/users/1#main-key" {
+				return nil, errors.New("unexpected key")
+			}
+			return localPub, nil
+		})
+		if err != nil {
+			t.Fatalf("Accept signature did not verify: %v (keyId %q)", err, keyID)
+		}
+		accept := activitypub.Activity{}
+		err = json.Unmarshal(body, &accept)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept.Type != "Accept" || activitypub.ObjectID(accept.Object) != follow.ID {
+			t.Errorf("delivered %v of %v, want Accept of %v", accept.Type, activitypub.ObjectID(accept.Object), follow.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Accept was delivered")
+	}
+}
+
+func TestInboxRejectsBadSignatures(t *testing.T) {
+	remote := newRemoteServer(t)
+	cfg, _ := newFederationConfig(t, remote)
+	otherPriv, _, err := activitypub.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := activitypub.ParsePrivateKey(otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := activitypub.Activity{
+		ID:     remote.srv.URL + "/follows/1",
+		Type:   "Follow",
+		Actor:  remote.actor(),
+		Object: testPublicURL + "/ap/users/1",
+	}
+	tampered, err := json.Marshal(activitypub.Activity{
+		ID:     follow.ID,
+		Type:   "Follow",
+		Actor:  remote.actor(),
+		Object: testPublicURL + "/ap/users/2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{
+			name: "signed by a key the actor does not publish",
+			req: func() *http.Request {
+				return signedInbox(t, follow, remote.keyID(), otherKey, nil)
+			},
+		},
+		{
+			name: "body changed after signing",
+			req: func() *http.Request {
+				return signedInbox(t, follow, remote.keyID(), remote.key, tampered)
+			},
+		},
+		{
+			name: "key on a plain http URL",
+			req: func() *http.Request {
+				return signedInbox(t, follow, "http://chirpy.test/actor#main-key", remote.key, nil)
+			},
+		},
+		{
+			name: "unsigned",
+			req: func() *http.Request {
+				req := signedInbox(t, follow, remote.keyID(), remote.key, nil)
+				req.Header.Del("Signature")
+				return req
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cfg.handlerInbox(rec, tt.req())
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("inbox returned %v, want %v", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+
+	followers, err := cfg.DB.GetRemoteFollowers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followers) != 0 {
+		t.Errorf("rejected deliveries added followers: %+v", followers)
+	}
+	select {
+	case <-remote.delivered:
+		t.Error("an Accept was delivered for a rejected Follow")
+	default:
+	}
+}
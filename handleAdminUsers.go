@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	maxSuspension         = 365 * 24 * time.Hour
+	impersonationLifetime = 15 * time.Minute
+)
+
+var (
+	errAccountBanned         = errors.New("account is banned")
+	errAccountGone           = errors.New("account no longer exists")
+	errImpersonationRefused  = errors.New("not allowed while impersonating a user")
+	errAdminTargetNotAllowed = errors.New("demote admins before suspending, banning or impersonating them")
+)
+
+// accountStatus returns why a user may not use their account right now, or nil if they may
+
+func accountStatus(dbUser database.User, now time.Time) error {
+	if dbUser.Banned {
+		return errAccountBanned
+	}
+	if dbUser.Suspended(now) {
+		return fmt.Errorf("account is suspended until %v", dbUser.SuspendedUntil.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkAccount looks up the user behind a token so sessions of suspended, banned or deleted accounts are refused
+
+func (cfg *apiConfig) checkAccount(userID int) error {
+	dbUser, err := cfg.DB.GetSingleUser(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		return errAccountGone
+	}
+	if err != nil {
+		return err
+	}
+	return accountStatus(dbUser, time.Now())
+}
+
+// impersonating reports whether the request carries an access token issued by handlerImpersonateUser
+
+func (cfg *apiConfig) impersonating(r *http.Request) bool {
+	claims, err := cfg.tokenClaims(r.Header.Get("Authorization"))
+	return err == nil && claims.Impersonator != 0
+}
+
+/* adminTarget parses the user in the url, checks the calling admin may perform action on them and returns both,
+admins can't act on themselves, and other admins are off limits unless allowAdmins is set */
+
+func (cfg *apiConfig) adminTarget(w http.ResponseWriter, r *http.Request, action auth.Action, allowAdmins bool) (principal, database.User, bool) {
+	caller := principalFrom(r)
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return caller, database.User{}, false
+	}
+	if caller.ID == userID {
+		respondWithError(w, http.StatusBadRequest, "you can't do this to your own account")
+		return caller, database.User{}, false
+	}
+	_, err = cfg.authorize(caller.ID, action, auth.Resource{Owner: userID})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return caller, database.User{}, false
+	}
+
+	target, err := cfg.DB.GetSingleUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return caller, database.User{}, false
+	}
+	if !allowAdmins && userRole(target) == auth.RoleAdmin {
+		respondWithError(w, http.StatusConflict, errAdminTargetNotAllowed.Error())
+		return caller, database.User{}, false
+	}
+	return caller, target, true
+}
+
+// adminReason decodes the optional reason most admin actions accept, an empty body is allowed
+
+func adminReason(r *http.Request) (string, error) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", errors.New("could not decode parameters")
+	}
+	return strings.TrimSpace(params.Reason), nil
+}
+
+/* handlerAdminListUsers lists users for admins with optional filters:
+q matches the email, handle or display name, role is user, moderator or admin,
+and status is active, suspended, banned or unverified; results are paginated with page and per_page */
+
+func (cfg *apiConfig) handlerAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	present := principalFrom(r).presenter()
+	q := r.URL.Query()
+
+	// 1: validate the filters
+
+	search := strings.ToLower(strings.TrimSpace(q.Get("q")))
+	role := auth.Role(q.Get("role"))
+	if role != "" {
+		if _, ok := auth.ParseRole(string(role)); !ok {
+			respondWithError(w, http.StatusBadRequest, "role must be one of user, moderator or admin")
+			return
+		}
+	}
+	status := q.Get("status")
+	switch status {
+	case "", "active", "suspended", "banned", "unverified":
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be one of active, suspended, banned or unverified")
+		return
+	}
+
+	// 2: filter every user
+
+	dbUsers, err := cfg.DB.GetUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	users := []User{}
+	for _, dbUser := range dbUsers {
+		if search != "" &&
+			!strings.Contains(strings.ToLower(dbUser.Email), search) &&
+			!strings.Contains(strings.ToLower(dbUser.Handle), search) &&
+			!strings.Contains(strings.ToLower(dbUser.DisplayName), search) {
+			continue
+		}
+		if role != "" && userRole(dbUser) != role {
+			continue
+		}
+		switch status {
+		case "active":
+			if dbUser.Suspended(now) {
+				continue
+			}
+		case "suspended":
+			if dbUser.Banned || !dbUser.Suspended(now) {
+				continue
+			}
+		case "banned":
+			if !dbUser.Banned {
+				continue
+			}
+		case "unverified":
+			if !dbUser.Unverified {
+				continue
+			}
+		}
+		users = append(users, present.present(dbUser))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	// 3: return the requested page
+
+	start, end, err := parsePagination(r, len(users))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, users[start:end])
+}
+
+// handlerSuspendUser suspends an account for duration_seconds, ending its sessions immediately
+
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		DurationSeconds *int64 `json:"duration_seconds"`
+		Reason          string `json:"reason"`
+	}
+
+	caller, target, ok := cfg.adminTarget(w, r, auth.ActionManageUser, false)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+	if params.DurationSeconds == nil {
+		respondWithError(w, http.StatusBadRequest, "duration_seconds is required, ban the user to suspend them indefinitely")
+		return
+	}
+	duration, err := expiresIn(params.DurationSeconds, maxSuspension)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.DB.SuspendUser(target.ID, caller.ID, time.Now().UTC().Add(duration), strings.TrimSpace(params.Reason))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v suspended user %v until %v", caller.ID, target.ID, dbUser.SuspendedUntil)
+	respondWithJSON(w, http.StatusOK, caller.presenter().present(dbUser))
+}
+
+// handlerBanUser suspends an account until an admin reinstates it, ending its sessions immediately
+
+func (cfg *apiConfig) handlerBanUser(w http.ResponseWriter, r *http.Request) {
+	caller, target, ok := cfg.adminTarget(w, r, auth.ActionManageUser, false)
+	if !ok {
+		return
+	}
+	reason, err := adminReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.DB.BanUser(target.ID, caller.ID, reason)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v banned user %v", caller.ID, target.ID)
+	respondWithJSON(w, http.StatusOK, caller.presenter().present(dbUser))
+}
+
+// handlerReinstateUser lifts a suspension or ban
+
+func (cfg *apiConfig) handlerReinstateUser(w http.ResponseWriter, r *http.Request) {
+	caller, target, ok := cfg.adminTarget(w, r, auth.ActionManageUser, true)
+	if !ok {
+		return
+	}
+	reason, err := adminReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.DB.ReinstateUser(target.ID, caller.ID, reason)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v reinstated user %v", caller.ID, target.ID)
+	respondWithJSON(w, http.StatusOK, caller.presenter().present(dbUser))
+}
+
+// handlerLogoutUser revokes every refresh token of a user, signing them out once their access tokens expire
+
+func (cfg *apiConfig) handlerLogoutUser(w http.ResponseWriter, r *http.Request) {
+	caller, target, ok := cfg.adminTarget(w, r, auth.ActionManageUser, true)
+	if !ok {
+		return
+	}
+	reason, err := adminReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = cfg.DB.LogoutUser(target.ID, caller.ID, reason)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v signed out user %v", caller.ID, target.ID)
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+/* handlerImpersonateUser issues a short-lived access token acting as another user for support debugging
+the token carries an impersonator claim, cannot be refreshed, is refused by admin routes and account security
+endpoints, and its issue is recorded in the audit log along with the required reason */
+
+func (cfg *apiConfig) handlerImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Token        string    `json:"token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+		UserID       int       `json:"user_id"`
+		Impersonator int       `json:"impersonator_id"`
+		AuditID      int       `json:"audit_id"`
+	}
+
+	// 1: check the target and require a reason for the audit log
+
+	caller, target, ok := cfg.adminTarget(w, r, auth.ActionImpersonate, false)
+	if !ok {
+		return
+	}
+	reason, err := adminReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reason == "" {
+		respondWithError(w, http.StatusBadRequest, "a reason is required to impersonate a user")
+		return
+	}
+	err = accountStatus(target, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// 2: record the impersonation before the token exists so no token is ever issued without an audit entry
+
+	expiresAt := time.Now().UTC().Add(impersonationLifetime)
+	action, err := cfg.DB.RecordAdminAction(database.AdminAction{
+		Admin:     caller.ID,
+		Target:    target.ID,
+		Action:    database.AdminActionImpersonate,
+		Reason:    reason,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 3: sign an access token for the target marked with the admin who is acting
+
+	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims{
+		Role:         string(userRole(target)),
+		Impersonator: caller.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy-access",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Subject:   strconv.Itoa(target.ID),
+			ID:        "impersonation-" + strconv.Itoa(action.ID),
+		},
+	})
+	token, err := tkn.SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v is impersonating user %v until %v: %v", caller.ID, target.ID, expiresAt, reason)
+	respondWithJSON(w, http.StatusOK, response{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		UserID:       target.ID,
+		Impersonator: caller.ID,
+		AuditID:      action.ID,
+	})
+}
+
+// handlerAdminAudit returns the log of admin actions on user accounts, newest first and paginated
+
+func (cfg *apiConfig) handlerAdminAudit(w http.ResponseWriter, r *http.Request) {
+	actions, err := cfg.DB.GetAdminActions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ID > actions[j].ID
+	})
+
+	start, end, err := parsePagination(r, len(actions))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, actions[start:end])
+}
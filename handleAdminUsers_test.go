@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// newAdminMux routes the admin user endpoints the way main does, plus an ordinary endpoint to try the target's tokens on
+
+func newAdminMux(cfg *apiConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/users/{userID}/suspend", cfg.requireRole(auth.RoleAdmin, cfg.handlerSuspendUser))
+	mux.HandleFunc("POST /admin/users/{userID}/ban", cfg.requireRole(auth.RoleAdmin, cfg.handlerBanUser))
+	mux.HandleFunc("POST /admin/users/{userID}/reinstate", cfg.requireRole(auth.RoleAdmin, cfg.handlerReinstateUser))
+	mux.HandleFunc("POST /admin/users/{userID}/logout", cfg.requireRole(auth.RoleAdmin, cfg.handlerLogoutUser))
+	mux.HandleFunc("POST /admin/users/{userID}/impersonate", cfg.requireRole(auth.RoleAdmin, cfg.handlerImpersonateUser))
+	mux.HandleFunc("GET /admin/audit", cfg.requireRole(auth.RoleAdmin, cfg.handlerAdminAudit))
+	mux.HandleFunc("GET /api/blocks", cfg.handlerGetBlocks)
+	return mux
+}
+
+func TestSuspendBanAndReinstate(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	otherAdmin := newTestUser(t, cfg, "other-admin@example.com", auth.RoleAdmin)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	mux := newAdminMux(cfg)
+	adminToken := bearer(t, cfg, admin)
+	userToken := bearer(t, cfg, user)
+	path := func(id int, action string) string { return fmt.Sprintf("/admin/users/%d/%v", id, action) }
+
+	// the cases run in order, and wantSession says whether the user's access token still works afterwards
+	tests := []struct {
+		name          string
+		authorization string
+		path          string
+		body          string
+		want          int
+		wantSession   bool
+	}{
+		{name: "not an admin", authorization: bearer(t, cfg, user), path: path(admin.ID, "ban"), want: http.StatusForbidden, wantSession: true},
+		{name: "themselves", authorization: adminToken, path: path(admin.ID, "ban"), want: http.StatusBadRequest, wantSession: true},
+		{name: "another admin", authorization: adminToken, path: path(otherAdmin.ID, "suspend"), body: `{"duration_seconds": 60}`, want: http.StatusConflict, wantSession: true},
+		{name: "missing user", authorization: adminToken, path: path(404, "ban"), want: http.StatusNotFound, wantSession: true},
+		{name: "suspend without a duration", authorization: adminToken, path: path(user.ID, "suspend"), body: `{"reason": "spam"}`, want: http.StatusBadRequest, wantSession: true},
+		{name: "suspend for no time", authorization: adminToken, path: path(user.ID, "suspend"), body: `{"duration_seconds": 0}`, want: http.StatusBadRequest, wantSession: true},
+		{name: "suspend", authorization: adminToken, path: path(user.ID, "suspend"), body: `{"duration_seconds": 3600, "reason": "spam"}`, want: http.StatusOK},
+		{name: "reinstate", authorization: adminToken, path: path(user.ID, "reinstate"), body: `{"reason": "appeal"}`, want: http.StatusOK, wantSession: true},
+		{name: "ban", authorization: adminToken, path: path(user.ID, "ban"), body: `{"reason": "spam again"}`, want: http.StatusOK},
+		{name: "reinstating an admin is allowed", authorization: adminToken, path: path(otherAdmin.ID, "reinstate"), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, http.MethodPost, tt.path, tt.authorization, tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		session := serve(mux, http.MethodGet, "/api/blocks", userToken, "")
+		if (session.Code == http.StatusOK) != tt.wantSession {
+			t.Errorf("%v: user's session = %v %s, want working %v", tt.name, session.Code, session.Body, tt.wantSession)
+		}
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dbUser.Banned || dbUser.SuspensionReason != "spam again" {
+		t.Errorf("user = %+v, want banned for spam again", dbUser)
+	}
+}
+
+func TestSuspendUserResponse(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	mux := newAdminMux(cfg)
+
+	// suspensions longer than the maximum are shortened to it
+	before := time.Now()
+	rec := serve(mux, http.MethodPost, fmt.Sprintf("/admin/users/%d/suspend", user.ID), bearer(t, cfg, admin), `{"duration_seconds": 999999999, "reason": "spam"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %s", rec.Code, rec.Body)
+	}
+	got := User{}
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SuspendedUntil == nil || got.SuspendedUntil.Before(before.Add(maxSuspension)) || got.SuspendedUntil.After(time.Now().Add(maxSuspension)) {
+		t.Errorf("suspended_until = %v, want %v from now", got.SuspendedUntil, maxSuspension)
+	}
+	if got.SuspensionReason != "spam" || got.Banned {
+		t.Errorf("user = %+v", got)
+	}
+}
+
+func TestLogoutUser(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	_, err := cfg.DB.CreateToken("refresh", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newAdminMux(cfg)
+
+	rec := serve(mux, http.MethodPost, fmt.Sprintf("/admin/users/%d/logout", user.ID), bearer(t, cfg, admin), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %s", rec.Code, rec.Body)
+	}
+	if _, err := cfg.DB.GetToken("refresh"); err == nil {
+		t.Error("refresh token survived the logout")
+	}
+	// the account itself is untouched, so access tokens keep working until they expire
+	if rec := serve(mux, http.MethodGet, "/api/blocks", bearer(t, cfg, user), ""); rec.Code != http.StatusOK {
+		t.Errorf("access token after logout = %v, want 200", rec.Code)
+	}
+}
+
+func TestImpersonateUser(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	banned := newTestUser(t, cfg, "banned@example.com", "")
+	_, err := cfg.DB.BanUser(banned.ID, admin.ID, "spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newAdminMux(cfg)
+	adminToken := bearer(t, cfg, admin)
+	path := func(id int) string { return fmt.Sprintf("/admin/users/%d/impersonate", id) }
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{name: "no reason", path: path(user.ID), want: http.StatusBadRequest},
+		{name: "blank reason", path: path(user.ID), body: `{"reason": "  "}`, want: http.StatusBadRequest},
+		{name: "banned user", path: path(banned.ID), body: `{"reason": "ticket 12"}`, want: http.StatusConflict},
+		{name: "themselves", path: path(admin.ID), body: `{"reason": "ticket 12"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(mux, http.MethodPost, tt.path, adminToken, tt.body); rec.Code != tt.want {
+			t.Errorf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	rec := serve(mux, http.MethodPost, path(user.ID), adminToken, `{"reason": "ticket 12"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %v: %s", rec.Code, rec.Body)
+	}
+	got := struct {
+		Token        string    `json:"token"`
+		ExpiresAt    time.Time `json:"expires_at"`
+		UserID       int       `json:"user_id"`
+		Impersonator int       `json:"impersonator_id"`
+		AuditID      int       `json:"audit_id"`
+	}{}
+	err = json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != user.ID || got.Impersonator != admin.ID || got.ExpiresAt.After(time.Now().Add(impersonationLifetime)) {
+		t.Errorf("response = %+v", got)
+	}
+
+	// the ban and the issued token are in the audit log, the refused attempts are not
+	actions, err := cfg.DB.GetAdminActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("%v audit entries, want 2", len(actions))
+	}
+	for _, a := range actions {
+		if a.ID == got.AuditID && (a.Action != database.AdminActionImpersonate || a.Target != user.ID || a.Reason != "ticket 12" || a.ExpiresAt == nil) {
+			t.Errorf("audit entry = %+v", a)
+		}
+	}
+
+	// the token acts as the user on ordinary endpoints but not on admin ones, even for an admin target
+	token := "Bearer " + got.Token
+	if rec := serve(mux, http.MethodGet, "/api/blocks", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("impersonation token on a user endpoint = %v, want 200", rec.Code)
+	}
+	if rec := serve(mux, http.MethodGet, "/admin/audit", token, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("impersonation token on an admin endpoint = %v, want 403", rec.Code)
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	for _, action := range []string{database.AdminActionLogout, database.AdminActionBan, database.AdminActionReinstate} {
+		_, err := cfg.DB.RecordAdminAction(database.AdminAction{Admin: admin.ID, Target: user.ID, Action: action})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := newAdminMux(cfg)
+	adminToken := bearer(t, cfg, admin)
+
+	tests := []struct {
+		name          string
+		authorization string
+		query         string
+		want          int
+		wantActions   []string
+	}{
+		{name: "plain user", authorization: bearer(t, cfg, user), want: http.StatusForbidden},
+		{name: "newest first", authorization: adminToken, want: http.StatusOK, wantActions: []string{database.AdminActionReinstate, database.AdminActionBan, database.AdminActionLogout}},
+		{name: "second page", authorization: adminToken, query: "?page=2&per_page=2", want: http.StatusOK, wantActions: []string{database.AdminActionLogout}},
+		{name: "past the end", authorization: adminToken, query: "?page=3&per_page=2", want: http.StatusOK, wantActions: []string{}},
+		{name: "bad page", authorization: adminToken, query: "?page=0", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mux, http.MethodGet, "/admin/audit"+tt.query, tt.authorization, "")
+			if rec.Code != tt.want {
+				t.Fatalf("status = %v, want %v: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			actions := []database.AdminAction{}
+			err := json.Unmarshal(rec.Body.Bytes(), &actions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, a := range actions {
+				got = append(got, a.Action)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantActions) {
+				t.Errorf("actions = %v, want %v", got, tt.wantActions)
+			}
+		})
+	}
+}
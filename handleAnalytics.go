@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	viewDedupWindow    = 30 * time.Minute
+	viewFlushInterval  = 10 * time.Second
+	maxPendingViews    = 500
+	defaultSeriesDays  = 30
+	maxSeriesDays      = 90
+	analyticsDayFormat = "2006-01-02"
+)
+
+// recordViews counts an impression of each chirp by the reader, ignoring authors reading their own chirps
+
+func (cfg *apiConfig) recordViews(r *http.Request, reader viewer, chirps []Chirp) {
+	key := "user:" + strconv.Itoa(reader.ID)
+	if reader.ID == 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		key = "ip:" + host
+	}
+	for _, chirp := range chirps {
+		if reader.ID != 0 && chirp.Author == reader.ID {
+			continue
+		}
+		cfg.Views.Record(chirp.ID, key)
+	}
+}
+
+// handlerGetAnalytics returns view counts for each of the caller's chirps with a daily time series
+
+func (cfg *apiConfig) handlerGetAnalytics(w http.ResponseWriter, r *http.Request) {
+	type dailyStats struct {
+		Date  string `json:"date"`
+		Views int    `json:"views"`
+	}
+	type chirpStats struct {
+		ChirpID int          `json:"chirp_id"`
+		Views   int          `json:"views"`
+		Daily   []dailyStats `json:"daily"`
+	}
+	type returnParams struct {
+		Views  int          `json:"views"`
+		Chirps []chirpStats `json:"chirps"`
+	}
+
+	// 1: validate the author's access token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 2: parse the optional length of the time series
+
+	days := defaultSeriesDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > maxSeriesDays {
+			respondWithError(w, http.StatusBadRequest, "days must be between 1 and 90")
+			return
+		}
+	}
+
+	// 3: write buffered impressions so the numbers are current
+
+	err = cfg.Views.Flush()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 4: load the author's chirps and their view counts
+
+	dbChirps, err := cfg.DB.GetChirps()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	ids := []int{}
+	for _, dbChirp := range dbChirps {
+		if dbChirp.Author == subject && !dbChirp.Expired(now) {
+			ids = append(ids, dbChirp.ID)
+		}
+	}
+	views, err := cfg.DB.GetViews(ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 5: build the totals and daily series, oldest day first
+
+	series := []string{}
+	for i := days - 1; i >= 0; i-- {
+		series = append(series, now.AddDate(0, 0, -i).Format(analyticsDayFormat))
+	}
+
+	result := returnParams{Chirps: []chirpStats{}}
+	for _, dbChirp := range dbChirps {
+		chirpViews, ok := views[dbChirp.ID]
+		if !ok {
+			continue
+		}
+		stats := chirpStats{
+			ChirpID: dbChirp.ID,
+			Daily:   []dailyStats{},
+		}
+		for _, n := range chirpViews {
+			stats.Views += n
+		}
+		for _, day := range series {
+			stats.Daily = append(stats.Daily, dailyStats{
+				Date:  day,
+				Views: chirpViews[day],
+			})
+		}
+
+		result.Views += stats.Views
+		result.Chirps = append(result.Chirps, stats)
+	}
+
+	sort.Slice(result.Chirps, func(i, j int) bool {
+		return result.Chirps[i].ChirpID < result.Chirps[j].ChirpID
+	})
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestAnalytics(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	reader := newTestUser(t, cfg, "reader@example.com", "")
+	other := newTestUser(t, cfg, "other@example.com", "")
+	popular, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "popular"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quiet, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "quiet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateChirp(database.Chirp{Author: other.ID, Body: "someone else's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetSingleChirp)
+	mux.HandleFunc("GET /api/me/analytics", cfg.handlerGetAnalytics)
+	path := "/api/chirps/" + strconv.Itoa(popular.ID)
+
+	// the reader is counted once per window, anonymous readers by address, and the author never
+	views := []string{bearer(t, cfg, reader), bearer(t, cfg, reader), "", "", bearer(t, cfg, author)}
+	for _, authorization := range views {
+		rec := serve(mux, http.MethodGet, path, authorization, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %v = %v", path, rec.Code)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		wantStatus    int
+		wantDays      int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "default series", authorization: bearer(t, cfg, author), wantStatus: http.StatusOK, wantDays: defaultSeriesDays},
+		{name: "one day", query: "?days=1", authorization: bearer(t, cfg, author), wantStatus: http.StatusOK, wantDays: 1},
+		{name: "zero days", query: "?days=0", authorization: bearer(t, cfg, author), wantStatus: http.StatusBadRequest},
+		{name: "too many days", query: "?days=91", authorization: bearer(t, cfg, author), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mux, http.MethodGet, "/api/me/analytics"+tt.query, tt.authorization, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			result := struct {
+				Views  int `json:"views"`
+				Chirps []struct {
+					ChirpID int `json:"chirp_id"`
+					Views   int `json:"views"`
+					Daily   []struct {
+						Date  string `json:"date"`
+						Views int    `json:"views"`
+					} `json:"daily"`
+				} `json:"chirps"`
+			}{}
+			err := json.Unmarshal(rec.Body.Bytes(), &result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Views != 2 || len(result.Chirps) != 2 {
+				t.Fatalf("analytics = %+v, want 2 views over the author's 2 chirps", result)
+			}
+			if result.Chirps[0].ChirpID != popular.ID || result.Chirps[0].Views != 2 || result.Chirps[1].ChirpID != quiet.ID || result.Chirps[1].Views != 0 {
+				t.Errorf("chirps = %+v", result.Chirps)
+			}
+			daily := result.Chirps[0].Daily
+			today := time.Now().UTC().Format(analyticsDayFormat)
+			if len(daily) != tt.wantDays || daily[len(daily)-1].Date != today || daily[len(daily)-1].Views != 2 {
+				t.Errorf("daily = %+v, want %v days ending today with 2 views", daily, tt.wantDays)
+			}
+		})
+	}
+}
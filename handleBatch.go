@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const maxBatchSize = 50
+
+var errBatchModeratorDelete = errors.New("delete other users' chirps one at a time so the decision is recorded")
+
+/* handlerChirpsBatch applies up to maxBatchSize creates and deletes in one transaction
+creates are validated up front and deletes are authorized inside the transaction; if any item fails nothing is applied */
+
+func (cfg *apiConfig) handlerChirpsBatch(w http.ResponseWriter, r *http.Request) {
+	type operation struct {
+		Op      string `json:"op"`
+		ChirpID int    `json:"chirp_id"`
+		chirpParameters
+	}
+	type parameters struct {
+		Operations []operation `json:"operations"`
+	}
+	type itemResult struct {
+		Index  int    `json:"index"`
+		Op     string `json:"op"`
+		Status int    `json:"status"`
+		Chirp  *Chirp `json:"chirp,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+	type returnParams struct {
+		Committed bool         `json:"committed"`
+		Results   []itemResult `json:"results"`
+	}
+
+	// 1: validate the author's access token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 2: decode the operations and enforce the batch size cap
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode batch operations")
+		return
+	}
+	if len(params.Operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Batch must contain at least one operation")
+		return
+	}
+	if len(params.Operations) > maxBatchSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Batch can contain at most "+strconv.Itoa(maxBatchSize)+" operations")
+		return
+	}
+
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+	policySubject := subjectFor(dbUser)
+
+	// 3: validate each create the same way a single create is
+
+	_, createErr := cfg.Policy.Can(policySubject, auth.ActionCreateChirp, auth.Resource{})
+
+	results := make([]itemResult, len(params.Operations))
+	ops := make([]database.BatchOp, len(params.Operations))
+	invalid := false
+	for i, op := range params.Operations {
+		results[i] = itemResult{Index: i, Op: op.Op}
+		switch op.Op {
+		case "create":
+			if createErr != nil {
+				results[i].Status = http.StatusForbidden
+				results[i].Error = createErr.Error()
+				invalid = true
+				continue
+			}
+			chirp, err := cfg.prepareChirp(op.chirpParameters, subject, reader)
+			if err != nil {
+				results[i].Status = http.StatusBadRequest
+				results[i].Error = err.Error()
+				invalid = true
+				continue
+			}
+			ops[i] = database.BatchOp{Create: &chirp}
+		case "delete":
+			ops[i] = database.BatchOp{Delete: op.ChirpID}
+		default:
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = "op must be create or delete"
+			invalid = true
+		}
+	}
+	if invalid {
+		for i := range results {
+			if results[i].Status == 0 {
+				results[i].Status = http.StatusFailedDependency
+			}
+		}
+		respondWithJSON(w, http.StatusBadRequest, returnParams{Results: results})
+		return
+	}
+
+	// 4: apply the whole batch in a single locked write, authorizing deletes against the chirps as they are then
+
+	dbResults, err := cfg.DB.ApplyBatch(subject, ops, func(chirp database.Chirp) error {
+		return cfg.batchDeleteAllowed(policySubject, chirp)
+	})
+	if err != nil && !errors.Is(err, database.ErrBatchFailed) {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	committed := err == nil
+
+	for i, dbResult := range dbResults {
+		switch {
+		case errors.Is(dbResult.Err, database.ErrNotExist):
+			results[i].Status = http.StatusNotFound
+			results[i].Error = dbResult.Err.Error()
+		case dbResult.Err != nil:
+			results[i].Status = http.StatusForbidden
+			results[i].Error = dbResult.Err.Error()
+		case !committed:
+			results[i].Status = http.StatusFailedDependency
+		case ops[i].Create != nil:
+			chirp := newChirp(dbResult.Chirp, subject)
+			results[i].Status = http.StatusCreated
+			results[i].Chirp = &chirp
+		default:
+			results[i].Status = http.StatusOK
+		}
+	}
+
+	if !committed {
+		respondWithJSON(w, http.StatusBadRequest, returnParams{Results: results})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnParams{Committed: true, Results: results})
+}
+
+/* batchDeleteAllowed checks the subject may delete the chirp as part of a batch
+moderator deletions of other users' chirps are recorded as decisions, so those must go through the single delete endpoint */
+
+func (cfg *apiConfig) batchDeleteAllowed(subject auth.Subject, chirp database.Chirp) error {
+	grant, err := cfg.Policy.Can(subject, auth.ActionDeleteChirp, auth.Resource{Owner: chirp.Author})
+	if err != nil {
+		return err
+	}
+	if grant.ByRole {
+		return errBatchModeratorDelete
+	}
+	return nil
+}
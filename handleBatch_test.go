@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestChirpsBatch(t *testing.T) {
+	type result struct {
+		Committed bool `json:"committed"`
+		Results   []struct {
+			Status int    `json:"status"`
+			Chirp  *Chirp `json:"chirp"`
+		} `json:"results"`
+	}
+	create := `{"op": "create", "body": "hello"}`
+	deleteOp := func(id int) string { return fmt.Sprintf(`{"op": "delete", "chirp_id": %d}`, id) }
+
+	tests := []struct {
+		name       string
+		moderator  bool
+		ops        func(own int, other int) []string
+		wantStatus int
+		want       []int
+		wantChirps int
+	}{
+		{
+			name:       "creates and deletes",
+			ops:        func(own int, other int) []string { return []string{create, deleteOp(own), create} },
+			wantStatus: http.StatusOK,
+			want:       []int{http.StatusCreated, http.StatusOK, http.StatusCreated},
+			wantChirps: 3,
+		},
+		{
+			name: "invalid create",
+			ops: func(own int, other int) []string {
+				return []string{create, `{"op": "create", "body": "` + strings.Repeat("a", 141) + `"}`}
+			},
+			wantStatus: http.StatusBadRequest,
+			want:       []int{http.StatusFailedDependency, http.StatusBadRequest},
+			wantChirps: 2,
+		},
+		{
+			name:       "unknown op",
+			ops:        func(own int, other int) []string { return []string{deleteOp(own), `{"op": "edit"}`} },
+			wantStatus: http.StatusBadRequest,
+			want:       []int{http.StatusFailedDependency, http.StatusBadRequest},
+			wantChirps: 2,
+		},
+		{
+			name:       "missing chirp",
+			ops:        func(own int, other int) []string { return []string{create, deleteOp(own), deleteOp(404)} },
+			wantStatus: http.StatusBadRequest,
+			want:       []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound},
+			wantChirps: 2,
+		},
+		{
+			name:       "another user's chirp",
+			ops:        func(own int, other int) []string { return []string{deleteOp(own), deleteOp(other)} },
+			wantStatus: http.StatusBadRequest,
+			want:       []int{http.StatusFailedDependency, http.StatusForbidden},
+			wantChirps: 2,
+		},
+		{
+			name:       "moderators delete other users' chirps one at a time",
+			moderator:  true,
+			ops:        func(own int, other int) []string { return []string{deleteOp(other)} },
+			wantStatus: http.StatusBadRequest,
+			want:       []int{http.StatusForbidden},
+			wantChirps: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			role := auth.Role("")
+			if tt.moderator {
+				role = auth.RoleModerator
+			}
+			author := newTestUser(t, cfg, "author@example.com", role)
+			other := newTestUser(t, cfg, "other@example.com", "")
+			own, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "mine"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			theirs, err := cfg.DB.CreateChirp(database.Chirp{Author: other.ID, Body: "theirs"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := `{"operations": [` + strings.Join(tt.ops(own.ID, theirs.ID), ",") + `]}`
+			rec := serve(http.HandlerFunc(cfg.handlerChirpsBatch), http.MethodPost, "/api/chirps/batch", bearer(t, cfg, author), body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			got := result{}
+			err = json.Unmarshal(rec.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Committed != (tt.wantStatus == http.StatusOK) || len(got.Results) != len(tt.want) {
+				t.Fatalf("result = %+v", got)
+			}
+			for i, item := range got.Results {
+				if item.Status != tt.want[i] {
+					t.Errorf("item %v status = %v, want %v", i, item.Status, tt.want[i])
+				}
+				if (item.Chirp != nil) != (item.Status == http.StatusCreated) {
+					t.Errorf("item %v chirp = %+v", i, item.Chirp)
+				}
+			}
+
+			chirps, err := cfg.DB.GetChirps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != tt.wantChirps {
+				t.Errorf("chirps = %v, want %v", len(chirps), tt.wantChirps)
+			}
+		})
+	}
+}
+
+func TestChirpsBatchSize(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	ops := func(n int) string {
+		return `{"operations": [` + strings.TrimSuffix(strings.Repeat(`{"op": "create", "body": "hi"},`, n), ",") + `]}`
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		want          int
+	}{
+		{name: "no token", body: ops(1), want: http.StatusUnauthorized},
+		{name: "empty batch", authorization: bearer(t, cfg, author), body: ops(0), want: http.StatusBadRequest},
+		{name: "malformed", authorization: bearer(t, cfg, author), body: `{"operations": {}}`, want: http.StatusBadRequest},
+		{name: "largest batch", authorization: bearer(t, cfg, author), body: ops(maxBatchSize), want: http.StatusOK},
+		{name: "too large", authorization: bearer(t, cfg, author), body: ops(maxBatchSize + 1), want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(http.HandlerFunc(cfg.handlerChirpsBatch), http.MethodPost, "/api/chirps/batch", tt.authorization, tt.body)
+			if rec.Code != tt.want {
+				t.Errorf("status = %v, want %v: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
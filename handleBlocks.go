@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// HiddenUser is an entry in the caller's list of blocked or muted users
+
+type HiddenUser struct {
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// relationTarget parses the user in the url and the caller's token, refusing to act on the caller themselves
+
+func (cfg *apiConfig) relationTarget(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	target, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return 0, 0, false
+	}
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return 0, 0, false
+	}
+	if subject == target {
+		respondWithError(w, http.StatusBadRequest, "You can't block or mute yourself")
+		return 0, 0, false
+	}
+	return subject, target, true
+}
+
+/* handlerBlockUser blocks the user in the url: neither user can see the other's chirps, follow, quote
+or send direct chirps to the other, and existing follows between them are removed */
+
+func (cfg *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	subject, target, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.CreateBlock(subject, target)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyBlocked) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, nil)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	subject, target, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.DB.DeleteBlock(subject, target)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "not blocking user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// handlerMuteUser hides the user in the url from the caller's timelines and notifications without them knowing
+
+func (cfg *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request) {
+	subject, target, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.DB.CreateMute(subject, target)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyMuted) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, nil)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	subject, target, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.DB.DeleteMute(subject, target)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "not muting user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// handlerGetBlocks lists the users the caller has blocked, most recent first
+
+func (cfg *apiConfig) handlerGetBlocks(w http.ResponseWriter, r *http.Request) {
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	blocks, err := cfg.DB.GetBlocks(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users := []HiddenUser{}
+	for _, b := range blocks {
+		users = append(users, HiddenUser{UserID: b.Blocked, CreatedAt: b.CreatedAt})
+	}
+	sortHiddenUsers(users)
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// handlerGetMutes lists the users the caller has muted, most recent first
+
+func (cfg *apiConfig) handlerGetMutes(w http.ResponseWriter, r *http.Request) {
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	mutes, err := cfg.DB.GetMutes(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users := []HiddenUser{}
+	for _, m := range mutes {
+		users = append(users, HiddenUser{UserID: m.Muted, CreatedAt: m.CreatedAt})
+	}
+	sortHiddenUsers(users)
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+func sortHiddenUsers(users []HiddenUser) {
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.After(users[j].CreatedAt)
+		}
+		return users[i].UserID < users[j].UserID
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestBlockAndMuteEndpoints(t *testing.T) {
+	for _, kind := range []string{"block", "mute"} {
+		t.Run(kind, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			user := newTestUser(t, cfg, "user@example.com", "")
+			other := newTestUser(t, cfg, "other@example.com", "")
+			token := bearer(t, cfg, user)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /api/users/{userID}/block", cfg.handlerBlockUser)
+			mux.HandleFunc("DELETE /api/users/{userID}/block", cfg.handlerUnblockUser)
+			mux.HandleFunc("POST /api/users/{userID}/mute", cfg.handlerMuteUser)
+			mux.HandleFunc("DELETE /api/users/{userID}/mute", cfg.handlerUnmuteUser)
+			mux.HandleFunc("GET /api/blocks", cfg.handlerGetBlocks)
+			mux.HandleFunc("GET /api/mutes", cfg.handlerGetMutes)
+			path := func(id interface{}) string { return fmt.Sprintf("/api/users/%v/%v", id, kind) }
+
+			// the cases run in order against the same pair of users
+			tests := []struct {
+				name          string
+				method        string
+				path          string
+				authorization string
+				want          int
+			}{
+				{name: "no token", method: http.MethodPost, path: path(other.ID), want: http.StatusUnauthorized},
+				{name: "non-numeric user", method: http.MethodPost, path: path("abc"), authorization: token, want: http.StatusBadRequest},
+				{name: "themselves", method: http.MethodPost, path: path(user.ID), authorization: token, want: http.StatusBadRequest},
+				{name: "missing user", method: http.MethodPost, path: path(404), authorization: token, want: http.StatusNotFound},
+				{name: "create", method: http.MethodPost, path: path(other.ID), authorization: token, want: http.StatusCreated},
+				{name: "create twice", method: http.MethodPost, path: path(other.ID), authorization: token, want: http.StatusConflict},
+				{name: "list", method: http.MethodGet, path: "/api/" + kind + "s", authorization: token, want: http.StatusOK},
+				{name: "remove", method: http.MethodDelete, path: path(other.ID), authorization: token, want: http.StatusOK},
+				{name: "remove twice", method: http.MethodDelete, path: path(other.ID), authorization: token, want: http.StatusNotFound},
+			}
+			for _, tt := range tests {
+				rec := serve(mux, tt.method, tt.path, tt.authorization, "")
+				if rec.Code != tt.want {
+					t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+				}
+				if tt.method != http.MethodGet {
+					continue
+				}
+				listed := []HiddenUser{}
+				err := json.Unmarshal(rec.Body.Bytes(), &listed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(listed) != 1 || listed[0].UserID != other.ID {
+					t.Errorf("%v: %+v, want only user %v", tt.name, listed, other.ID)
+				}
+			}
+
+			// the list is private to whoever made it
+			rec := serve(mux, http.MethodGet, "/api/"+kind+"s", bearer(t, cfg, other), "")
+			if rec.Code != http.StatusOK || rec.Body.String() != "[]" {
+				t.Errorf("other user's list = %v %s, want empty", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestBlocksAndMutesHideChirps(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	blocked := newTestUser(t, cfg, "blocked@example.com", "")
+	muter := newTestUser(t, cfg, "muter@example.com", "")
+	bystander := newTestUser(t, cfg, "bystander@example.com", "")
+	_, err := cfg.DB.CreateBlock(author.ID, blocked.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.CreateMute(muter.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "hello", Visibility: database.VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the bystander's chirp keeps every list non-empty
+	other, err := cfg.DB.CreateChirp(database.Chirp{Author: bystander.ID, Body: "hi", Visibility: database.VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps", cfg.handlerChirpsCreate)
+	mux.HandleFunc("GET /api/chirps", cfg.handlerGetAllChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetSingleChirp)
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.handlerFollowUser)
+
+	chirpPath := fmt.Sprintf("/api/chirps/%d", chirp.ID)
+	authorPath := fmt.Sprintf("/api/chirps?author_id=%d", author.ID)
+	tests := []struct {
+		name         string
+		reader       database.User
+		wantTimeline []int
+		wantByAuthor bool
+		wantSingle   int
+	}{
+		{name: "bystander", reader: bystander, wantTimeline: []int{chirp.ID, other.ID}, wantByAuthor: true, wantSingle: http.StatusOK},
+		{name: "blocked by the author", reader: blocked, wantTimeline: []int{other.ID}, wantSingle: http.StatusNotFound},
+		{name: "author who blocked the reader", reader: author, wantTimeline: []int{chirp.ID, other.ID}, wantByAuthor: true, wantSingle: http.StatusOK},
+		{name: "muted the author", reader: muter, wantTimeline: []int{other.ID}, wantByAuthor: true, wantSingle: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := bearer(t, cfg, tt.reader)
+			if got := chirpIDs(t, serve(mux, http.MethodGet, "/api/chirps", token, "").Body.Bytes()); fmt.Sprint(got) != fmt.Sprint(tt.wantTimeline) {
+				t.Errorf("timeline = %v, want %v", got, tt.wantTimeline)
+			}
+			// an author with nothing visible gets a message rather than a list
+			rec := serve(mux, http.MethodGet, authorPath, token, "")
+			listed := []Chirp{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &listed)
+			if got := len(listed) == 1 && listed[0].ID == chirp.ID; got != tt.wantByAuthor {
+				t.Errorf("GET %v = %s, want listed %v", authorPath, rec.Body, tt.wantByAuthor)
+			}
+			if rec := serve(mux, http.MethodGet, chirpPath, token, ""); rec.Code != tt.wantSingle {
+				t.Errorf("GET %v = %v, want %v", chirpPath, rec.Code, tt.wantSingle)
+			}
+		})
+	}
+
+	// a block works in both directions for follows and direct chirps
+	for _, pair := range [][2]database.User{{blocked, author}, {author, blocked}} {
+		path := fmt.Sprintf("/api/users/%d/follow", pair[1].ID)
+		if rec := serve(mux, http.MethodPost, path, bearer(t, cfg, pair[0]), ""); rec.Code != http.StatusForbidden {
+			t.Errorf("user %v following user %v = %v, want 403", pair[0].ID, pair[1].ID, rec.Code)
+		}
+		body := fmt.Sprintf(`{"body": "psst", "visibility": "direct", "recipients": [%d]}`, pair[1].ID)
+		if rec := serve(mux, http.MethodPost, "/api/chirps", bearer(t, cfg, pair[0]), body); rec.Code != http.StatusBadRequest {
+			t.Errorf("user %v sending a direct chirp to user %v = %v, want 400", pair[0].ID, pair[1].ID, rec.Code)
+		}
+	}
+	body := fmt.Sprintf(`{"body": "psst", "visibility": "direct", "recipients": [%d]}`, author.ID)
+	if rec := serve(mux, http.MethodPost, "/api/chirps", bearer(t, cfg, muter), body); rec.Code != http.StatusCreated {
+		t.Errorf("direct chirp to a muted user = %v, want 201: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const maxPinnedChirps = 3
+
+// handlerBookmarkChirp privately bookmarks a chirp the caller can see
+
+func (cfg *apiConfig) handlerBookmarkChirp(w http.ResponseWriter, r *http.Request) {
+
+	// 1: parse chirp ID from url parameters
+
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	// 2: validate the caller's access token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 3: chirps the caller can't see can't be bookmarked
+
+	chirp, err := cfg.DB.GetChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reader.canSee(chirp) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	// 4: save the bookmark
+
+	_, err = cfg.DB.CreateBookmark(subject, id)
+	if errors.Is(err, database.ErrAlreadyBookmarked) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, nil)
+}
+
+func (cfg *apiConfig) handlerDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	err = cfg.DB.DeleteBookmark(subject, id)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "bookmark not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// handlerGetBookmarks returns the caller's bookmarked chirps, most recently bookmarked first
+
+func (cfg *apiConfig) handlerGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	bookmarks, dbChirps, err := cfg.DB.GetBookmarks(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// chirps can become invisible after being bookmarked, so visibility is checked again on every read
+
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].ID > bookmarks[j].ID
+	})
+
+	chirps := []Chirp{}
+	for _, b := range bookmarks {
+		chirp := dbChirps[b.ChirpID]
+		if !reader.canSee(chirp) {
+			continue
+		}
+		chirps = append(chirps, newChirp(chirp, reader.ID))
+	}
+
+	start, end, err := parsePagination(r, len(chirps))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirps = chirps[start:end]
+	err = cfg.attachQuotes(chirps, reader)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cfg.recordViews(r, reader, chirps)
+
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
+// handlerPinChirp pins one of the caller's own chirps to their profile
+
+func (cfg *apiConfig) handlerPinChirp(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	_, err = cfg.authorize(subject, auth.ActionPinChirp, auth.Resource{Owner: chirp.Author})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	user, err := cfg.DB.PinChirp(subject, id, maxPinnedChirps)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrTooManyPins) {
+		respondWithError(w, http.StatusConflict, "You can pin at most "+strconv.Itoa(maxPinnedChirps)+" chirps")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user.Pinned)
+}
+
+func (cfg *apiConfig) handlerUnpinChirp(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := cfg.DB.UnpinChirp(subject, id)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "chirp is not pinned")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user.Pinned)
+}
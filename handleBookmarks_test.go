@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func newBookmarkMux(cfg *apiConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps", cfg.handlerGetAllChirps)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/bookmark", cfg.handlerBookmarkChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/bookmark", cfg.handlerDeleteBookmark)
+	mux.HandleFunc("GET /api/bookmarks", cfg.handlerGetBookmarks)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/pin", cfg.handlerPinChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/pin", cfg.handlerUnpinChirp)
+	return mux
+}
+
+// chirpIDs decodes a list of chirps from a response body and returns their IDs in order
+
+func chirpIDs(t *testing.T, body []byte) []int {
+	t.Helper()
+	chirps := []Chirp{}
+	err := json.Unmarshal(body, &chirps)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	ids := []int{}
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+func TestBookmarkEndpoints(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	reader := newTestUser(t, cfg, "reader@example.com", "")
+	token := bearer(t, cfg, reader)
+	mux := newBookmarkMux(cfg)
+
+	ids := []int{}
+	for _, chirp := range []database.Chirp{
+		{Body: "one"},
+		{Body: "two"},
+		{Body: "three"},
+		{Body: "followers only", Visibility: database.VisibilityFollowers},
+	} {
+		chirp.Author = author.ID
+		chirp, err := cfg.DB.CreateChirp(chirp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, chirp.ID)
+	}
+	bookmark := func(id int) string { return fmt.Sprintf("/api/chirps/%d/bookmark", id) }
+
+	// the cases run in order against the same reader
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		anonymous bool
+		want      int
+	}{
+		{name: "no token", method: http.MethodPost, path: bookmark(ids[0]), anonymous: true, want: http.StatusUnauthorized},
+		{name: "bookmark", method: http.MethodPost, path: bookmark(ids[0]), want: http.StatusCreated},
+		{name: "bookmark twice", method: http.MethodPost, path: bookmark(ids[0]), want: http.StatusConflict},
+		{name: "bookmark another", method: http.MethodPost, path: bookmark(ids[1]), want: http.StatusCreated},
+		{name: "bookmark a third", method: http.MethodPost, path: bookmark(ids[2]), want: http.StatusCreated},
+		{name: "chirp the reader can't see", method: http.MethodPost, path: bookmark(ids[3]), want: http.StatusNotFound},
+		{name: "missing chirp", method: http.MethodPost, path: bookmark(404), want: http.StatusNotFound},
+		{name: "remove", method: http.MethodDelete, path: bookmark(ids[1]), want: http.StatusOK},
+		{name: "remove again", method: http.MethodDelete, path: bookmark(ids[1]), want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		authorization := token
+		if tt.anonymous {
+			authorization = ""
+		}
+		rec := serve(mux, tt.method, tt.path, authorization, "")
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	// newest bookmark first, paginated, and hidden chirps drop out of the list
+	pages := []struct {
+		query string
+		want  []int
+	}{
+		{query: "", want: []int{ids[2], ids[0]}},
+		{query: "?per_page=1", want: []int{ids[2]}},
+		{query: "?per_page=1&page=2", want: []int{ids[0]}},
+		{query: "?per_page=1&page=3", want: []int{}},
+	}
+	for _, page := range pages {
+		rec := serve(mux, http.MethodGet, "/api/bookmarks"+page.query, token, "")
+		got := chirpIDs(t, rec.Body.Bytes())
+		if fmt.Sprint(got) != fmt.Sprint(page.want) {
+			t.Errorf("GET /api/bookmarks%v = %v, want %v", page.query, got, page.want)
+		}
+	}
+	if rec := serve(mux, http.MethodGet, "/api/bookmarks?page=0", token, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("page=0 status = %v, want 400", rec.Code)
+	}
+
+	_, err := cfg.DB.ModerateChirp(ids[2], 99, database.DecisionHide, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(mux, http.MethodGet, "/api/bookmarks", token, "")
+	if got := chirpIDs(t, rec.Body.Bytes()); fmt.Sprint(got) != fmt.Sprint([]int{ids[0]}) {
+		t.Errorf("bookmarks after hiding a chirp = %v, want %v", got, []int{ids[0]})
+	}
+}
+
+func TestPinEndpoints(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	other := newTestUser(t, cfg, "other@example.com", "")
+	token := bearer(t, cfg, author)
+	mux := newBookmarkMux(cfg)
+
+	ids := []int{}
+	for i := 0; i <= maxPinnedChirps+1; i++ {
+		chirp, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, chirp.ID)
+	}
+	pin := func(id int) string { return fmt.Sprintf("/api/chirps/%d/pin", id) }
+
+	// the cases run in order, pinning the newest chirps first
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		want          int
+	}{
+		{name: "another user's chirp", method: http.MethodPost, path: pin(ids[0]), authorization: bearer(t, cfg, other), want: http.StatusForbidden},
+		{name: "first pin", method: http.MethodPost, path: pin(ids[3]), want: http.StatusOK},
+		{name: "second pin", method: http.MethodPost, path: pin(ids[2]), want: http.StatusOK},
+		{name: "third pin", method: http.MethodPost, path: pin(ids[1]), want: http.StatusOK},
+		{name: "over the limit", method: http.MethodPost, path: pin(ids[0]), want: http.StatusConflict},
+		{name: "missing chirp", method: http.MethodPost, path: pin(404), want: http.StatusNotFound},
+		{name: "unpin", method: http.MethodDelete, path: pin(ids[2]), want: http.StatusOK},
+		{name: "unpin a chirp that isn't pinned", method: http.MethodDelete, path: pin(ids[2]), want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		authorization := tt.authorization
+		if authorization == "" {
+			authorization = token
+		}
+		rec := serve(mux, tt.method, tt.path, authorization, "")
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	// pinned chirps come first in pin order when listing by author, the rest follow in the requested order
+	listings := []struct {
+		query string
+		want  []int
+	}{
+		{query: fmt.Sprintf("?author_id=%d", author.ID), want: []int{ids[3], ids[1], ids[0], ids[2], ids[4]}},
+		{query: fmt.Sprintf("?author_id=%d&sort=desc", author.ID), want: []int{ids[3], ids[1], ids[4], ids[2], ids[0]}},
+		{query: "", want: ids},
+	}
+	for _, listing := range listings {
+		rec := serve(mux, http.MethodGet, "/api/chirps"+listing.query, "", "")
+		got := chirpIDs(t, rec.Body.Bytes())
+		if fmt.Sprint(got) != fmt.Sprint(listing.want) {
+			t.Errorf("GET /api/chirps%v = %v, want %v", listing.query, got, listing.want)
+		}
+	}
+}
@@ -9,25 +9,70 @@ import (
 	"net/url"
 	"sort"
 	"strconv"
-	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/moderation"
 )
 
 type Chirp struct {
-	ID     int    `json:"id"`
-	Body   string `json:"body"`
-	Author int    `json:"author_id"`
+	ID         int          `json:"id"`
+	Body       string       `json:"body"`
+	Author     int          `json:"author_id"`
+	Visibility string       `json:"visibility"`
+	Recipients []int        `json:"recipients,omitempty"`
+	Pinned     bool         `json:"pinned,omitempty"`
+	Poll       *Poll        `json:"poll,omitempty"`
+	QuoteOf    int          `json:"quote_of,omitempty"`
+	Quoted     *QuotedChirp `json:"quoted,omitempty"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	CreatedAt  *time.Time   `json:"created_at,omitempty"`
+}
+
+// newChirp converts a database chirp into its API representation as seen by viewerID
+
+func newChirp(dbChirp database.Chirp, viewerID int) Chirp {
+	visibility := dbChirp.Visibility
+	if visibility == "" {
+		visibility = database.VisibilityPublic
+	}
+	chirp := Chirp{
+		ID:         dbChirp.ID,
+		Body:       dbChirp.Body,
+		Author:     dbChirp.Author,
+		Visibility: visibility,
+		Recipients: dbChirp.Recipients,
+		Poll:       newPoll(dbChirp, viewerID),
+		QuoteOf:    dbChirp.QuoteOf,
+		ExpiresAt:  dbChirp.ExpiresAt,
+	}
+	if !dbChirp.CreatedAt.IsZero() {
+		chirp.CreatedAt = &dbChirp.CreatedAt
+	}
+	return chirp
+}
+
+// maxChirpTTL is the longest lifetime an ephemeral chirp can ask for
+
+const maxChirpTTL = 30 * 24 * time.Hour
+
+type chirpParameters struct {
+	Body             string          `json:"body"`
+	Visibility       string          `json:"visibility"`
+	Recipients       []int           `json:"recipients"`
+	Poll             *pollParameters `json:"poll"`
+	QuoteOf          int             `json:"quote_of"`
+	ExpiresInSeconds *int64          `json:"expires_in_seconds,omitempty"`
 }
 
 /* 	handlerChirpsCreate creates a chirp, saves it to database and sends it back via response */
 
 func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
-	type parameters struct {
-		Body string `json:"body"`
-	}
 
 	// 1: attempt to decode json data from request object
 
-	params := parameters{}
+	params := chirpParameters{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&params)
 	if err != nil {
@@ -35,26 +80,36 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// 2: pass chirp to validator function to ensure it meets necessary standards
+	// 2: parse and validate user's access token
 
-	cleaned, err := validateChirp(params.Body)
+	token := r.Header.Get("Authorization")
+	subject, err := cfg.validateToken(token, "chirpy-access")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithError(w, 500, "could not determine access token")
+		return
+	}
+	_, err = cfg.authorize(subject, auth.ActionCreateChirp, auth.Resource{})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
 		return
 	}
 
-	// 3: parse and validate user's access token
+	// 3: pass chirp to validator function to ensure it meets necessary standards
 
-	token := r.Header.Get("Authorization")
-	subject, err := cfg.validateToken(token, "chirpy-access")
+	reader, err := cfg.loadViewer(r)
 	if err != nil {
-		respondWithError(w, 500, "could not determine access token")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dbChirp, err := cfg.prepareChirp(params, subject, reader)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// 4: if access token is valid, create chirp in database
 
-	chirp, err := cfg.DB.CreateChirp(cleaned, subject)
+	chirp, err := cfg.DB.CreateChirp(dbChirp)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
@@ -62,11 +117,106 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 
 	// 5: respond successfully with copy of created chirp
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:     chirp.ID,
-		Body:   chirp.Body,
-		Author: chirp.Author,
-	})
+	created := []Chirp{newChirp(chirp, subject)}
+	err = cfg.attachQuotes(created, reader)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created[0])
+}
+
+/* prepareChirp validates everything about a new chirp before it is saved
+any error it returns describes a problem with params and is safe to show the author */
+
+func (cfg *apiConfig) prepareChirp(params chirpParameters, subject int, reader viewer) (database.Chirp, error) {
+
+	// 1: pass chirp to validator function to ensure it meets necessary standards
+
+	moderated, err := cfg.validateChirp(params.Body)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	// 2: validate the requested visibility and, for direct chirps, their recipients
+
+	visibility := params.Visibility
+	if visibility == "" {
+		visibility = database.VisibilityPublic
+	}
+	err = cfg.validateVisibility(visibility, params.Recipients)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	for _, recipient := range params.Recipients {
+		if _, ok := reader.blocked[recipient]; ok {
+			return database.Chirp{}, fmt.Errorf("Can't send a direct chirp to user %v", recipient)
+		}
+	}
+
+	// 3: validate the optional poll attached to the chirp
+
+	poll, err := cfg.validatePoll(params.Poll)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	// 4: a quoted chirp must exist and be visible to the author
+
+	if params.QuoteOf != 0 {
+		original, err := cfg.DB.GetChirp(params.QuoteOf)
+		if err != nil || !reader.canSee(original) {
+			return database.Chirp{}, errors.New("Quoted chirp does not exist")
+		}
+	}
+
+	// 5: ephemeral chirps get an expiry time after which they disappear from every read path
+
+	var expiresAt *time.Time
+	if params.ExpiresInSeconds != nil {
+		ttl, err := expiresIn(params.ExpiresInSeconds, maxChirpTTL)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		t := time.Now().UTC().Add(ttl)
+		expiresAt = &t
+	}
+
+	return database.Chirp{
+		Body:        moderated.Body,
+		Author:      subject,
+		FlagReasons: moderated.Reasons,
+		Visibility:  visibility,
+		Recipients:  params.Recipients,
+		Poll:        poll,
+		QuoteOf:     params.QuoteOf,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// validateVisibility ensures visibility is known and that direct chirps are addressed to existing users
+
+func (cfg *apiConfig) validateVisibility(visibility string, recipients []int) error {
+	switch visibility {
+	case database.VisibilityPublic, database.VisibilityFollowers:
+		if len(recipients) > 0 {
+			return errors.New("Recipients can only be set on direct chirps")
+		}
+		return nil
+	case database.VisibilityDirect:
+		if len(recipients) < 1 {
+			return errors.New("Direct chirps need at least one recipient")
+		}
+		for _, recipient := range recipients {
+			_, err := cfg.DB.GetSingleUser(recipient)
+			if err != nil {
+				return fmt.Errorf("Recipient %v does not exist", recipient)
+			}
+		}
+		return nil
+	default:
+		return errors.New("Visibility must be one of public, followers or direct")
+	}
 }
 
 /* handlerGetAllChirps receives author_id as a parameter and returns all chirps for that user */
@@ -92,7 +242,15 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 			return
 	}}
 
-	// 2: attempt to retrieve all chirps from database
+	// 2: resolve who is asking so visibility rules can be applied
+
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 3: attempt to retrieve all chirps from database
 
 	dbChirps, err := cfg.DB.GetChirps()
 	if err != nil {
@@ -101,35 +259,68 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// 3: filter chirps into new slice which match the author_id
+	// 4: filter chirps into new slice which match the author_id and are visible to the reader
 
 	chirps := []Chirp{}
 	for _, dbChirp := range dbChirps {
-		if dbChirp.Author == authorID + 1 {
-			chirps = append(chirps, Chirp{
-			ID:     dbChirp.ID,
-			Body:   dbChirp.Body,
-			Author: dbChirp.Author,
-		})}
+		if user != "" && dbChirp.Author != authorID {
+			continue
+		}
+		if !reader.canSee(dbChirp) {
+			continue
+		}
+		// muted authors stay out of the timeline but can still be looked up directly
+		if user == "" && !reader.inTimeline(dbChirp) {
+			continue
+		}
+		chirps = append(chirps, newChirp(dbChirp, reader.ID))
 	}
 
-	// 4: if no matching chirps, successfully respond stating no chirps found
+	// 5: if no matching chirps, successfully respond stating no chirps found
 
 	if len(chirps) < 1 {
 		respondWithJSON(w, http.StatusOK, fmt.Sprintf("No chirps found for author $%v", authorID))
 		return
 	}
 
-	// 5: sort chirps by ID if matches were found
+	// 6: sort chirps by ID if matches were found, listing an author's pinned chirps first in pin order
+
+	pinned := map[int]int{}
+	if user != "" {
+		author, err := cfg.DB.GetSingleUser(authorID)
+		if err == nil {
+			for i, id := range author.Pinned {
+				pinned[id] = i
+			}
+		}
+	}
+	for i := range chirps {
+		_, chirps[i].Pinned = pinned[chirps[i].ID]
+	}
 
 	sort.Slice(chirps, func(i, j int) bool {
+		pi, iPinned := pinned[chirps[i].ID]
+		pj, jPinned := pinned[chirps[j].ID]
+		if iPinned || jPinned {
+			if iPinned && jPinned {
+				return pi < pj
+			}
+			return iPinned
+		}
 		if sortMethod == "desc" {
 			return chirps[i].ID > chirps[j].ID
 		}
 		return chirps[i].ID < chirps[j].ID
 	})
 
-	// 6: respond successfully with requested list of chirps
+	// 7: embed quoted originals then respond successfully with requested list of chirps
+
+	err = cfg.attachQuotes(chirps, reader)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cfg.recordViews(r, reader, chirps)
 
 	respondWithJSON(w, http.StatusOK, chirps)
 }
@@ -157,13 +348,28 @@ func (cfg *apiConfig) handlerGetSingleChirp(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// 3: successfully respond with requested chirp
+	// 3: chirps the caller is not allowed to see are reported as missing
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		Body:   chirp.Body,
-		ID:     chirp.ID,
-		Author: chirp.Author,
-	})
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reader.canSee(chirp) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	// 4: successfully respond with requested chirp
+
+	single := []Chirp{newChirp(chirp, reader.ID)}
+	err = cfg.attachQuotes(single, reader)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cfg.recordViews(r, reader, single)
+	respondWithJSON(w, http.StatusOK, single[0])
 }
 
 /* handlerDeleteChirp parses chirp ID from url parameters and attempts to delete from database */
@@ -190,63 +396,48 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 3: attempt to create the chirp in the database, if successful, return it, if not, return error
+	// 3: authors may delete their own chirps, moderators any chirp, which is recorded as a moderator decision
 
-	status, err := cfg.DB.DeleteChirp(id, subject)
+	chirp, err := cfg.DB.GetChirp(id)
 	if err != nil {
-		log.Println("API: Could not delete chirp")
-		respondWithError(w, status, err.Error())
+		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
-	respondWithJSON(w, http.StatusOK, "")
-}
-
-/* validateChirp receives the chirp body and ensures its length is below 140 characters
-any chirps exceeding 140 characters will be rejected with error "Chirp is too long"
-pre-defined profane words will be replaced before the chirp is added to the database */
-
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-
-	// 1: ensure the length of the body does not exceed the max chirp length, return an error if it does
-
-	if len(body) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+	grant, err := cfg.authorize(subject, auth.ActionDeleteChirp, auth.Resource{Owner: chirp.Author})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
 	}
-
-	// 2: define words to be filtered out of message
-
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	if grant.ByRole {
+		_, err = cfg.DB.ModerateChirp(id, subject, database.DecisionDelete, "")
+		if err != nil {
+			log.Println("API: Could not delete chirp as moderator")
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, "")
+		return
 	}
 
-	// 3: pass the body and badWords to getCleanedBody then return the result
+	// 4: attempt to delete the chirp from the database, if successful, return it, if not, return error
 
-	cleaned := getCleanedBody(body, badWords)
-	return cleaned, nil
-}
-
-// getCleanedBody iterates over each word in the chirp and replaces matching text with asterisks
-
-func getCleanedBody(body string, badWords map[string]struct{}) string {
-
-	// 1: separate the string delimited with whitespace
-
-	words := strings.Split(body, " ")
-
-	// 2: iterate over words and replace text matching badWords pattern
-
-	for i, word := range words {
-		loweredWord := strings.ToLower(word)
-		if _, ok := badWords[loweredWord]; ok {
-			words[i] = "****"
-		}
+	err = cfg.DB.DeleteChirp(id)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Println("API: Could not delete chirp")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
+	respondWithJSON(w, http.StatusOK, "")
+}
 
-	// 3: respond with the mutated text in the form of a string
+/* validateChirp runs the chirp body through the moderation pipeline
+chirps exceeding the configured length or matching a reject rule are refused,
+masked words are replaced and flag rules mark the chirp for review */
 
-	cleaned := strings.Join(words, " ")
-	return cleaned
+func (cfg *apiConfig) validateChirp(body string) (moderation.Result, error) {
+	return cfg.Moderator.Moderate(body)
 }
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const feedEntryLimit = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Published string   `xml:"published"`
+	Link      atomLink `xml:"link"`
+	Content   atomText `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// feedAuthor names an author by their display name and handle, falling back to their ID before a profile is set
+
+func feedAuthor(dbUser database.User) string {
+	switch {
+	case dbUser.DisplayName != "" && dbUser.Handle != "":
+		return fmt.Sprintf("%s (@%s)", dbUser.DisplayName, dbUser.Handle)
+	case dbUser.DisplayName != "":
+		return dbUser.DisplayName
+	case dbUser.Handle != "":
+		return "@" + dbUser.Handle
+	}
+	return fmt.Sprintf("user %d", dbUser.ID)
+}
+
+/* handlerUserFeeds dispatches /api/users/{userID}/feed.atom and feed.rss
+the feeds share one route so that /api/users/by-handle/{handle} stays the more specific pattern */
+
+func (cfg *apiConfig) handlerUserFeeds(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("feed") {
+	case "feed.atom":
+		cfg.handlerUserFeed("atom")(w, r)
+	case "feed.rss":
+		cfg.handlerUserFeed("rss")(w, r)
+	default:
+		respondWithError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// handlerUserFeed serves an author's public chirps as an Atom or RSS feed depending on the requested extension
+
+func (cfg *apiConfig) handlerUserFeed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// 1: parse the author from url parameters
+
+		userID, err := strconv.Atoi(r.PathValue("userID"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+			return
+		}
+		author, err := cfg.DB.GetSingleUser(userID)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		// 2: collect the author's chirps which an anonymous reader can see, newest first
+
+		dbChirps, err := cfg.DB.GetChirps()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		now := time.Now().UTC()
+		anonymous := viewer{}
+		chirps := []Chirp{}
+		lastModified := author.FeedChangedAt
+		for _, dbChirp := range dbChirps {
+			if dbChirp.Author != userID {
+				continue
+			}
+			// a chirp leaves the feed when it expires, before the reaper deletes it
+			if dbChirp.Expired(now) && dbChirp.ExpiresAt.After(lastModified) {
+				lastModified = *dbChirp.ExpiresAt
+			}
+			if !anonymous.canSee(dbChirp) {
+				continue
+			}
+			chirps = append(chirps, newChirp(dbChirp, 0))
+		}
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].ID > chirps[j].ID
+		})
+		if len(chirps) > feedEntryLimit {
+			chirps = chirps[:feedEntryLimit]
+		}
+
+		// 3: render the feed
+
+		updated := time.Unix(0, 0).UTC()
+		for _, chirp := range chirps {
+			if chirp.CreatedAt != nil && chirp.CreatedAt.After(updated) {
+				updated = *chirp.CreatedAt
+			}
+		}
+		if updated.After(lastModified) {
+			lastModified = updated
+		}
+
+		var dat []byte
+		contentType := ""
+		switch format {
+		case "atom":
+			dat, err = renderAtom(cfg.PublicURL, userID, feedAuthor(author), chirps, updated)
+			contentType = "application/atom+xml; charset=utf-8"
+		default:
+			dat, err = renderRSS(cfg.PublicURL, userID, feedAuthor(author), chirps, updated)
+			contentType = "application/rss+xml; charset=utf-8"
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		/* 4: let feed readers skip unchanged feeds with If-None-Match, or If-Modified-Since when no ETag is sent
+		Last-Modified is the newest of the author's FeedChangedAt, which creating, deleting and hiding chirps or editing the profile bump,
+		the latest expiry and the newest chirp, and is left out for authors whose feed hasn't changed since it started being tracked */
+
+		sum := sha256.Sum256(dat)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		lastModified = lastModified.Truncate(time.Second)
+		tracked := !author.FeedChangedAt.IsZero()
+		if tracked {
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		}
+
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			for _, candidate := range strings.Split(match, ",") {
+				candidate = strings.TrimSpace(candidate)
+				if candidate == etag || candidate == "*" || candidate == "W/"+etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
+		} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && tracked && !lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(dat)
+	}
+}
+
+func renderAtom(base string, userID int, author string, chirps []Chirp, updated time.Time) ([]byte, error) {
+	self := fmt.Sprintf("%s/api/users/%d/feed.atom", base, userID)
+	feed := atomFeed{
+		ID:      self,
+		Title:   "Chirps by " + author,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: fmt.Sprintf("%s/api/chirps?author_id=%d", base, userID), Rel: "alternate", Type: "application/json"},
+		},
+		Author:  atomAuthor{Name: author},
+		Entries: []atomEntry{},
+	}
+	for _, chirp := range chirps {
+		link := fmt.Sprintf("%s/api/chirps/%d", base, chirp.ID)
+		published := time.Unix(0, 0).UTC()
+		if chirp.CreatedAt != nil {
+			published = *chirp.CreatedAt
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        link,
+			Title:     feedTitle(chirp.Body),
+			Updated:   published.Format(time.RFC3339),
+			Published: published.Format(time.RFC3339),
+			Link:      atomLink{Href: link, Rel: "alternate"},
+			Content:   atomText{Type: "text", Body: chirp.Body},
+		})
+	}
+	return marshalFeed(feed)
+}
+
+func renderRSS(base string, userID int, author string, chirps []Chirp, updated time.Time) ([]byte, error) {
+	self := fmt.Sprintf("%s/api/users/%d/feed.rss", base, userID)
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         "Chirps by " + author,
+			Link:          fmt.Sprintf("%s/api/chirps?author_id=%d", base, userID),
+			Description:   "Public chirps posted by " + author,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Self:          atomLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+			Items:         []rssItem{},
+		},
+	}
+	for _, chirp := range chirps {
+		link := fmt.Sprintf("%s/api/chirps/%d", base, chirp.ID)
+		published := time.Unix(0, 0).UTC()
+		if chirp.CreatedAt != nil {
+			published = *chirp.CreatedAt
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       feedTitle(chirp.Body),
+			Link:        link,
+			Description: chirp.Body,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     published.Format(time.RFC1123Z),
+		})
+	}
+	return marshalFeed(feed)
+}
+
+func marshalFeed(feed interface{}) ([]byte, error) {
+	dat, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), dat...), nil
+}
+
+// feedTitle shortens a chirp body to use as an entry title
+
+func feedTitle(body string) string {
+	const maxTitleRunes = 50
+	runes := []rune(body)
+	if len(runes) <= maxTitleRunes {
+		return body
+	}
+	return string(runes[:maxTitleRunes]) + "…"
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func newFeedConfig(t *testing.T) (*apiConfig, *http.ServeMux, database.User) {
+	t.Helper()
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := store.CreateUser("author@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{DB: store, PublicURL: "https://chirpy.example"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/{userID}/{feed}", cfg.handlerUserFeeds)
+	return cfg, mux, author
+}
+
+func getFeed(mux *http.ServeMux, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	cfg, mux, author := newFeedConfig(t)
+	_, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const path = "/api/users/1/feed.atom"
+	first := getFeed(mux, path, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("status = %v, want 200", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	lastModified, err := http.ParseTime(first.Header().Get("Last-Modified"))
+	if etag == "" || err != nil {
+		t.Fatalf("ETag = %q, Last-Modified error = %v", etag, err)
+	}
+	stamp := func(t time.Time) string { return t.UTC().Format(http.TimeFormat) }
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "unconditional", want: http.StatusOK},
+		{name: "matching etag", header: http.Header{"If-None-Match": {etag}}, want: http.StatusNotModified},
+		{name: "weak etag in a list", header: http.Header{"If-None-Match": {`"other", W/` + etag}}, want: http.StatusNotModified},
+		{name: "stale etag", header: http.Header{"If-None-Match": {`"other"`}}, want: http.StatusOK},
+		{name: "not modified since", header: http.Header{"If-Modified-Since": {stamp(lastModified)}}, want: http.StatusNotModified},
+		{name: "modified since", header: http.Header{"If-Modified-Since": {stamp(lastModified.Add(-time.Second))}}, want: http.StatusOK},
+		{name: "etag wins over date", header: http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {stamp(lastModified)}}, want: http.StatusOK},
+		{name: "unparsable date", header: http.Header{"If-Modified-Since": {"yesterday"}}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getFeed(mux, path, tt.header)
+			if rec.Code != tt.want {
+				t.Errorf("status = %v, want %v", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedChangedAt(t *testing.T) {
+	cfg, _, author := newFeedConfig(t)
+	chirp, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changedAt := func() time.Time {
+		t.Helper()
+		dbUser, err := cfg.DB.GetSingleUser(author.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dbUser.FeedChangedAt
+	}
+
+	tests := []struct {
+		name   string
+		change func() error
+	}{
+		{name: "create", change: func() error {
+			_, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "third"})
+			return err
+		}},
+		{name: "hide", change: func() error {
+			_, err := cfg.DB.ModerateChirp(chirp.ID, 99, database.DecisionHide, "")
+			return err
+		}},
+		{name: "delete", change: func() error {
+			return cfg.DB.DeleteChirp(other.ID)
+		}},
+		{name: "profile", change: func() error {
+			_, err := cfg.DB.UpdateProfile(author.ID, database.Profile{Handle: "author", DisplayName: "Author"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := changedAt()
+			time.Sleep(time.Millisecond)
+			err := tt.change()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after := changedAt(); !after.After(before) {
+				t.Errorf("FeedChangedAt = %v, not after %v", after, before)
+			}
+		})
+	}
+}
+
+func TestFeedLastModifiedFollowsExpiry(t *testing.T) {
+	cfg, mux, author := newFeedConfig(t)
+	expiresAt := time.Now().UTC().Add(1100 * time.Millisecond)
+	_, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "fleeting", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const path = "/api/users/1/feed.rss"
+	before := getFeed(mux, path, nil)
+	if !strings.Contains(before.Body.String(), "fleeting") {
+		t.Fatal("chirp is missing from the feed before it expires")
+	}
+
+	// the reaper hasn't run, so only the expiry itself can move Last-Modified on
+	time.Sleep(time.Until(expiresAt) + 100*time.Millisecond)
+	after := getFeed(mux, path, http.Header{"If-Modified-Since": {before.Header().Get("Last-Modified")}})
+	if after.Code != http.StatusOK {
+		t.Fatalf("status = %v after the chirp expired, want 200", after.Code)
+	}
+	if strings.Contains(after.Body.String(), "fleeting") {
+		t.Error("expired chirp is still in the feed")
+	}
+}
@@ -2,13 +2,37 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
 )
 
+var errBadCredentials = errors.New("incorrect email or password")
+
+// clientIP is the address the connection came from; forwarding headers are ignored since clients can forge them
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// respondWithThrottled answers a request refused by a throttle, telling the client when to try again
+
+func respondWithThrottled(w http.ResponseWriter, wait time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	respondWithError(w, http.StatusTooManyRequests, msg)
+}
+
 // handlerUserLogin processes a login request containing username, password, jwt and jwt expiration
 // jwt information is optional, username and password are required
 
@@ -23,14 +47,6 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		ExpiresInSeconds *int64 `json:"expires_in_seconds,omitempty"`
 	}
 
-	type returnParams struct {
-		ID      int    `json:"id"`
-		Email   string `json:"email"`
-		Token   string `json:"token"`
-		Refresh string `json:"refresh_token"`
-		Premium bool   `json:"is_chirpy_red"`
-	}
-
 	// 1: attempt to decode json data from request object
 
 	decoder := json.NewDecoder(r.Body)
@@ -43,31 +59,95 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2: fetch user resource from database
+	// 2: reserve an attempt for the account and address, refusing while either is backing off after failures
+	// the reservation holds until the password check finishes, so parallel guesses can't slip past the backoff
+
+	now := time.Now()
+	accountKey := "account:" + strings.ToLower(params.Email)
+	ipKey := "ip:" + clientIP(r)
+	accountAttempt, wait := cfg.AccountThrottle.Begin(accountKey, now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many failed login attempts, try again later")
+		return
+	}
+	defer accountAttempt.Release()
+	ipAttempt, wait := cfg.IPThrottle.Begin(ipKey, now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many failed login attempts, try again later")
+		return
+	}
+	defer ipAttempt.Release()
+
+	// 3: fetch the user and validate the password, answering unknown emails and wrong passwords the same way
 
 	log.Print("API: Attempting to get user from Database")
 	dbUser, err := cfg.DB.GetUserByEmail(params.Email)
+	if err == nil {
+		log.Print("API: Attempting to validate password")
+		err = auth.CheckPasswords(params.Password, dbUser.Password)
+	} else {
+		auth.CheckDummyPassword(params.Password)
+	}
 	if err != nil {
-		log.Print("User not found")
-		respondWithError(w, http.StatusNotFound, err.Error())
+		log.Printf("API: Failed login for %q from %v", params.Email, clientIP(r))
+		if accountAttempt.Fail(now) {
+			log.Printf("API: Locked out %q after repeated failures", params.Email)
+		}
+		ipAttempt.Fail(now)
+		respondWithError(w, http.StatusUnauthorized, errBadCredentials.Error())
 		return
 	}
 
-	// 3: validate password via internal authorization package
+	// 4: suspended and banned accounts can't start sessions, which is only revealed once the password is right
 
-	log.Print("API: Attempting to validate password")
-	err = auth.CheckPasswords(params.Password, dbUser.Password)
+	err = accountStatus(dbUser, now)
 	if err != nil {
-		log.Print("Passwords do not match!")
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// 5: accounts with two-factor authentication get a challenge to exchange at /api/login/mfa instead of tokens
+	// the lockout counter keeps running until the second factor is passed
+
+	if dbUser.TOTPSecret != "" {
+		challenge, err := cfg.newMFAChallenge(dbUser.ID, now)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, mfaChallenge{
+			MFARequired: true,
+			MFAToken:    challenge,
+		})
 		return
 	}
+	accountAttempt.Succeed()
+
+	cfg.respondWithSession(w, dbUser, params.ExpiresInSeconds)
+}
+
+// respondWithSession issues an access and refresh token pair to a user who has fully authenticated
+
+func (cfg *apiConfig) respondWithSession(w http.ResponseWriter, dbUser database.User, expiresInSeconds *int64) {
+
+	type returnParams struct {
+		ID      int    `json:"id"`
+		Email   string `json:"email"`
+		Token   string `json:"token"`
+		Refresh string `json:"refresh_token"`
+		Premium bool   `json:"is_chirpy_red"`
+	}
 
-	// 4: create access token upon successful login
+	// 1: create access token, honouring a shorter requested lifetime
 
 	log.Println("API: Attempting to create access token")
+	lifetime, err := expiresIn(expiresInSeconds, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	now := time.Now()
-	token, err := cfg.generateUserToken(dbUser.ID, now.Add(time.Hour), "chirpy-access")
+	token, err := cfg.generateUserToken(dbUser.ID, userRole(dbUser), now.Add(lifetime), "chirpy-access")
 	log.Println("API: Generated token (access)")
 	if err != nil {
 		log.Print("Unable to generate access token")
@@ -75,17 +155,17 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 5: create refresh token upon successful login
+	// 2: create refresh token
 
 	log.Println("API: Attempting to create refresh token")
-	refresh, err := cfg.generateUserToken(dbUser.ID, now.Add(time.Hour*24*60), "chirpy-refresh")
+	refresh, err := cfg.generateUserToken(dbUser.ID, "", now.Add(time.Hour*24*60), "chirpy-refresh")
 	if err != nil {
 		log.Println("Unable to generate refresh token")
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// 6: save token to database
+	// 3: save token to database
 
 	_, err = cfg.DB.CreateToken(refresh, dbUser.ID)
 	if err != nil {
@@ -95,7 +175,7 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Println("API: Token generated (refresh)")
 
-	// 7: if all is well, respond with the user's tokens
+	// 4: if all is well, respond with the user's tokens
 
 	respondWithJSON(w, http.StatusOK, returnParams{
 		ID:      dbUser.ID,
@@ -105,3 +185,22 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		Premium: dbUser.Premium,
 	})
 }
+
+// handlerUnlockUser runs behind requireRole(auth.RoleAdmin) and lets an admin clear the failed login attempts of an account before its lockout ends
+
+func (cfg *apiConfig) handlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	dbUser, err := cfg.DB.GetSingleUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	cfg.AccountThrottle.Reset("account:" + strings.ToLower(dbUser.Email))
+	log.Printf("API: Unlocked logins for user %v", userID)
+	respondWithJSON(w, http.StatusOK, nil)
+}
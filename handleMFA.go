@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mfaChallengeLifetime = 5 * time.Minute
+	mfaIssuer            = "Chirpy"
+	recoveryCodeCount    = 10
+)
+
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+/* newMFAChallenge issues the token handlerLoginMFA exchanges for a session once the second factor is passed
+its jti is stored on the user, so a challenge completes a single login and a newer login replaces it */
+
+func (cfg *apiConfig) newMFAChallenge(userID int, now time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	_, err = cfg.DB.SetMFAChallenge(userID, hex.EncodeToString(nonce))
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy-mfa",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeLifetime)),
+		Subject:   strconv.Itoa(userID),
+		ID:        hex.EncodeToString(nonce),
+	}).SignedString([]byte(cfg.JWTSecret))
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code, consuming whichever was used
+
+func (cfg *apiConfig) checkSecondFactor(dbUser database.User, code string, recoveryCode string) error {
+	if dbUser.TOTPSecret == "" {
+		return database.ErrMFANotActive
+	}
+	if recoveryCode != "" {
+		return cfg.DB.UseRecoveryCode(dbUser.ID, auth.HashRecoveryCode(recoveryCode))
+	}
+	step, ok := auth.ValidateTOTP(dbUser.TOTPSecret, code, time.Now())
+	if !ok {
+		return database.ErrInvalidCode
+	}
+	return cfg.DB.UseTOTPStep(dbUser.ID, step)
+}
+
+// handlerEnrollTOTP starts enrollment by generating a secret and the otpauth URI to show as a QR code
+
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if dbUser.TOTPSecret != "" {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, err = cfg.DB.SetPendingTOTP(subject, secret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret: secret,
+		URI:    auth.TOTPURI(mfaIssuer, dbUser.Email, secret),
+	})
+}
+
+// handlerConfirmTOTP enables two-factor authentication once the user proves their app generates codes, returning recovery codes
+
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	// 1: validate token and decode the code
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+
+	// 2: check the code against the pending secret
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if dbUser.TOTPPending == "" {
+		respondWithError(w, http.StatusConflict, "start enrollment before confirming it")
+		return
+	}
+	step, ok := auth.ValidateTOTP(dbUser.TOTPPending, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, database.ErrInvalidCode.Error())
+		return
+	}
+
+	// 3: activate the secret with a fresh set of recovery codes, which are only ever shown here
+
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, err = cfg.DB.EnableTOTP(subject, step, hashes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Enabled two-factor authentication for user %v", subject)
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+// handlerDisableTOTP turns two-factor authentication off, which needs a current code or a recovery code
+
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	err = cfg.checkSecondFactor(dbUser, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = cfg.DB.DisableTOTP(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Disabled two-factor authentication for user %v", subject)
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+/* handlerLoginMFA exchanges the challenge token from handlerUserLogin and a TOTP or recovery code for
+access and refresh tokens, failures count towards the same lockout as wrong passwords
+and the challenge is used up by the first login it completes */
+
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken         string `json:"mfa_token"`
+		Code             string `json:"code"`
+		RecoveryCode     string `json:"recovery_code"`
+		ExpiresInSeconds *int64 `json:"expires_in_seconds,omitempty"`
+	}
+
+	// 1: decode parameters and validate the challenge token
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+	subject, err := cfg.validateToken("Bearer "+params.MFAToken, "chirpy-mfa")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "challenge is invalid or has expired, log in again")
+		return
+	}
+	claims, err := cfg.tokenClaims("Bearer " + params.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "challenge is invalid or has expired, log in again")
+		return
+	}
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "challenge is invalid or has expired, log in again")
+		return
+	}
+	// a used or replaced challenge is refused before any code is checked, so it can't burn recovery codes
+	if claims.ID == "" || claims.ID != dbUser.MFAChallenge {
+		respondWithError(w, http.StatusUnauthorized, "challenge is invalid or has expired, log in again")
+		return
+	}
+
+	// 2: respect the account lockout
+
+	now := time.Now()
+	accountKey := "account:" + strings.ToLower(dbUser.Email)
+	attempt, wait := cfg.AccountThrottle.Begin(accountKey, now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many failed login attempts, try again later")
+		return
+	}
+	defer attempt.Release()
+
+	// 3: check the second factor
+
+	err = cfg.checkSecondFactor(dbUser, params.Code, params.RecoveryCode)
+	if errors.Is(err, database.ErrInvalidCode) || errors.Is(err, database.ErrCodeReused) || errors.Is(err, database.ErrMFANotActive) {
+		log.Printf("API: Failed second factor for user %v from %v", dbUser.ID, clientIP(r))
+		attempt.Fail(now)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	attempt.Succeed()
+
+	// 4: use up the challenge, which fails if a parallel request completed a login with it first
+
+	err = cfg.DB.ConsumeMFAChallenge(dbUser.ID, claims.ID)
+	if errors.Is(err, database.ErrInvalidChallenge) {
+		respondWithError(w, http.StatusUnauthorized, "challenge is invalid or has expired, log in again")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 5: suspended and banned accounts can't start sessions, even when that happened after the challenge was issued
+
+	err = accountStatus(dbUser, now)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// 6: issue the session
+
+	cfg.respondWithSession(w, dbUser, params.ExpiresInSeconds)
+}
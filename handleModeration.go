@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// reportReasons lists the reasons a user may give when reporting a chirp
+
+var reportReasons = map[string]struct{}{
+	"spam":       {},
+	"abuse":      {},
+	"harassment": {},
+	"hate":       {},
+	"other":      {},
+}
+
+// hasRole looks up the user's current role, for decisions made outside handlers wrapped by requireRole
+
+func (cfg *apiConfig) hasRole(userID int, role auth.Role) bool {
+	dbUser, err := cfg.DB.GetSingleUser(userID)
+	if err != nil {
+		return false
+	}
+	return userRole(dbUser).AtLeast(role)
+}
+
+// handlerReportChirp lets an authenticated user report a chirp for review by a moderator
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	// 1: parse chirp ID from url parameters
+
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	// 2: validate the reporter's access token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 3: decode and validate the report reason
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters while reporting chirp")
+		return
+	}
+	if _, ok := reportReasons[params.Reason]; !ok {
+		respondWithError(w, http.StatusBadRequest, "Report reason must be one of spam, abuse, harassment, hate or other")
+		return
+	}
+
+	// 4: only chirps the reporter can see may be reported, so reports can't probe for hidden chirps
+
+	chirp, err := cfg.DB.GetChirp(id)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reader.canSee(chirp) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	// 5: save the report
+
+	report, err := cfg.DB.CreateReport(id, subject, params.Reason, params.Details)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyReported) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, report)
+}
+
+// handlerModerationQueue lists chirps which were auto-flagged or reported, most reported first
+
+func (cfg *apiConfig) handlerModerationQueue(w http.ResponseWriter, r *http.Request) {
+	type queueItem struct {
+		Chirp       Chirp             `json:"chirp"`
+		FlagReasons []string          `json:"flag_reasons,omitempty"`
+		Reports     []database.Report `json:"reports"`
+	}
+
+	moderator := principalFrom(r).ID
+
+	dbQueue, err := cfg.DB.GetModerationQueue()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	queue := []queueItem{}
+	for _, item := range dbQueue {
+		reports := item.Reports
+		if reports == nil {
+			reports = []database.Report{}
+		}
+		queue = append(queue, queueItem{
+			Chirp:       newChirp(item.Chirp, moderator),
+			FlagReasons: item.Chirp.FlagReasons,
+			Reports:     reports,
+		})
+	}
+
+	sort.Slice(queue, func(i, j int) bool {
+		if len(queue[i].Reports) != len(queue[j].Reports) {
+			return len(queue[i].Reports) > len(queue[j].Reports)
+		}
+		return queue[i].Chirp.ID < queue[j].Chirp.ID
+	})
+
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+// handlerModerateChirp applies a moderator's hide, delete or dismiss decision to a chirp
+
+func (cfg *apiConfig) handlerModerateChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+
+	moderator := principalFrom(r).ID
+
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters while moderating chirp")
+		return
+	}
+
+	switch params.Action {
+	case database.DecisionHide, database.DecisionDelete, database.DecisionDismiss:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Action must be one of hide, delete or dismiss")
+		return
+	}
+
+	decision, err := cfg.DB.ModerateChirp(id, moderator, params.Action, params.Note)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, decision)
+}
+
+// handlerModerationDecisions returns the record of every moderator decision, newest first
+
+func (cfg *apiConfig) handlerModerationDecisions(w http.ResponseWriter, r *http.Request) {
+	decisions, err := cfg.DB.GetDecisions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].ID > decisions[j].ID
+	})
+
+	respondWithJSON(w, http.StatusOK, decisions)
+}
+
+// handlerReloadModeration re-reads the moderation config so word lists can change without a restart
+
+func (cfg *apiConfig) handlerReloadModeration(w http.ResponseWriter, r *http.Request) {
+	err := cfg.Moderator.Reload()
+	if err != nil {
+		log.Println("API: Could not reload moderation rules")
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
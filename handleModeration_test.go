@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestReportChirp(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	reporter := newTestUser(t, cfg, "reporter@example.com", "")
+	bystander := newTestUser(t, cfg, "bystander@example.com", "")
+	_, err := cfg.DB.CreateFollow(reporter.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(chirp database.Chirp) int {
+		t.Helper()
+		if chirp.Author == 0 {
+			chirp.Author = author.ID
+		}
+		chirp.Body = "reported"
+		chirp, err := cfg.DB.CreateChirp(chirp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID
+	}
+	public := create(database.Chirp{})
+	followed := create(database.Chirp{Visibility: database.VisibilityFollowers})
+	notFollowed := create(database.Chirp{Author: bystander.ID, Visibility: database.VisibilityFollowers})
+	toReporter := create(database.Chirp{Visibility: database.VisibilityDirect, Recipients: []int{reporter.ID}})
+	toBystander := create(database.Chirp{Visibility: database.VisibilityDirect, Recipients: []int{bystander.ID}})
+	hidden := create(database.Chirp{})
+	_, err = cfg.DB.ModerateChirp(hidden, 99, database.DecisionHide, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", cfg.handlerReportChirp)
+	token := bearer(t, cfg, reporter)
+
+	// the cases run in order, so the second report of the public chirp is a duplicate
+	tests := []struct {
+		name          string
+		chirpID       int
+		authorization string
+		body          string
+		want          int
+	}{
+		{name: "no token", chirpID: public, want: http.StatusUnauthorized},
+		{name: "unknown reason", chirpID: public, authorization: token, body: `{"reason": "boring"}`, want: http.StatusBadRequest},
+		{name: "missing chirp", chirpID: 404, authorization: token, want: http.StatusNotFound},
+		{name: "public chirp", chirpID: public, authorization: token, want: http.StatusCreated},
+		{name: "duplicate report", chirpID: public, authorization: token, want: http.StatusConflict},
+		{name: "followers-only chirp of a followed user", chirpID: followed, authorization: token, want: http.StatusCreated},
+		{name: "followers-only chirp of another user", chirpID: notFollowed, authorization: token, want: http.StatusNotFound},
+		{name: "direct chirp to the reporter", chirpID: toReporter, authorization: token, want: http.StatusCreated},
+		{name: "direct chirp to someone else", chirpID: toBystander, authorization: token, want: http.StatusNotFound},
+		{name: "hidden chirp", chirpID: hidden, authorization: token, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body := tt.body
+		if body == "" {
+			body = `{"reason": "spam"}`
+		}
+		rec := serve(mux, http.MethodPost, fmt.Sprintf("/api/chirps/%d/report", tt.chirpID), tt.authorization, body)
+		if rec.Code != tt.want {
+			t.Errorf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	// refused reports never reach the moderation queue
+	queue, err := cfg.DB.GetModerationQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := map[int]bool{}
+	for _, item := range queue {
+		reported[item.Chirp.ID] = true
+	}
+	if len(reported) != 3 || !reported[public] || !reported[followed] || !reported[toReporter] {
+		t.Errorf("queued chirps = %v, want %v, %v and %v", reported, public, followed, toReporter)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/mail"
+)
+
+const passwordResetLifetime = time.Hour
+
+// hashResetToken is what gets stored for a reset token; the token itself only ever exists in the email
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+/* handlerForgotPassword emails a single-use reset token to the address if it belongs to an account
+the response is the same whether or not the account exists so it can't be used to discover users */
+
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	// 1: decode parameters
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil || params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	// 2: count the request against the address and the client, so nobody can flood an inbox with reset emails
+	// the limit applies whether or not the account exists, so hitting it reveals nothing either
+
+	now := time.Now()
+	emailAttempt, wait := cfg.ResetThrottle.Begin("reset:"+strings.ToLower(params.Email), now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many password reset requests, try again later")
+		return
+	}
+	defer emailAttempt.Release()
+	ipAttempt, wait := cfg.ResetIPThrottle.Begin("reset-ip:"+clientIP(r), now)
+	if wait > 0 {
+		respondWithThrottled(w, wait, "too many password reset requests, try again later")
+		return
+	}
+	emailAttempt.Fail(now)
+	ipAttempt.Fail(now)
+
+	// 3: send the email in the background so response times don't reveal whether the account exists
+
+	dbUser, err := cfg.DB.GetUserByEmail(params.Email)
+	if err == nil {
+		go cfg.sendPasswordReset(dbUser)
+	} else if !errors.Is(err, database.ErrNotExist) {
+		log.Printf("API: Could not look up user for password reset: %v", err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "if an account uses that address, a reset token has been sent to it",
+	})
+}
+
+func (cfg *apiConfig) sendPasswordReset(dbUser database.User) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		log.Printf("API: Could not generate password reset token: %v", err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err = cfg.DB.CreatePasswordReset(dbUser.ID, hashResetToken(token), time.Now().Add(passwordResetLifetime))
+	if err != nil {
+		log.Printf("API: Could not store password reset for user %v: %v", dbUser.ID, err)
+		return
+	}
+
+	err = cfg.Mailer.Send(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"To choose a new password, send this token to %s/api/password/reset within %d minutes:\n\n%s\n\n"+
+			"It can only be used once. If you did not ask for a reset you can ignore this email.\n",
+			cfg.PublicURL, int(passwordResetLifetime.Minutes()), token),
+	})
+	if err != nil {
+		log.Printf("API: Could not send password reset email to user %v: %v", dbUser.ID, err)
+	}
+}
+
+// handlerResetPassword sets a new password using an emailed reset token and signs the user out everywhere
+
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	// 1: decode parameters
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil || params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "token and password are required")
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "token and password are required")
+		return
+	}
+
+	// 2: look the token up so the new password can be checked against the account's email
+
+	tokenHash := hashResetToken(params.Token)
+	dbUser, err := cfg.DB.GetPasswordReset(tokenHash, time.Now())
+	if errors.Is(err, database.ErrInvalidReset) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !cfg.checkPassword(w, params.Password, dbUser.Email) {
+		return
+	}
+
+	// 3: hash the new password then consume the token
+
+	pw, err := auth.EncryptPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not encrypt new password")
+		return
+	}
+
+	_, err = cfg.DB.ResetPassword(tokenHash, pw, time.Now())
+	if errors.Is(err, database.ErrInvalidReset) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, nil)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// resetToken waits for the newest password reset email sent to the address and returns the token in it
+
+func resetToken(t *testing.T, mailer *outbox, to string, sent int) string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		mailer.mu.Lock()
+		messages := []string{}
+		for _, msg := range mailer.messages {
+			if msg.To == to {
+				messages = append(messages, msg.Body)
+			}
+		}
+		mailer.mu.Unlock()
+		if len(messages) >= sent {
+			fields := strings.Fields(messages[sent-1])
+			for i, field := range fields {
+				if field == "minutes:" && i+1 < len(fields) {
+					return fields[i+1]
+				}
+			}
+			t.Fatalf("no token in %q", messages[sent-1])
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v reset emails were sent to %v, want %v", len(messages), to, sent)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.ResetThrottle = auth.NewThrottle(auth.ThrottleConfig{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 10, LockoutFor: time.Hour, ForgetAfter: time.Hour})
+	cfg.ResetIPThrottle = auth.NewThrottle(auth.ThrottleConfig{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 1000, LockoutFor: time.Hour, ForgetAfter: time.Hour})
+	mailer := cfg.Mailer.(*outbox)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	handler := http.HandlerFunc(cfg.handlerForgotPassword)
+
+	// the cases run in order, so the per-address limit builds up across them
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "no email", body: `{}`, want: http.StatusBadRequest},
+		{name: "existing account", body: `{"email": "user@example.com"}`, want: http.StatusAccepted},
+		{name: "unknown account looks the same", body: `{"email": "nobody@example.com"}`, want: http.StatusAccepted},
+		{name: "existing account in another case", body: `{"email": "USER@example.com"}`, want: http.StatusAccepted},
+		{name: "address throttled", body: `{"email": "user@example.com"}`, want: http.StatusTooManyRequests},
+		{name: "unknown address throttled the same", body: `{"email": "nobody@example.com"}`, want: http.StatusAccepted},
+		{name: "unknown address throttled the same again", body: `{"email": "nobody@example.com"}`, want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		rec := serve(handler, http.MethodPost, "/api/password/forgot", "", tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if tt.want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%v: no Retry-After header", tt.name)
+		}
+	}
+
+	resetToken(t, mailer, user.Email, 2)
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	for _, msg := range mailer.messages {
+		if msg.To != user.Email {
+			t.Errorf("reset email sent to %v", msg.To)
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	cfg := newTestConfig(t)
+	mailer := cfg.Mailer.(*outbox)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	_, err := cfg.DB.CreateToken("refresh", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.sendPasswordReset(user)
+	superseded := resetToken(t, mailer, user.Email, 1)
+	cfg.sendPasswordReset(user)
+	token := resetToken(t, mailer, user.Email, 2)
+	expired := "expired-token"
+	err = cfg.DB.CreatePasswordReset(newTestUser(t, cfg, "other@example.com", "").ID, hashResetToken(expired), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const password = "Correct-Horse-9"
+	handler := http.HandlerFunc(cfg.handlerResetPassword)
+
+	// the cases run in order, so the token is consumed by the first successful reset
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "no token", body: `{"password": "` + password + `"}`, want: http.StatusBadRequest},
+		{name: "no password", body: `{"token": "` + token + `"}`, want: http.StatusBadRequest},
+		{name: "unknown token", body: `{"token": "nope", "password": "` + password + `"}`, want: http.StatusBadRequest},
+		{name: "superseded token", body: `{"token": "` + superseded + `", "password": "` + password + `"}`, want: http.StatusBadRequest},
+		{name: "expired token", body: `{"token": "` + expired + `", "password": "` + password + `"}`, want: http.StatusBadRequest},
+		{name: "weak password keeps the token", body: `{"token": "` + token + `", "password": "short"}`, want: http.StatusBadRequest},
+		{name: "reset", body: `{"token": "` + token + `", "password": "` + password + `"}`, want: http.StatusOK},
+		{name: "token used twice", body: `{"token": "` + token + `", "password": "Another-Horse-9"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := serve(handler, http.MethodPost, "/api/password/reset", "", tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.CheckPasswords(password, dbUser.Password); err != nil {
+		t.Errorf("new password doesn't match: %v", err)
+	}
+	if _, err := cfg.DB.GetToken("refresh"); err == nil {
+		t.Error("refresh token survived the reset")
+	}
+	if _, err := cfg.DB.GetPasswordReset(hashResetToken(token), time.Now()); !errors.Is(err, database.ErrInvalidReset) {
+		t.Errorf("GetPasswordReset() after the reset error = %v, want ErrInvalidReset", err)
+	}
+}
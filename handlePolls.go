@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const (
+	minPollOptions  = 2
+	maxPollOptions  = 4
+	maxPollDuration = 7 * 24 * time.Hour
+)
+
+type pollParameters struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+type Poll struct {
+	Options     []PollOption `json:"options"`
+	ClosesAt    time.Time    `json:"closes_at"`
+	Closed      bool         `json:"closed"`
+	TotalVotes  *int         `json:"total_votes,omitempty"`
+	VotedOption *int         `json:"voted_option,omitempty"`
+}
+
+/* newPoll renders a poll for viewerID
+tallies are only included once the viewer has voted, the poll has closed or the viewer is the author */
+
+func newPoll(dbChirp database.Chirp, viewerID int) *Poll {
+	if dbChirp.Poll == nil {
+		return nil
+	}
+
+	dbPoll := dbChirp.Poll
+	poll := &Poll{
+		Options:  []PollOption{},
+		ClosesAt: dbPoll.ClosesAt,
+		Closed:   dbPoll.Closed(time.Now()),
+	}
+
+	showResults := poll.Closed || (viewerID != 0 && dbChirp.Author == viewerID)
+	if option, ok := dbPoll.Votes[viewerID]; ok && viewerID != 0 {
+		poll.VotedOption = &option
+		showResults = true
+	}
+
+	tally := dbPoll.Tally()
+	total := 0
+	for i, text := range dbPoll.Options {
+		option := PollOption{Text: text}
+		if showResults {
+			votes := tally[i]
+			option.Votes = &votes
+			total += votes
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	if showResults {
+		poll.TotalVotes = &total
+	}
+	return poll
+}
+
+// validatePoll checks the option count and closing time, and runs each option through moderation
+
+func (cfg *apiConfig) validatePoll(params *pollParameters) (*database.Poll, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	if len(params.Options) < minPollOptions || len(params.Options) > maxPollOptions {
+		return nil, errors.New("Polls must have between 2 and 4 options")
+	}
+
+	options := []string{}
+	for _, option := range params.Options {
+		if strings.TrimSpace(option) == "" {
+			return nil, errors.New("Poll options can't be empty")
+		}
+		moderated, err := cfg.validateChirp(option)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, moderated.Body)
+	}
+
+	now := time.Now()
+	if !params.ClosesAt.After(now) {
+		return nil, errors.New("Poll closing time must be in the future")
+	}
+	if params.ClosesAt.Sub(now) > maxPollDuration {
+		return nil, errors.New("Polls can stay open for at most 7 days")
+	}
+
+	return &database.Poll{
+		Options:  options,
+		ClosesAt: params.ClosesAt.UTC(),
+		Votes:    map[int]int{},
+	}, nil
+}
+
+// handlerVotePoll casts the caller's single vote on the poll attached to a chirp
+
+func (cfg *apiConfig) handlerVotePoll(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Option *int `json:"option"`
+	}
+
+	// 1: parse chirp ID from url parameters
+
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	// 2: validate the voter's access token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// 3: decode the chosen option
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil || params.Option == nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode option while voting")
+		return
+	}
+
+	// 4: voters must be able to see the chirp
+
+	chirp, err := cfg.DB.GetChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reader.canSee(chirp) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	// 5: record the vote and respond with the updated tallies
+
+	chirp, err = cfg.DB.Vote(id, subject, *params.Option)
+	switch {
+	case errors.Is(err, database.ErrNoPoll), errors.Is(err, database.ErrNotExist):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, database.ErrInvalidOption):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, database.ErrPollClosed), errors.Is(err, database.ErrAlreadyVoted):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newChirp(chirp, subject))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestValidatePoll(t *testing.T) {
+	cfg := newTestConfig(t)
+	soon := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		params  *pollParameters
+		want    []string
+		wantErr bool
+	}{
+		{name: "no poll"},
+		{name: "two options", params: &pollParameters{Options: []string{"yes", "no"}, ClosesAt: soon}, want: []string{"yes", "no"}},
+		{name: "four options", params: &pollParameters{Options: []string{"a", "b", "c", "d"}, ClosesAt: soon}, want: []string{"a", "b", "c", "d"}},
+		{name: "options are moderated", params: &pollParameters{Options: []string{"kerfuffle", "calm"}, ClosesAt: soon}, want: []string{"****", "calm"}},
+		{name: "one option", params: &pollParameters{Options: []string{"yes"}, ClosesAt: soon}, wantErr: true},
+		{name: "five options", params: &pollParameters{Options: []string{"a", "b", "c", "d", "e"}, ClosesAt: soon}, wantErr: true},
+		{name: "blank option", params: &pollParameters{Options: []string{"yes", "  "}, ClosesAt: soon}, wantErr: true},
+		{name: "option too long", params: &pollParameters{Options: []string{"yes", strings.Repeat("a", 141)}, ClosesAt: soon}, wantErr: true},
+		{name: "already closed", params: &pollParameters{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(-time.Minute)}, wantErr: true},
+		{name: "no closing time", params: &pollParameters{Options: []string{"yes", "no"}}, wantErr: true},
+		{name: "open too long", params: &pollParameters{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(maxPollDuration + time.Hour)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poll, err := cfg.validatePoll(tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validatePoll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr || tt.params == nil {
+				if poll != nil {
+					t.Errorf("validatePoll() = %+v, want nil", poll)
+				}
+				return
+			}
+			if fmt.Sprint(poll.Options) != fmt.Sprint(tt.want) || len(poll.Votes) != 0 {
+				t.Errorf("validatePoll() = %+v, want options %v and no votes", poll, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPoll(t *testing.T) {
+	const author, voter, stranger = 1, 2, 3
+	open := &database.Poll{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(time.Hour), Votes: map[int]int{voter: 1, 4: 1, 5: 0}}
+	closed := &database.Poll{Options: open.Options, ClosesAt: time.Now().Add(-time.Hour), Votes: open.Votes}
+
+	tests := []struct {
+		name      string
+		poll      *database.Poll
+		viewer    int
+		want      string
+		wantVoted string
+	}{
+		{name: "stranger on an open poll", poll: open, viewer: stranger, want: "hidden", wantVoted: "none"},
+		{name: "anonymous on an open poll", poll: open, viewer: 0, want: "hidden", wantVoted: "none"},
+		{name: "voter on an open poll", poll: open, viewer: voter, want: "1,2 of 3", wantVoted: "1"},
+		{name: "author on an open poll", poll: open, viewer: author, want: "1,2 of 3", wantVoted: "none"},
+		{name: "anonymous on a closed poll", poll: closed, viewer: 0, want: "1,2 of 3", wantVoted: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poll := newPoll(database.Chirp{Author: author, Poll: tt.poll}, tt.viewer)
+			got := "hidden"
+			if poll.TotalVotes != nil {
+				got = fmt.Sprintf("%v,%v of %v", *poll.Options[0].Votes, *poll.Options[1].Votes, *poll.TotalVotes)
+			} else if poll.Options[0].Votes != nil {
+				got = "options shown without a total"
+			}
+			if got != tt.want {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+			voted := "none"
+			if poll.VotedOption != nil {
+				voted = fmt.Sprint(*poll.VotedOption)
+			}
+			if voted != tt.wantVoted {
+				t.Errorf("voted option = %v, want %v", voted, tt.wantVoted)
+			}
+			if poll.Closed != (tt.poll == closed) {
+				t.Errorf("closed = %v", poll.Closed)
+			}
+		})
+	}
+
+	if newPoll(database.Chirp{Author: author}, voter) != nil {
+		t.Error("newPoll() of a chirp without a poll is not nil")
+	}
+}
+
+func TestVotePoll(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	voter := newTestUser(t, cfg, "voter@example.com", "")
+	poll := &database.Poll{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(time.Hour), Votes: map[int]int{}}
+	chirp, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "question", Poll: poll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "secret question", Poll: poll, Visibility: database.VisibilityFollowers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "no question"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps/{chirpID}/vote", cfg.handlerVotePoll)
+	token := bearer(t, cfg, voter)
+	vote := func(id int) string { return fmt.Sprintf("/api/chirps/%d/vote", id) }
+
+	// the cases run in order against the same voter
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		body          string
+		want          int
+	}{
+		{name: "no token", path: vote(chirp.ID), body: `{"option": 0}`, want: http.StatusUnauthorized},
+		{name: "no option", path: vote(chirp.ID), authorization: token, body: `{}`, want: http.StatusBadRequest},
+		{name: "option out of range", path: vote(chirp.ID), authorization: token, body: `{"option": 2}`, want: http.StatusBadRequest},
+		{name: "chirp without a poll", path: vote(plain.ID), authorization: token, body: `{"option": 0}`, want: http.StatusNotFound},
+		{name: "chirp the voter can't see", path: vote(private.ID), authorization: token, body: `{"option": 0}`, want: http.StatusNotFound},
+		{name: "vote", path: vote(chirp.ID), authorization: token, body: `{"option": 1}`, want: http.StatusOK},
+		{name: "vote again", path: vote(chirp.ID), authorization: token, body: `{"option": 0}`, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, http.MethodPost, tt.path, tt.authorization, tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		got := Chirp{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Poll == nil || got.Poll.TotalVotes == nil || *got.Poll.TotalVotes != 1 || *got.Poll.Options[1].Votes != 1 || *got.Poll.VotedOption != 1 {
+			t.Errorf("%v: poll = %+v, want the voter's tally", tt.name, got.Poll)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+const (
+	avatarPath         = "/avatars/"
+	maxAvatarBytes     = 1 << 20
+	maxAvatarDimension = 1024
+	maxDisplayNameLen  = 50
+	maxBioLen          = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles can't be claimed because they would be confused with routes or staff accounts
+
+var reservedHandles = map[string]struct{}{
+	"admin":     {},
+	"api":       {},
+	"app":       {},
+	"by-handle": {},
+	"me":        {},
+	"support":   {},
+}
+
+var avatarExtensions = map[string]string{
+	"png":  ".png",
+	"jpeg": ".jpg",
+	"gif":  ".gif",
+}
+
+// validateProfile checks the handle format and the length of the free text fields
+
+func validateProfile(profile database.Profile) error {
+	if profile.Handle != "" {
+		if !handlePattern.MatchString(profile.Handle) {
+			return errors.New("handle must be 3 to 30 letters, digits or underscores")
+		}
+		if _, ok := reservedHandles[strings.ToLower(profile.Handle)]; ok {
+			return errors.New("handle is reserved")
+		}
+	}
+	if utf8.RuneCountInString(profile.DisplayName) > maxDisplayNameLen {
+		return errors.New("display name is too long")
+	}
+	if utf8.RuneCountInString(profile.Bio) > maxBioLen {
+		return errors.New("bio is too long")
+	}
+	return nil
+}
+
+/* handlerUpdateProfile changes the caller's handle, display name and bio
+fields left out of the request keep their current value, credentials are changed through PUT /api/users */
+
+func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+	}
+
+	// 1: validate token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	_, err = cfg.authorize(subject, auth.ActionUpdateUser, auth.Resource{Owner: subject})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	// 2: decode parameters and merge them into the current profile
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	profile := database.Profile{
+		Handle:      dbUser.Handle,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+	}
+	if params.Handle != nil {
+		profile.Handle = strings.TrimPrefix(strings.TrimSpace(*params.Handle), "@")
+	}
+	if params.DisplayName != nil {
+		profile.DisplayName = strings.TrimSpace(*params.DisplayName)
+	}
+	if params.Bio != nil {
+		profile.Bio = strings.TrimSpace(*params.Bio)
+	}
+
+	// 3: validate and save the profile
+
+	err = validateProfile(profile)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbUser, err = cfg.DB.UpdateProfile(subject, profile)
+	if errors.Is(err, database.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(dbUser, subject))
+}
+
+// handlerGetUserByHandle looks a user up by handle, ignoring case and an optional leading @
+
+func (cfg *apiConfig) handlerGetUserByHandle(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimPrefix(r.PathValue("handle"), "@")
+	dbUser, err := cfg.DB.GetUserByHandle(handle)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(dbUser, cfg.optionalSubject(r)))
+}
+
+/* handlerUploadAvatar stores a PNG, JPEG or GIF sent as the avatar field of a multipart form
+the image is checked by decoding its header rather than trusting the declared content type */
+
+func (cfg *apiConfig) handlerUploadAvatar(w http.ResponseWriter, r *http.Request) {
+
+	// 1: validate token
+
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	_, err = cfg.authorize(subject, auth.ActionUpdateUser, auth.Resource{Owner: subject})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	// 2: read the uploaded file, refusing anything over the size limit
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+4096)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "avatar must be uploaded as the avatar field of a multipart form under 1MB")
+		return
+	}
+	defer file.Close()
+
+	dat, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(dat) > maxAvatarBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "avatar must be under 1MB")
+		return
+	}
+
+	// 3: make sure it is an image we accept
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(dat))
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, "avatar must be a PNG, JPEG or GIF image")
+		return
+	}
+	ext, ok := avatarExtensions[format]
+	if !ok {
+		respondWithError(w, http.StatusUnsupportedMediaType, "avatar must be a PNG, JPEG or GIF image")
+		return
+	}
+	if config.Width > maxAvatarDimension || config.Height > maxAvatarDimension {
+		respondWithError(w, http.StatusBadRequest, "avatar must be at most 1024x1024 pixels")
+		return
+	}
+
+	// 4: write it under a random name so cached copies of the old avatar are never served for the new one
+
+	suffix := make([]byte, 8)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := hex.EncodeToString(suffix) + ext
+
+	err = os.MkdirAll(cfg.AvatarDir, 0755)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = os.WriteFile(filepath.Join(cfg.AvatarDir, name), dat, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	dbUser, previous, err := cfg.DB.SetAvatar(subject, name)
+	if err != nil {
+		os.Remove(filepath.Join(cfg.AvatarDir, name))
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if previous != "" {
+		err = os.Remove(filepath.Join(cfg.AvatarDir, previous))
+		if err != nil {
+			log.Printf("API: Could not remove old avatar %v: %v", previous, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(dbUser, subject))
+}
+
+// handlerGetAvatar serves a stored avatar without exposing a listing of the avatar directory
+
+func (cfg *apiConfig) handlerGetAvatar(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.PathValue("file"))
+	path := filepath.Join(cfg.AvatarDir, name)
+	if _, err := os.Stat(path); err != nil {
+		respondWithError(w, http.StatusNotFound, "avatar not found")
+		return
+	}
+	// the cors middleware defaults every response to html
+	w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(name)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile database.Profile
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "full", profile: database.Profile{Handle: "chirp_er42", DisplayName: "Chirper", Bio: "hello"}},
+		{name: "shortest handle", profile: database.Profile{Handle: "abc"}},
+		{name: "longest handle", profile: database.Profile{Handle: strings.Repeat("a", 30)}},
+		{name: "handle too short", profile: database.Profile{Handle: "ab"}, wantErr: true},
+		{name: "handle too long", profile: database.Profile{Handle: strings.Repeat("a", 31)}, wantErr: true},
+		{name: "handle with punctuation", profile: database.Profile{Handle: "chirp.er"}, wantErr: true},
+		{name: "reserved handle", profile: database.Profile{Handle: "Admin"}, wantErr: true},
+		{name: "longest display name", profile: database.Profile{DisplayName: strings.Repeat("\u00e9", maxDisplayNameLen)}},
+		{name: "display name too long", profile: database.Profile{DisplayName: strings.Repeat("a", maxDisplayNameLen+1)}, wantErr: true},
+		{name: "bio too long", profile: database.Profile{Bio: strings.Repeat("a", maxBioLen+1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileEndpoint(t *testing.T) {
+	cfg := newTestConfig(t)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	other := newTestUser(t, cfg, "other@example.com", "")
+	_, err := cfg.DB.UpdateProfile(other.ID, database.Profile{Handle: "taken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/users/me/profile", cfg.handlerUpdateProfile)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", cfg.handlerGetUserByHandle)
+	token := bearer(t, cfg, user)
+
+	// the cases run in order, so fields left out keep the value set by an earlier case
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		want          int
+		wantUser      User
+	}{
+		{name: "no token", body: `{"handle": "chirper"}`, want: http.StatusUnauthorized},
+		{name: "set everything", authorization: token, body: `{"handle": " @chirper ", "display_name": " Chirper ", "bio": "hello"}`, want: http.StatusOK, wantUser: User{Handle: "chirper", DisplayName: "Chirper", Bio: "hello"}},
+		{name: "change only the bio", authorization: token, body: `{"bio": "updated"}`, want: http.StatusOK, wantUser: User{Handle: "chirper", DisplayName: "Chirper", Bio: "updated"}},
+		{name: "clear the display name", authorization: token, body: `{"display_name": ""}`, want: http.StatusOK, wantUser: User{Handle: "chirper", Bio: "updated"}},
+		{name: "handle taken in another case", authorization: token, body: `{"handle": "TAKEN"}`, want: http.StatusConflict},
+		{name: "invalid handle", authorization: token, body: `{"handle": "no spaces"}`, want: http.StatusBadRequest},
+		{name: "malformed", authorization: token, body: `{`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, http.MethodPut, "/api/users/me/profile", tt.authorization, tt.body)
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		got := User{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Handle != tt.wantUser.Handle || got.DisplayName != tt.wantUser.DisplayName || got.Bio != tt.wantUser.Bio || got.Email != user.Email {
+			t.Errorf("%v: profile = %+v, want %+v", tt.name, got, tt.wantUser)
+		}
+	}
+
+	lookups := []struct {
+		path string
+		want int
+	}{
+		{path: "/api/users/by-handle/chirper", want: user.ID},
+		{path: "/api/users/by-handle/@Chirper", want: user.ID},
+		{path: "/api/users/by-handle/taken", want: other.ID},
+		{path: "/api/users/by-handle/nobody"},
+	}
+	for _, lookup := range lookups {
+		rec := serve(mux, http.MethodGet, lookup.path, "", "")
+		got := User{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		if got.ID != lookup.want || (lookup.want == 0 && rec.Code != http.StatusNotFound) {
+			t.Errorf("GET %v = %v %s", lookup.path, rec.Code, rec.Body)
+		}
+		if got.Email != "" {
+			t.Errorf("GET %v showed the email to an anonymous caller", lookup.path)
+		}
+	}
+}
+
+// avatarUpload builds a multipart avatar upload request holding dat
+
+func avatarUpload(t *testing.T, authorization string, dat []byte) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = part.Write(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = form.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPut, "/api/users/me/avatar", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", authorization)
+	return req
+}
+
+func encodePNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadAvatar(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.AvatarDir = t.TempDir()
+	user := newTestUser(t, cfg, "user@example.com", "")
+	token := bearer(t, cfg, user)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/users/me/avatar", cfg.handlerUploadAvatar)
+	mux.HandleFunc("GET /avatars/{file}", cfg.handlerGetAvatar)
+
+	// the cases run in order, so each accepted upload replaces the one before
+	tests := []struct {
+		name string
+		dat  []byte
+		want int
+	}{
+		{name: "png", dat: encodePNG(t, 64, 64), want: http.StatusOK},
+		{name: "replacement", dat: encodePNG(t, maxAvatarDimension, maxAvatarDimension), want: http.StatusOK},
+		{name: "not an image", dat: []byte("<svg onload=alert(1)>"), want: http.StatusUnsupportedMediaType},
+		{name: "too wide", dat: encodePNG(t, maxAvatarDimension+1, 1), want: http.StatusBadRequest},
+		{name: "too large", dat: append(encodePNG(t, 1, 1), make([]byte, maxAvatarBytes)...), want: http.StatusRequestEntityTooLarge},
+	}
+	avatarURL := ""
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, avatarUpload(t, token, tt.dat))
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		got := User{}
+		err := json.Unmarshal(rec.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got.AvatarURL, avatarPath) || !strings.HasSuffix(got.AvatarURL, ".png") || got.AvatarURL == avatarURL {
+			t.Errorf("%v: avatar_url = %q after %q", tt.name, got.AvatarURL, avatarURL)
+		}
+		avatarURL = got.AvatarURL
+	}
+
+	// only the latest avatar is kept and served
+	files, err := os.ReadDir(cfg.AvatarDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || avatarPath+files[0].Name() != avatarURL {
+		t.Errorf("stored avatars = %v, want only %v", files, avatarURL)
+	}
+	rec := serve(mux, http.MethodGet, avatarURL, "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("GET %v = %v with headers %v", avatarURL, rec.Code, rec.Header())
+	}
+
+	err = os.WriteFile(filepath.Join(filepath.Dir(cfg.AvatarDir), "secret.txt"), []byte("secret"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/avatars/missing.png", "/avatars/..%2fsecret.txt"} {
+		if rec := serve(mux, http.MethodGet, path, "", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %v = %v, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// QuotedChirp is the embedded snapshot of a quoted chirp; originals that were deleted or can't be seen are marked unavailable
+
+type QuotedChirp struct {
+	ID          int    `json:"id"`
+	Body        string `json:"body,omitempty"`
+	Author      *User  `json:"author,omitempty"`
+	Unavailable bool   `json:"unavailable,omitempty"`
+}
+
+// attachQuotes embeds the quoted original into every chirp which quotes another, as seen by reader
+
+func (cfg *apiConfig) attachQuotes(chirps []Chirp, reader viewer) error {
+	ids := []int{}
+	for _, chirp := range chirps {
+		if chirp.QuoteOf != 0 {
+			ids = append(ids, chirp.QuoteOf)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	originals, authors, err := cfg.DB.GetQuoted(ids)
+	if err != nil {
+		return err
+	}
+
+	present := cfg.presenterFor(reader.ID)
+	for i := range chirps {
+		if chirps[i].QuoteOf == 0 {
+			continue
+		}
+		quoted := &QuotedChirp{ID: chirps[i].QuoteOf}
+		original, ok := originals[chirps[i].QuoteOf]
+		if !ok || !reader.canSee(original) {
+			quoted.Unavailable = true
+			chirps[i].Quoted = quoted
+			continue
+		}
+		quoted.Body = original.Body
+		if author, ok := authors[original.Author]; ok {
+			user := present.present(author)
+			quoted.Author = &user
+		}
+		chirps[i].Quoted = quoted
+	}
+	return nil
+}
+
+// handlerGetQuotes lists the chirps quoting a chirp, newest first
+
+func (cfg *apiConfig) handlerGetQuotes(w http.ResponseWriter, r *http.Request) {
+
+	// 1: parse chirp ID from url parameters
+
+	id, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Chirp ID must be numeric")
+		return
+	}
+
+	// 2: the original must exist and be visible to the caller
+
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	original, err := cfg.DB.GetChirp(id)
+	if err != nil || !reader.canSee(original) {
+		respondWithError(w, http.StatusNotFound, database.ErrNotExist.Error())
+		return
+	}
+
+	// 3: collect the visible quotes, leaving out muted authors like any other timeline
+
+	dbQuotes, err := cfg.DB.GetQuotes(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	quotes := []Chirp{}
+	for _, dbQuote := range dbQuotes {
+		if !reader.inTimeline(dbQuote) {
+			continue
+		}
+		quotes = append(quotes, newChirp(dbQuote, reader.ID))
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[i].ID > quotes[j].ID
+	})
+
+	// 4: paginate and embed the original
+
+	start, end, err := parsePagination(r, len(quotes))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	quotes = quotes[start:end]
+
+	err = cfg.attachQuotes(quotes, reader)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cfg.recordViews(r, reader, quotes)
+
+	respondWithJSON(w, http.StatusOK, quotes)
+}
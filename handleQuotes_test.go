@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestAttachQuotes(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	follower := newTestUser(t, cfg, "follower@example.com", "")
+	stranger := newTestUser(t, cfg, "stranger@example.com", "")
+	_, err := cfg.DB.CreateFollow(follower.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(chirp database.Chirp) int {
+		t.Helper()
+		chirp.Author = author.ID
+		chirp.Body = "original"
+		chirp, err := cfg.DB.CreateChirp(chirp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID
+	}
+	public := create(database.Chirp{})
+	followers := create(database.Chirp{Visibility: database.VisibilityFollowers})
+	deleted := create(database.Chirp{})
+	hidden := create(database.Chirp{})
+	err = cfg.DB.DeleteChirp(deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.ModerateChirp(hidden, 99, database.DecisionHide, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		quoteOf int
+		reader  int
+		want    string
+	}{
+		{name: "not a quote", reader: stranger.ID, want: "none"},
+		{name: "public original", quoteOf: public, reader: stranger.ID, want: "original"},
+		{name: "public original read anonymously", quoteOf: public, want: "original"},
+		{name: "followers-only original read by a follower", quoteOf: followers, reader: follower.ID, want: "original"},
+		{name: "followers-only original read by a stranger", quoteOf: followers, reader: stranger.ID, want: "unavailable"},
+		{name: "deleted original", quoteOf: deleted, reader: stranger.ID, want: "unavailable"},
+		{name: "hidden original", quoteOf: hidden, reader: stranger.ID, want: "unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := cfg.viewerFor(tt.reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirps := []Chirp{{ID: 100, Body: "quote", QuoteOf: tt.quoteOf}}
+			err = cfg.attachQuotes(chirps, reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			quoted := chirps[0].Quoted
+			got := "none"
+			switch {
+			case quoted == nil:
+			case quoted.Unavailable:
+				got = "unavailable"
+				if quoted.ID != tt.quoteOf || quoted.Body != "" || quoted.Author != nil {
+					t.Errorf("unavailable quote leaks the original: %+v", quoted)
+				}
+			default:
+				got = quoted.Body
+				if quoted.ID != tt.quoteOf || quoted.Author == nil || quoted.Author.ID != author.ID {
+					t.Errorf("quoted = %+v, want the original with its author", quoted)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("quoted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareQuote(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	quoter := newTestUser(t, cfg, "quoter@example.com", "")
+	public, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "public"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "private", Visibility: database.VisibilityFollowers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := cfg.viewerFor(quoter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		quoteOf int
+		wantErr bool
+	}{
+		{name: "visible original", quoteOf: public.ID},
+		{name: "original the quoter can't see", quoteOf: private.ID, wantErr: true},
+		{name: "missing original", quoteOf: 404, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chirp, err := cfg.prepareChirp(chirpParameters{Body: "quoting", QuoteOf: tt.quoteOf}, quoter.ID, reader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareChirp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && chirp.QuoteOf != tt.quoteOf {
+				t.Errorf("quote_of = %v, want %v", chirp.QuoteOf, tt.quoteOf)
+			}
+		})
+	}
+}
+
+func TestGetQuotes(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	quoter := newTestUser(t, cfg, "quoter@example.com", "")
+	original, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "original"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := cfg.DB.CreateChirp(database.Chirp{Author: author.ID, Body: "private", Visibility: database.VisibilityFollowers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotes := []int{}
+	for _, visibility := range []string{database.VisibilityPublic, database.VisibilityFollowers, database.VisibilityPublic} {
+		quote, err := cfg.DB.CreateChirp(database.Chirp{Author: quoter.ID, Body: "quote", QuoteOf: original.ID, Visibility: visibility})
+		if err != nil {
+			t.Fatal(err)
+		}
+		quotes = append(quotes, quote.ID)
+	}
+	_, err = cfg.DB.CreateChirp(database.Chirp{Author: quoter.ID, Body: "unrelated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}/quotes", cfg.handlerGetQuotes)
+	path := fmt.Sprintf("/api/chirps/%d/quotes", original.ID)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          []int
+		wantStatus    int
+	}{
+		{name: "anonymous", path: path, want: []int{quotes[2], quotes[0]}, wantStatus: http.StatusOK},
+		{name: "the quoter", path: path, authorization: bearer(t, cfg, quoter), want: []int{quotes[2], quotes[1], quotes[0]}, wantStatus: http.StatusOK},
+		{name: "paginated", path: path + "?per_page=1&page=2", want: []int{quotes[0]}, wantStatus: http.StatusOK},
+		{name: "original the caller can't see", path: fmt.Sprintf("/api/chirps/%d/quotes", private.ID), wantStatus: http.StatusNotFound},
+		{name: "missing original", path: "/api/chirps/404/quotes", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mux, http.MethodGet, tt.path, tt.authorization, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := chirpIDs(t, rec.Body.Bytes()); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("quotes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+/* handlerSetRole runs behind requireRole(auth.RoleAdmin) and changes another user's role
+the new role applies to that user's next request, since requireRole and authorize read roles from the database */
+
+func (cfg *apiConfig) handlerSetRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	// 1: parse the user and the requested role
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
+	}
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "could not decode parameters")
+		return
+	}
+	role, ok := auth.ParseRole(params.Role)
+	if !ok || params.Role == "" {
+		respondWithError(w, http.StatusBadRequest, "role must be one of user, moderator or admin")
+		return
+	}
+
+	// 2: admins can't change their own role, so the last admin can't lock everyone out by accident
+
+	caller := principalFrom(r)
+	if caller.ID == userID {
+		respondWithError(w, http.StatusBadRequest, "you can't change your own role")
+		return
+	}
+	_, err = cfg.authorize(caller.ID, auth.ActionSetRole, auth.Resource{Owner: userID})
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	dbUser, err := cfg.DB.SetRole(userID, string(role))
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("API: Admin %v set the role of user %v to %v", caller.ID, userID, role)
+	respondWithJSON(w, http.StatusOK, caller.presenter().present(dbUser))
+}
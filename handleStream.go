@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/events"
+)
+
+const (
+	streamReplaySize     = 500
+	streamBufferSize     = 64
+	streamHeartbeatEvery = 15 * time.Second
+)
+
+// publishChange forwards committed chirp changes from the database to stream subscribers and notifications
+
+func (cfg *apiConfig) publishChange(change database.Change) {
+	cfg.Events.Publish(change)
+	if change.Type == database.ChangeChirpCreated {
+		cfg.notifyChirpCreated(change.Chirp)
+	}
+}
+
+// hashtags returns the lowercased tags in a chirp body without their leading #
+
+func hashtags(body string) []string {
+	tags := []string{}
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := strings.TrimRightFunc(strings.TrimPrefix(word, "#"), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+		})
+		if tag != "" {
+			tags = append(tags, strings.ToLower(tag))
+		}
+	}
+	return tags
+}
+
+// streamFilter narrows a stream to one author and/or one hashtag
+
+type streamFilter struct {
+	author  int
+	hashtag string
+}
+
+func (f streamFilter) matches(chirp database.Chirp) bool {
+	if f.author != 0 && chirp.Author != f.author {
+		return false
+	}
+	if f.hashtag == "" {
+		return true
+	}
+	for _, tag := range hashtags(chirp.Body) {
+		if tag == f.hashtag {
+			return true
+		}
+	}
+	return false
+}
+
+// streamVisible decides whether an event reaches the reader; deletions are sent for chirps the reader could see before they went away
+// streams are timelines, so muted authors are left out too
+
+func streamVisible(reader viewer, event events.Event) bool {
+	chirp := event.Chirp
+	if event.Type == database.ChangeChirpDeleted {
+		chirp.Hidden = false
+		chirp.ExpiresAt = nil
+	}
+	return reader.inTimeline(chirp)
+}
+
+/* handlerStream pushes chirp.created and chirp.deleted events over Server-Sent Events
+clients resume with Last-Event-ID, receive heartbeats while idle, and are disconnected if they fall too far behind */
+
+func (cfg *apiConfig) handlerStream(w http.ResponseWriter, r *http.Request) {
+
+	// 1: parse filters and the optional resume point
+
+	q := r.URL.Query()
+	filter := streamFilter{
+		hashtag: strings.ToLower(strings.TrimPrefix(q.Get("hashtag"), "#")),
+	}
+	if author := q.Get("author_id"); author != "" {
+		id, err := strconv.Atoi(author)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Author ID must be numeric")
+			return
+		}
+		filter.author = id
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = q.Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Last-Event-ID must be numeric")
+			return
+		}
+		lastID = parsed
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	// 2: resolve who is listening so visibility rules can be applied
+
+	reader, err := cfg.loadViewer(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 3: subscribe before writing anything so no event is missed between replay and live delivery
+
+	replay, complete, sub := cfg.Events.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+
+	send := func(event events.Event) error {
+		if !filter.matches(event.Chirp) || !streamVisible(reader, event) {
+			return nil
+		}
+		var payload interface{} = newChirp(event.Chirp, reader.ID)
+		if event.Type == database.ChangeChirpDeleted {
+			payload = map[string]int{"id": event.Chirp.ID}
+		}
+		dat, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, dat)
+		return err
+	}
+
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	// 4: relay live events with heartbeats until the client leaves or falls behind
+
+	heartbeat := time.NewTicker(streamHeartbeatEvery)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			// pick up follows, blocks and mutes made while the stream is open
+			if fresh, err := cfg.viewerFor(reader.ID); err == nil {
+				reader = fresh
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				log.Println("API: Dropping slow stream subscriber")
+				fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
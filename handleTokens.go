@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/clinto-bean/golang-servers/internal/auth"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -39,7 +40,16 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := cfg.generateUserToken(userid, time.Now().Add(time.Hour), "chirpy-access")
+	// the role is read again so promotions and demotions take effect on the next refresh
+
+	dbUser, err := cfg.DB.GetSingleUser(userid)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	token, err := cfg.generateUserToken(userid, userRole(dbUser), time.Now().Add(time.Hour), "chirpy-access")
 
 	if err != nil {
 		log.Println("couldn't generate token")
@@ -73,15 +83,43 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, nil)
 }
 
-func (cfg *apiConfig) generateUserToken(userid int, expiration time.Time, issuer string) (string, error) {
+// expiresIn validates an optional expires_in_seconds parameter, falling back to limit when it is unset
+
+func expiresIn(seconds *int64, limit time.Duration) (time.Duration, error) {
+	if seconds == nil {
+		return limit, nil
+	}
+	if *seconds <= 0 {
+		return 0, errors.New("expires_in_seconds must be positive")
+	}
+	d := time.Duration(*seconds) * time.Second
+	if d > limit {
+		return limit, nil
+	}
+	return d, nil
+}
+
+// userClaims are the claims of every token chirpy issues, Role is only set on access tokens
+// and Impersonator only on access tokens an admin was issued to act as another user
+
+type userClaims struct {
+	Role         string `json:"role,omitempty"`
+	Impersonator int    `json:"impersonator,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (cfg *apiConfig) generateUserToken(userid int, role auth.Role, expiration time.Time, issuer string) (string, error) {
 
 	now := jwt.NewNumericDate(time.Now())
 	exp := jwt.NewNumericDate(expiration)
-	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    issuer,
-		IssuedAt:  now,
-		ExpiresAt: exp,
-		Subject:   strconv.Itoa(userid),
+	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims{
+		Role: string(role),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  now,
+			ExpiresAt: exp,
+			Subject:   strconv.Itoa(userid),
+		},
 	})
 	t, err := tkn.SignedString([]byte(cfg.JWTSecret))
 	if err != nil {
@@ -133,6 +171,15 @@ func (cfg *apiConfig) validateToken(arg string, issuerName string) (int, error)
 			return 0, err
 		}
 
+		// sessions end as soon as an account is suspended, banned or deleted
+
+		if issuer == "chirpy-access" || issuer == "chirpy-refresh" {
+			err = cfg.checkAccount(convertedSubject)
+			if err != nil {
+				return 0, err
+			}
+		}
+
 		return convertedSubject, nil
 
 	} else {
@@ -140,3 +187,40 @@ func (cfg *apiConfig) validateToken(arg string, issuerName string) (int, error)
 		return 0, errors.New("token is invalid or expired")
 	}
 }
+
+// tokenClaims returns the claims of a token that already passed validateToken
+
+func (cfg *apiConfig) tokenClaims(arg string) (userClaims, error) {
+	claims := userClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(arg, "Bearer "), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
+	})
+	return claims, err
+}
+
+// tokenExpiry returns when a token that already passed validateToken expires
+
+func (cfg *apiConfig) tokenExpiry(arg string) (time.Time, error) {
+	claims, err := cfg.tokenClaims(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if claims.ExpiresAt == nil {
+		return time.Time{}, errors.New("token has no expiration")
+	}
+	return claims.ExpiresAt.Time, nil
+}
+
+// optionalSubject returns the user ID of a valid access token on the request, or 0 for anonymous callers
+
+func (cfg *apiConfig) optionalSubject(r *http.Request) int {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return 0
+	}
+	subject, err := cfg.validateToken(authorization, "chirpy-access")
+	if err != nil {
+		return 0
+	}
+	return subject
+}
@@ -4,18 +4,62 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	netmail "net/mail"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
 )
 
+// User is serialized through marshalVisible, so a user built without presentUser only shows public fields
+
 type User struct {
-	Email   string `json:"email"`
-	Premium bool   `json:"is_chirpy_red"`
-	ID      int    `json:"id"`
+	Email       string `json:"email" visible:"owner"`
+	Premium     bool   `json:"is_chirpy_red" visible:"owner"`
+	Verified    bool   `json:"is_verified" visible:"owner"`
+	Role        string `json:"role" visible:"owner"`
+	ID          int    `json:"id"`
+	Handle      string `json:"handle,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	// SuspendedUntil, Banned and SuspensionReason are only shown to admins
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty" visible:"admin"`
+	Banned           bool       `json:"is_banned,omitempty" visible:"admin"`
+	SuspensionReason string     `json:"suspension_reason,omitempty" visible:"admin"`
+	audience         audience
+}
+
+func (u User) MarshalJSON() ([]byte, error) {
+	return marshalVisible(u, u.audience)
+}
+
+// newUser converts a database user to its API representation, leaving out credentials
+
+func newUser(dbUser database.User) User {
+	user := User{
+		Email:       dbUser.Email,
+		Premium:     dbUser.Premium,
+		Verified:    !dbUser.Unverified,
+		Role:        string(userRole(dbUser)),
+		ID:          dbUser.ID,
+		Handle:      dbUser.Handle,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+
+		SuspendedUntil:   dbUser.SuspendedUntil,
+		Banned:           dbUser.Banned,
+		SuspensionReason: dbUser.SuspensionReason,
+	}
+	if dbUser.Avatar != "" {
+		user.AvatarURL = avatarPath + dbUser.Avatar
+	}
+	return user
 }
 
 // handleCreateUsers attempts to create the user entry in the database and notifies requester of any issues processing
@@ -43,11 +87,15 @@ func (cfg *apiConfig) handleCreateUsers(w http.ResponseWriter, r *http.Request)
 
 	e, err := validateEmail(email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// 3: encrypt user password
+	// 3: check the password against the policy then encrypt it
+
+	if !cfg.checkPassword(w, password, e) {
+		return
+	}
 
 	p, err := auth.EncryptPassword(password)
 	if err != nil {
@@ -55,28 +103,59 @@ func (cfg *apiConfig) handleCreateUsers(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 4: create database entry for user
+	// 4: create database entry for user along with the key their ActivityPub actor signs with
 
-	user, err := cfg.DB.CreateUser(e, p, false)
+	key, err := newActorKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user, err := cfg.DB.CreateUser(e, p, false, key)
+	if errors.Is(err, database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// 5: successfully respond with the newly created user object
+	// 5: new accounts start unverified, a failed send can be retried through the resend endpoint
 
-	respondWithJSON(w, http.StatusCreated, User{
-		Email:   user.Email,
-		Premium: user.Premium,
-		ID:      user.ID,
-	})
+	err = cfg.sendVerification(user)
+	if err != nil {
+		log.Printf("API: Could not send verification email to user %v: %v", user.ID, err)
+	}
+
+	// 6: successfully respond with the newly created user object
+
+	respondWithJSON(w, http.StatusCreated, cfg.presentUser(user, user.ID))
+
+}
+
+// checkPassword applies the password policy, responding with the violations and returning false if it fails
 
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password string, email string) bool {
+	err := cfg.PasswordPolicy.Check(password, email)
+	policyErr := &auth.PolicyError{}
+	if errors.As(err, &policyErr) {
+		respondWithPolicyError(w, policyErr)
+		return false
+	}
+	return true
 }
 
 func validateEmail(email string) (string, error) {
 
 	// 1: validate whether email meets required format, return empty string and error if it does not, or simply the email and nil error if it does
+	// the address must be a bare addr-spec (no display name) with a dotted domain
 
-	if !strings.Contains(email, "@") {
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("please enter a valid email")
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
 		return "", errors.New("please enter a valid email")
 	}
 	return email, nil
@@ -92,20 +171,18 @@ func (cfg *apiConfig) handlerGetAllUsers(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		fmt.Print("unable to run cfg.DB.GetUsers()")
 		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// 2: initialize new slice of users
+	// 2: initialize new slice of users, showing private fields only to their owner and admins
 
 	users := []User{}
+	present := cfg.presenterFor(cfg.optionalSubject(r))
 
 	// 3: iterate over dbUsers and append each user to the users slice
 
 	for _, user := range dbUsers {
-		users = append(users, User{
-			ID:      user.ID,
-			Premium: user.Premium,
-			Email:   user.Email,
-		})
+		users = append(users, present.present(user))
 	}
 
 	// 4: sort users by ascending id then return the list of users
@@ -121,22 +198,24 @@ func (cfg *apiConfig) handlerGetAllUsers(w http.ResponseWriter, r *http.Request)
 func (cfg *apiConfig) handlerGetSingleUser(w http.ResponseWriter, r *http.Request) {
 	userID := r.PathValue("userID")
 	id, err := strconv.Atoi(userID)
-	if err != nil && userID != "" {
+	if err != nil {
 		fmt.Print("could not convert user ID")
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusBadRequest, "User ID must be numeric")
+		return
 	}
 
 	user, err := cfg.DB.GetSingleUser(id)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
 	if err != nil {
 		fmt.Print("unable to locate user by id")
 		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, User{
-		Email:   user.Email,
-		ID:      user.ID,
-		Premium: user.Premium,
-	})
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(user, cfg.optionalSubject(r)))
 }
 
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -163,6 +242,35 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
+	if cfg.impersonating(r) {
+		respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+		return
+	}
+
+	_, err = cfg.authorize(userid, auth.ActionUpdateUser, auth.Resource{Owner: userid})
+
+	if err != nil {
+		respondWithAuthorizeError(w, err)
+		return
+	}
+
+	email, err := validateEmail(params.Email)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before, err := cfg.DB.GetSingleUser(userid)
+
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if !cfg.checkPassword(w, params.Password, email) {
+		return
+	}
 
 	pw, err := auth.EncryptPassword(params.Password)
 
@@ -171,17 +279,26 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	u, err := cfg.DB.UpdateUser(userid, params.Email, pw, false)
+	u, err := cfg.DB.UpdateUser(userid, email, pw)
 
+	if errors.Is(err, database.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error occurred while updating user")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, User{
-		Email:   u.Email,
-		Premium: u.Premium,
-		ID:      u.ID,
-	})
+	// a changed address goes back to unverified until the new one is confirmed
+
+	if !strings.EqualFold(u.Email, before.Email) {
+		err = cfg.sendVerification(u)
+		if err != nil {
+			log.Printf("API: Could not send verification email to user %v: %v", u.ID, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(u, userid))
 
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/mail"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const verificationLifetime = 24 * time.Hour
+
+/* sendVerification mails the user a signed link to confirm their address
+the link carries a nonce stored on the user so it works once and only the newest link is accepted */
+
+func (cfg *apiConfig) sendVerification(dbUser database.User) error {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.DB.SetVerificationNonce(dbUser.ID, hex.EncodeToString(nonce))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy-verify",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(verificationLifetime)),
+		Subject:   strconv.Itoa(dbUser.ID),
+		ID:        hex.EncodeToString(nonce),
+	}).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		return err
+	}
+
+	link := cfg.PublicURL + "/api/users/verify?token=" + url.QueryEscape(token)
+	return cfg.Mailer.Send(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address by opening the link below within %d hours:\n\n%s\n\nIf you did not sign up for Chirpy you can ignore this email.\n",
+			int(verificationLifetime.Hours()), link),
+	})
+}
+
+// handlerVerifyEmail consumes a verification link
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	// 1: check the signature, issuer and expiry of the token
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(r.URL.Query().Get("token"), &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
+	}, jwt.WithIssuer("chirpy-verify"), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, database.ErrInvalidVerification.Error())
+		return
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, database.ErrInvalidVerification.Error())
+		return
+	}
+
+	// 2: consume the nonce, which fails for used or superseded links
+
+	dbUser, err := cfg.DB.VerifyEmail(userID, claims.ID)
+	if errors.Is(err, database.ErrInvalidVerification) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.presentUser(dbUser, dbUser.ID))
+}
+
+// handlerResendVerification sends a fresh verification link to the caller, invalidating earlier ones
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	subject, err := cfg.validateToken(r.Header.Get("Authorization"), "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	dbUser, err := cfg.DB.GetSingleUser(subject)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if !dbUser.Unverified {
+		respondWithError(w, http.StatusConflict, "email is already verified")
+		return
+	}
+
+	err = cfg.sendVerification(dbUser)
+	if err != nil {
+		log.Printf("API: Could not send verification email to user %v: %v", subject, err)
+		respondWithError(w, http.StatusBadGateway, "could not send verification email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, nil)
+}
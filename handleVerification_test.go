@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// verifyPath turns a mailed verification link into a request path
+
+func verifyPath(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.RequestURI()
+}
+
+func TestVerifyEmailEndpoint(t *testing.T) {
+	cfg := newTestConfig(t)
+	mailer := cfg.Mailer.(*outbox)
+	user, err := cfg.DB.CreateUser("user@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/verify", cfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", cfg.handlerResendVerification)
+	mux.HandleFunc("POST /api/chirps", cfg.handlerChirpsCreate)
+	token := bearer(t, cfg, user)
+
+	err = cfg.sendVerification(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := mailer.link(t, user.Email)
+	if !strings.HasPrefix(first, cfg.PublicURL+"/api/users/verify?token=") {
+		t.Fatalf("link = %q", first)
+	}
+
+	// unverified accounts can't chirp yet
+	if rec := serve(mux, http.MethodPost, "/api/chirps", token, `{"body": "hello"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("chirping before verifying = %v, want 403", rec.Code)
+	}
+
+	// a resend supersedes the first link
+	if rec := serve(mux, http.MethodPost, "/api/users/verify/resend", token, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("resend = %v, want 202", rec.Code)
+	}
+	second := mailer.link(t, user.Email)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy-verify",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		Subject:   strconv.Itoa(user.ID),
+	}).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same user
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "no token", path: "/api/users/verify", want: http.StatusBadRequest},
+		{name: "access token", path: "/api/users/verify?token=" + strings.TrimPrefix(token, "Bearer "), want: http.StatusBadRequest},
+		{name: "expired link", path: "/api/users/verify?token=" + expired, want: http.StatusBadRequest},
+		{name: "superseded link", path: verifyPath(t, first), want: http.StatusBadRequest},
+		{name: "newest link", path: verifyPath(t, second), want: http.StatusOK},
+		{name: "link used twice", path: verifyPath(t, second), want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, http.MethodGet, tt.path, "", "")
+		if rec.Code != tt.want {
+			t.Fatalf("%v: status = %v, want %v: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	if rec := serve(mux, http.MethodPost, "/api/users/verify/resend", token, ""); rec.Code != http.StatusConflict {
+		t.Errorf("resend once verified = %v, want 409", rec.Code)
+	}
+	if rec := serve(mux, http.MethodPost, "/api/chirps", token, `{"body": "hello"}`); rec.Code != http.StatusCreated {
+		t.Errorf("chirping once verified = %v, want 201: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/events"
+)
+
+const (
+	wsPingEvery        = 30 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsWriteWait        = 10 * time.Second
+	wsMaxMessageSize   = 4096
+	wsNotificationSize = 32
+	wsMaxChannels      = 50
+
+	// wsCloseTokenExpired is sent when the access token the socket was opened with expires
+	wsCloseTokenExpired = 4001
+	// wsCloseAccountDisabled is sent when the account is suspended, banned or deleted while the socket is open
+	wsCloseAccountDisabled = 4003
+
+	// wsProtocol is the subprotocol the server answers with; browsers offer it along with wsTokenProtocol+token
+	wsProtocol      = "chirpy"
+	wsTokenProtocol = "chirpy.bearer."
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// only wsProtocol is ever echoed back, so the token offered next to it never appears in the response
+	Subprotocols: []string{wsProtocol},
+	// sockets authenticate with a bearer token rather than cookies, so any origin may connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+/* wsAuthorization returns the access token of a socket request from the Authorization header or, for browsers
+which can't set headers on sockets, from a chirpy.bearer.<token> subprotocol; tokens are never read from the
+query string since URLs end up in proxy and access logs */
+
+func wsAuthorization(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		return authorization
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, wsTokenProtocol) {
+			return "Bearer " + strings.TrimPrefix(protocol, wsTokenProtocol)
+		}
+	}
+	return ""
+}
+
+// wsClientMessage is sent by clients to manage subscriptions or present a fresh access token
+
+type wsClientMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type    string      `json:"type"`
+	Channel string      `json:"channel,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// channelName lowercases a channel and expands the #tag shorthand to hashtag:tag
+
+func channelName(channel string) string {
+	channel = strings.ToLower(channel)
+	if strings.HasPrefix(channel, "#") {
+		return "hashtag:" + strings.TrimPrefix(channel, "#")
+	}
+	return channel
+}
+
+// validChannel reports whether name is notifications, following, author:<id> or hashtag:<tag>
+
+func validChannel(name string) bool {
+	switch {
+	case name == "notifications", name == "following":
+		return true
+	case strings.HasPrefix(name, "author:"):
+		_, err := strconv.Atoi(strings.TrimPrefix(name, "author:"))
+		return err == nil
+	case strings.HasPrefix(name, "hashtag:"):
+		return strings.TrimPrefix(name, "hashtag:") != ""
+	}
+	return false
+}
+
+// wsChannelsFor lists the subscribed channels a chirp event belongs to
+
+func wsChannelsFor(chirp database.Chirp, channels map[string]struct{}, reader viewer) []string {
+	matched := []string{}
+	if _, ok := channels["following"]; ok {
+		if _, follows := reader.following[chirp.Author]; follows {
+			matched = append(matched, "following")
+		}
+	}
+	author := "author:" + strconv.Itoa(chirp.Author)
+	if _, ok := channels[author]; ok {
+		matched = append(matched, author)
+	}
+	for _, tag := range hashtags(chirp.Body) {
+		if _, ok := channels["hashtag:"+tag]; ok {
+			matched = append(matched, "hashtag:"+tag)
+		}
+	}
+	return matched
+}
+
+/* handlerWebsocket upgrades an authenticated request to a WebSocket delivering live timelines and notifications
+the access token comes from the Authorization header or the Sec-WebSocket-Protocol header and the socket
+is closed when it expires unless the client sends a fresh one in an auth message */
+
+func (cfg *apiConfig) handlerWebsocket(w http.ResponseWriter, r *http.Request) {
+
+	// 1: authenticate before upgrading so failures are plain HTTP errors
+
+	authorization := wsAuthorization(r)
+	subject, err := cfg.validateToken(authorization, "chirpy-access")
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	expiresAt, err := cfg.tokenExpiry(authorization)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	reader, err := cfg.viewerFor(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("API: Websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// 2: subscribe to chirp changes and the user's notifications
+
+	_, _, chirpSub := cfg.Events.Subscribe(0)
+	defer chirpSub.Close()
+	notificationSub := cfg.Notifier.Subscribe(subject)
+	defer notificationSub.Close()
+
+	// 3: read client messages on their own goroutine; only this goroutine writes to the connection
+
+	incoming := make(chan wsClientMessage)
+	done := make(chan struct{})
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		defer close(done)
+		for {
+			msg := wsClientMessage{}
+			err := conn.ReadJSON(&msg)
+			if err != nil {
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	write := func(msg wsServerMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(msg)
+	}
+	closeWith := func(code int, reason string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+	}
+
+	channels := map[string]struct{}{}
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+
+	// 4: relay events until the client leaves, stops answering pings or its token expires
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-expiry.C:
+			closeWith(wsCloseTokenExpired, "access token expired")
+			return
+
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				return
+			}
+			if err := cfg.checkAccount(subject); err != nil {
+				closeWith(wsCloseAccountDisabled, err.Error())
+				return
+			}
+			// pick up follows, blocks and mutes made while the socket is open
+			if fresh, err := cfg.viewerFor(subject); err == nil {
+				reader = fresh
+			}
+
+		case msg := <-incoming:
+			reply := cfg.handleWebsocketMessage(msg, subject, channels, &reader, expiry)
+			if err := write(reply); err != nil {
+				return
+			}
+
+		case notification, ok := <-notificationSub.Notifications():
+			if !ok {
+				return
+			}
+			if _, subscribed := channels["notifications"]; !subscribed {
+				continue
+			}
+			if err := write(wsServerMessage{Type: "notification", Channel: "notifications", Data: notification}); err != nil {
+				return
+			}
+
+		case event, ok := <-chirpSub.Events():
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "client fell too far behind")
+				return
+			}
+			if !streamVisible(reader, event) {
+				continue
+			}
+			var data interface{} = newChirp(event.Chirp, subject)
+			if event.Type == database.ChangeChirpDeleted {
+				data = map[string]int{"id": event.Chirp.ID}
+			}
+			for _, channel := range wsChannelsFor(event.Chirp, channels, reader) {
+				if err := write(wsServerMessage{Type: event.Type, Channel: channel, Data: data}); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// handleWebsocketMessage applies one client message and returns the reply to send
+
+func (cfg *apiConfig) handleWebsocketMessage(msg wsClientMessage, subject int, channels map[string]struct{}, reader *viewer, expiry *time.Timer) wsServerMessage {
+	switch msg.Type {
+	case "subscribe":
+		channel := channelName(msg.Channel)
+		if !validChannel(channel) {
+			return wsServerMessage{Type: "error", Channel: msg.Channel, Error: "unknown channel"}
+		}
+		if len(channels) >= wsMaxChannels {
+			return wsServerMessage{Type: "error", Channel: msg.Channel, Error: "too many subscriptions"}
+		}
+		if channel == "following" {
+			// pick up follows made since the socket was opened
+			if fresh, err := cfg.viewerFor(subject); err == nil {
+				*reader = fresh
+			}
+		}
+		channels[channel] = struct{}{}
+		return wsServerMessage{Type: "subscribed", Channel: channel}
+
+	case "unsubscribe":
+		channel := channelName(msg.Channel)
+		delete(channels, channel)
+		return wsServerMessage{Type: "unsubscribed", Channel: channel}
+
+	case "auth":
+		token := "Bearer " + strings.TrimPrefix(msg.Token, "Bearer ")
+		tokenSubject, err := cfg.validateToken(token, "chirpy-access")
+		if err != nil || tokenSubject != subject {
+			return wsServerMessage{Type: "error", Error: "invalid access token"}
+		}
+		expiresAt, err := cfg.tokenExpiry(token)
+		if err != nil {
+			return wsServerMessage{Type: "error", Error: err.Error()}
+		}
+		if !expiry.Stop() {
+			select {
+			case <-expiry.C:
+			default:
+			}
+		}
+		expiry.Reset(time.Until(expiresAt))
+		return wsServerMessage{Type: "authenticated", Data: map[string]time.Time{"expires_at": expiresAt}}
+
+	default:
+		return wsServerMessage{Type: "error", Error: "unknown message type"}
+	}
+}
+
+// notifyChirpCreated tells quoted authors and direct recipients about a new chirp
+
+func (cfg *apiConfig) notifyChirpCreated(chirp database.Chirp) {
+	if chirp.Visibility == database.VisibilityDirect {
+		for _, recipient := range chirp.Recipients {
+			if recipient == chirp.Author {
+				continue
+			}
+			cfg.notify(recipient, events.Notification{
+				Type:    events.NotificationDirect,
+				Actor:   chirp.Author,
+				ChirpID: chirp.ID,
+			})
+		}
+	}
+	if chirp.QuoteOf != 0 {
+		original, err := cfg.DB.GetChirp(chirp.QuoteOf)
+		if err == nil && original.Author != chirp.Author {
+			cfg.notify(original.Author, events.Notification{
+				Type:    events.NotificationQuote,
+				Actor:   chirp.Author,
+				ChirpID: chirp.ID,
+			})
+		}
+	}
+}
+
+// notify sends a notification unless the recipient has blocked, been blocked by or muted its actor
+
+func (cfg *apiConfig) notify(recipient int, notification events.Notification) {
+	reader, err := cfg.viewerFor(recipient)
+	if err != nil || reader.hides(notification.Actor) {
+		return
+	}
+	cfg.Notifier.Notify(recipient, notification)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/events"
+)
+
+func TestWebsocketAuthentication(t *testing.T) {
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbUser, err := store.CreateUser("socket@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{
+		DB:        store,
+		JWTSecret: "secret",
+		Events:    events.NewHub(streamReplaySize, streamBufferSize),
+		Notifier:  events.NewNotifier(wsNotificationSize),
+	}
+	token, err := cfg.generateUserToken(dbUser.ID, userRole(dbUser), time.Now().Add(time.Hour), "chirpy-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(cfg.handlerWebsocket))
+	defer srv.Close()
+	socketURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := []struct {
+		name         string
+		url          string
+		header       http.Header
+		protocols    []string
+		wantStatus   int
+		wantProtocol string
+	}{
+		{
+			name:       "authorization header",
+			url:        socketURL,
+			header:     http.Header{"Authorization": {"Bearer " + token}},
+			wantStatus: http.StatusSwitchingProtocols,
+		},
+		{
+			name:         "token subprotocol",
+			url:          socketURL,
+			protocols:    []string{wsProtocol, wsTokenProtocol + token},
+			wantStatus:   http.StatusSwitchingProtocols,
+			wantProtocol: wsProtocol,
+		},
+		{
+			name:       "query parameter",
+			url:        socketURL + "?access_token=" + token,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid token subprotocol",
+			url:        socketURL,
+			protocols:  []string{wsProtocol, wsTokenProtocol + "nope"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.protocols, HandshakeTimeout: 5 * time.Second}
+			conn, resp, err := dialer.Dial(tt.url, tt.header)
+			if conn != nil {
+				defer conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != tt.wantProtocol {
+				t.Errorf("answered subprotocol %q, want %q", got, tt.wantProtocol)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const maxDocumentSize = 1 << 20
+
+var (
+	ErrInsecureURL    = errors.New("activitypub: remote URLs must use https")
+	ErrPrivateAddress = errors.New("activitypub: refusing to connect to a private address")
+	ErrHostMismatch   = errors.New("activitypub: actor names a key or inbox on another host")
+)
+
+/* Client fetches remote actors and delivers activities
+every URL comes from another server, so only https is used and addresses on the server's own network are refused
+when dialing, after DNS resolution so a name can't point back inside */
+
+type Client struct {
+	HTTP *http.Client
+	// AllowPrivate lets tests reach stub servers on loopback; it must stay off in production
+	AllowPrivate bool
+}
+
+func NewClient() *Client {
+	c := &Client{}
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return c.checkAddress(address)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	c.HTTP = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("activitypub: too many redirects")
+			}
+			return checkURL(req.URL.String())
+		},
+	}
+	return c
+}
+
+// checkAddress refuses loopback, private, link-local and unspecified addresses unless AllowPrivate is set
+
+func (c *Client) checkAddress(address string) error {
+	if c.AllowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// checkURL requires an absolute https URL
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return ErrInsecureURL
+	}
+	return nil
+}
+
+// SameHost reports whether two absolute URLs name the same host and port
+
+func SameHost(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// FetchActor dereferences an actor IRI, dropping any key fragment; the actor's inbox must be on its own host
+
+func (c *Client) FetchActor(iri string) (Actor, error) {
+	iri, _, _ = strings.Cut(iri, "#")
+	err := checkURL(iri)
+	if err != nil {
+		return Actor{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, iri, nil)
+	if err != nil {
+		return Actor{}, err
+	}
+	req.Header.Set("Accept", ContentType+", "+LDContentType)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return Actor{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Actor{}, fmt.Errorf("activitypub: fetching %s returned %v", iri, resp.StatusCode)
+	}
+
+	actor := Actor{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&actor)
+	if err != nil {
+		return Actor{}, err
+	}
+	if actor.ID != iri {
+		return Actor{}, errors.New("activitypub: actor id does not match the IRI it was fetched from")
+	}
+	if !SameHost(actor.Inbox, actor.ID) {
+		return Actor{}, ErrHostMismatch
+	}
+	return actor, nil
+}
+
+// FetchKey resolves a keyId through the owning actor's document, returning both the actor and its key
+
+func (c *Client) FetchKey(keyID string) (Actor, *rsa.PublicKey, error) {
+	actor, err := c.FetchActor(keyID)
+	if err != nil {
+		return Actor{}, nil, err
+	}
+	if actor.PublicKey.ID != keyID {
+		return Actor{}, nil, errors.New("activitypub: actor does not publish the requested key")
+	}
+	if !SameHost(keyID, actor.ID) {
+		return Actor{}, nil, ErrHostMismatch
+	}
+	key, err := ParsePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return Actor{}, nil, err
+	}
+	return actor, key, nil
+}
+
+// Deliver POSTs a signed activity to a remote inbox
+
+func (c *Client) Deliver(inbox string, activity interface{}, keyID string, key *rsa.PrivateKey) error {
+	err := checkURL(inbox)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	err = SignRequest(req, body, keyID, key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("activitypub: delivery to %s returned %v", inbox, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubClient returns a client trusting srv's certificate, allowed to reach it on loopback
+
+func stubClient(srv *httptest.Server) *Client {
+	c := NewClient()
+	c.AllowPrivate = true
+	c.HTTP.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	return c
+}
+
+// serveActor serves the actor document returned by actor for the stub's own URL at /actor
+
+func serveActor(t *testing.T, actor func(base string) Actor) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actor" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(actor(srv.URL))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		refused bool
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443"},
+		{address: "127.0.0.1:443", refused: true},
+		{address: "10.1.2.3:443", refused: true},
+		{address: "172.16.0.1:443", refused: true},
+		{address: "192.168.1.1:443", refused: true},
+		{address: "169.254.169.254:80", refused: true},
+		{address: "0.0.0.0:443", refused: true},
+		{address: "[::1]:443", refused: true},
+		{address: "[fc00::1]:443", refused: true},
+		{address: "[fe80::1]:443", refused: true},
+		{address: "[::ffff:127.0.0.1]:443", refused: true},
+	}
+
+	c := NewClient()
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := c.checkAddress(tt.address)
+			if tt.refused && !errors.Is(err, ErrPrivateAddress) {
+				t.Errorf("checkAddress() = %v, want ErrPrivateAddress", err)
+			}
+			if !tt.refused && err != nil {
+				t.Errorf("checkAddress() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestFetchKey(t *testing.T) {
+	_, pub, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		actor   func(base string) Actor
+		fails   bool
+		wantErr error
+	}{
+		{
+			name: "valid",
+			actor: func(base string) Actor {
+				return Actor{ID: base + "/actor", Inbox: base + "/inbox", PublicKey: PublicKey{ID: base + "/actor#main-key", PublicKeyPem: pub}}
+			},
+		},
+		{
+			name: "inbox on another host",
+			actor: func(base string) Actor {
+				return Actor{ID: base + "/actor", Inbox: "https://127.0.0.1:1/inbox", PublicKey: PublicKey{ID: base + "/actor#main-key", PublicKeyPem: pub}}
+			},
+			fails:   true,
+			wantErr: ErrHostMismatch,
+		},
+		{
+			name: "actor id on another host",
+			actor: func(base string) Actor {
+				return Actor{ID: "https://other.example/actor", Inbox: "https://other.example/inbox", PublicKey: PublicKey{ID: base + "/actor#main-key", PublicKeyPem: pub}}
+			},
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveActor(t, tt.actor)
+			_, key, err := stubClient(srv).FetchKey(srv.URL + "/actor#main-key")
+			if tt.fails {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("FetchKey() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || key == nil {
+				t.Errorf("FetchKey() = %v, %v, want a key", key, err)
+			}
+		})
+	}
+}
+
+func TestClientRefusesUnsafeURLs(t *testing.T) {
+	srv := serveActor(t, func(base string) Actor {
+		return Actor{ID: base + "/actor", Inbox: base + "/inbox"}
+	})
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	// the stub listens on loopback, which only the test opt-in may reach
+	_, err := NewClient().FetchActor(srv.URL + "/actor")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("FetchActor() on loopback error = %v, want ErrPrivateAddress", err)
+	}
+
+	c := stubClient(srv)
+	_, err = c.FetchActor(plain.URL + "/actor")
+	if !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("FetchActor() over http error = %v, want ErrInsecureURL", err)
+	}
+	err = c.Deliver(plain.URL+"/inbox", Activity{Type: "Accept"}, testKeyID, testKey(t))
+	if !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("Deliver() over http error = %v, want ErrInsecureURL", err)
+	}
+}
@@ -0,0 +1,153 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MaxClockSkew is how far a signed request's Date header may be from the server's clock
+
+const MaxClockSkew = 5 * time.Minute
+
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// Digest returns the value of the Digest header for body
+
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SignRequest adds Date, Digest and Signature headers to req, signing with the actor key identified by keyID
+
+func SignRequest(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	req.Header.Set("Digest", Digest(body))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	signingString := buildSigningString(req, signedHeaders)
+	hashed := sha256.Sum256([]byte(signingString))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// KeyFetcher resolves a keyId from a Signature header to the public key it names
+
+type KeyFetcher func(keyID string) (*rsa.PublicKey, error)
+
+/* VerifyRequest checks the Signature header on an incoming request
+the signature must cover the request target, host, date and digest, the date must be recent
+and the digest must match body; the verified keyId is returned */
+
+func VerifyRequest(req *http.Request, body []byte, fetch KeyFetcher) (string, error) {
+	params, err := parseSignature(req.Header.Get("Signature"))
+	if err != nil {
+		return "", err
+	}
+
+	keyID := params["keyId"]
+	if keyID == "" {
+		return "", errors.New("activitypub: signature has no keyId")
+	}
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return "", fmt.Errorf("activitypub: unsupported signature algorithm %q", alg)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	for _, required := range signedHeaders {
+		found := false
+		for _, h := range headers {
+			if h == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("activitypub: signature does not cover %s", required)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return "", errors.New("activitypub: missing or invalid Date header")
+	}
+	if skew := time.Since(date); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return "", errors.New("activitypub: Date header is too far from server time")
+	}
+
+	if req.Header.Get("Digest") != Digest(body) {
+		return "", errors.New("activitypub: Digest header does not match body")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", errors.New("activitypub: signature is not valid base64")
+	}
+
+	pub, err := fetch(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256([]byte(buildSigningString(req, headers)))
+	err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig)
+	if err != nil {
+		return "", errors.New("activitypub: signature verification failed")
+	}
+	return keyID, nil
+}
+
+func buildSigningString(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines = append(lines, "(request-target): "+strings.ToLower(req.Method)+" "+req.URL.RequestURI())
+		case "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			lines = append(lines, "host: "+host)
+		default:
+			lines = append(lines, h+": "+strings.Join(req.Header.Values(h), ", "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseSignature(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, errors.New("activitypub: request is not signed")
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, errors.New("activitypub: malformed Signature header")
+		}
+		params[key] = strings.Trim(value, `"`)
+	}
+	return params, nil
+}
@@ -0,0 +1,126 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKeyID = "https://remote.example/actor#main-key"
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	priv, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyRequest(t *testing.T) {
+	key := testKey(t)
+	otherKey := testKey(t)
+	body := []byte(`{"type":"Follow"}`)
+
+	tests := []struct {
+		name    string
+		signer  *rsa.PrivateKey
+		modify  func(req *http.Request)
+		body    []byte
+		wantErr bool
+	}{
+		{name: "valid", signer: key},
+		{name: "signed by another key", signer: otherKey, wantErr: true},
+		{name: "body changed after signing", signer: key, body: []byte(`{"type":"Undo"}`), wantErr: true},
+		{
+			name:   "digest replaced to match changed body",
+			signer: key,
+			body:   []byte(`{"type":"Undo"}`),
+			modify: func(req *http.Request) {
+				req.Header.Set("Digest", Digest([]byte(`{"type":"Undo"}`)))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "sent to another path",
+			signer: key,
+			modify: func(req *http.Request) {
+				req.URL.Path = "/ap/users/2/inbox"
+			},
+			wantErr: true,
+		},
+		{
+			name:   "date too old",
+			signer: key,
+			modify: func(req *http.Request) {
+				req.Header.Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "digest not signed",
+			signer: key,
+			modify: func(req *http.Request) {
+				sig := req.Header.Get("Signature")
+				req.Header.Set("Signature", strings.Replace(sig, ` digest"`, `"`, 1))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "unsupported algorithm",
+			signer: key,
+			modify: func(req *http.Request) {
+				sig := req.Header.Get("Signature")
+				req.Header.Set("Signature", strings.Replace(sig, "rsa-sha256", "hmac-sha256", 1))
+			},
+			wantErr: true,
+		},
+		{
+			name:   "unsigned",
+			signer: key,
+			modify: func(req *http.Request) {
+				req.Header.Del("Signature")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://chirpy.test/ap/users/1/inbox", bytes.NewReader(body))
+			err := SignRequest(req, body, testKeyID, tt.signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+			received := body
+			if tt.body != nil {
+				received = tt.body
+			}
+
+			keyID, err := VerifyRequest(req, received, func(keyID string) (*rsa.PublicKey, error) {
+				if keyID != testKeyID {
+					return nil, errors.New("unknown key")
+				}
+				return &key.PublicKey, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && keyID != testKeyID {
+				t.Errorf("VerifyRequest() keyID = %q, want %q", keyID, testKeyID)
+			}
+		})
+	}
+}
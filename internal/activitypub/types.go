@@ -0,0 +1,112 @@
+package activitypub
+
+const (
+	ContentType   = "application/activity+json"
+	LDContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+	PublicIRI     = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+var Context = []string{
+	"https://www.w3.org/ns/activitystreams",
+	"https://w3id.org/security/v1",
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Actor struct {
+	Context           interface{} `json:"@context,omitempty"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Name              string      `json:"name,omitempty"`
+	Summary           string      `json:"summary,omitempty"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox,omitempty"`
+	Followers         string      `json:"followers,omitempty"`
+	URL               string      `json:"url,omitempty"`
+	PublicKey         PublicKey   `json:"publicKey"`
+}
+
+type Note struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	AttributedTo string      `json:"attributedTo"`
+	Content      string      `json:"content"`
+	Published    string      `json:"published,omitempty"`
+	URL          string      `json:"url,omitempty"`
+	To           []string    `json:"to"`
+	Cc           []string    `json:"cc,omitempty"`
+}
+
+// Activity is any activity; Object is kept as raw interface so both IRIs and embedded objects decode
+
+type Activity struct {
+	Context   interface{} `json:"@context,omitempty"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Object    interface{} `json:"object"`
+	Published string      `json:"published,omitempty"`
+	To        []string    `json:"to,omitempty"`
+	Cc        []string    `json:"cc,omitempty"`
+}
+
+type OrderedCollection struct {
+	Context      interface{}   `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	First        string        `json:"first,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+type OrderedCollectionPage struct {
+	Context      interface{}   `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	PartOf       string        `json:"partOf"`
+	TotalItems   int           `json:"totalItems"`
+	Next         string        `json:"next,omitempty"`
+	Prev         string        `json:"prev,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems"`
+}
+
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// ObjectID returns the id of an activity's object whether it was sent as an IRI or embedded
+
+func ObjectID(object interface{}) string {
+	switch o := object.(type) {
+	case string:
+		return o
+	case map[string]interface{}:
+		id, _ := o["id"].(string)
+		return id
+	}
+	return ""
+}
+
+// ObjectType returns the type of an embedded object, or an empty string for IRIs
+
+func ObjectType(object interface{}) string {
+	if o, ok := object.(map[string]interface{}); ok {
+		t, _ := o["type"].(string)
+		return t
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const dayFormat = "2006-01-02"
+
+// Store persists batches of view counts keyed by chirp ID then day
+
+type Store interface {
+	AddViews(views map[int]map[string]int) error
+}
+
+/* Recorder buffers chirp impressions in memory and writes them to its store in batches
+a viewer is only counted once per chirp within each dedup window */
+
+type Recorder struct {
+	store      Store
+	window     time.Duration
+	maxPending int
+	mu         *sync.Mutex
+	seen       map[string]time.Time
+	pending    map[int]map[string]int
+	size       int
+	flushing   bool
+}
+
+func NewRecorder(store Store, window time.Duration, maxPending int) *Recorder {
+	return &Recorder{
+		store:      store,
+		window:     window,
+		maxPending: maxPending,
+		mu:         &sync.Mutex{},
+		seen:       map[string]time.Time{},
+		pending:    map[int]map[string]int{},
+	}
+}
+
+// Record counts an impression of chirpID by viewer, starting an early flush in the background once the buffer is full
+
+func (rec *Recorder) Record(chirpID int, viewer string) {
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%d:%s", chirpID, viewer)
+
+	rec.mu.Lock()
+	if last, ok := rec.seen[key]; ok && now.Sub(last) < rec.window {
+		rec.mu.Unlock()
+		return
+	}
+	rec.seen[key] = now
+
+	day := now.Format(dayFormat)
+	if rec.pending[chirpID] == nil {
+		rec.pending[chirpID] = map[string]int{}
+	}
+	rec.pending[chirpID][day]++
+	rec.size++
+	// readers shouldn't wait on the store, and one early flush at a time is enough
+	full := rec.size >= rec.maxPending && !rec.flushing
+	if full {
+		rec.flushing = true
+	}
+	rec.mu.Unlock()
+
+	if full {
+		go func() {
+			err := rec.Flush()
+			if err != nil {
+				log.Printf("ANALYTICS: Could not flush views: %v", err)
+			}
+			rec.mu.Lock()
+			rec.flushing = false
+			rec.mu.Unlock()
+		}()
+	}
+}
+
+// Flush writes buffered counts to the store and forgets viewers whose dedup window has passed
+
+func (rec *Recorder) Flush() error {
+	rec.mu.Lock()
+	batch := rec.pending
+	rec.pending = map[int]map[string]int{}
+	rec.size = 0
+
+	now := time.Now().UTC()
+	for key, last := range rec.seen {
+		if now.Sub(last) >= rec.window {
+			delete(rec.seen, key)
+		}
+	}
+	rec.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := rec.store.AddViews(batch)
+	if err != nil {
+		// put the batch back so the counts are retried on the next flush
+		rec.mu.Lock()
+		for chirpID, days := range batch {
+			if rec.pending[chirpID] == nil {
+				rec.pending[chirpID] = map[string]int{}
+			}
+			for day, n := range days {
+				rec.pending[chirpID][day] += n
+				rec.size += n
+			}
+		}
+		rec.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes the buffer every interval
+
+func (rec *Recorder) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := rec.Flush()
+		if err != nil {
+			log.Printf("ANALYTICS: Could not flush views: %v", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps flushed batches in memory and fails while err is set
+
+type memoryStore struct {
+	mu    sync.Mutex
+	views map[int]int
+	err   error
+}
+
+func (s *memoryStore) AddViews(views map[int]map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	for chirpID, days := range views {
+		for _, n := range days {
+			s.views[chirpID] += n
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) total(chirpID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.views[chirpID]
+}
+
+type view struct {
+	chirpID int
+	viewer  string
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name  string
+		views []view
+		want  map[int]int
+	}{
+		{name: "one view", views: []view{{1, "a"}}, want: map[int]int{1: 1}},
+		{name: "same viewer twice", views: []view{{1, "a"}, {1, "a"}}, want: map[int]int{1: 1}},
+		{name: "two viewers", views: []view{{1, "a"}, {1, "b"}}, want: map[int]int{1: 2}},
+		{name: "one viewer, two chirps", views: []view{{1, "a"}, {2, "a"}}, want: map[int]int{1: 1, 2: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{views: map[int]int{}}
+			rec := NewRecorder(store, time.Hour, 100)
+			for _, v := range tt.views {
+				rec.Record(v.chirpID, v.viewer)
+			}
+			if store.total(1) != 0 {
+				t.Fatal("views reached the store before a flush")
+			}
+			err := rec.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for chirpID, want := range tt.want {
+				if got := store.total(chirpID); got != want {
+					t.Errorf("views of chirp %v = %v, want %v", chirpID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	store := &memoryStore{views: map[int]int{}}
+	rec := NewRecorder(store, 50*time.Millisecond, 100)
+
+	rec.Record(1, "a")
+	err := rec.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a flush forgets nothing while the window is still open
+	rec.Record(1, "a")
+	time.Sleep(60 * time.Millisecond)
+	rec.Record(1, "a")
+	err = rec.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.total(1); got != 2 {
+		t.Errorf("views = %v, want one per window", got)
+	}
+}
+
+func TestFailedFlushIsRetried(t *testing.T) {
+	store := &memoryStore{views: map[int]int{}, err: errors.New("disk full")}
+	rec := NewRecorder(store, time.Hour, 100)
+	rec.Record(1, "a")
+	rec.Record(1, "b")
+
+	err := rec.Flush()
+	if err == nil {
+		t.Fatal("Flush() error = nil, want the store's error")
+	}
+	rec.Record(1, "c")
+
+	store.mu.Lock()
+	store.err = nil
+	store.mu.Unlock()
+	err = rec.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.total(1); got != 3 {
+		t.Errorf("views = %v, want the failed batch kept for the retry", got)
+	}
+}
+
+func TestFullBufferFlushesEarly(t *testing.T) {
+	store := &memoryStore{views: map[int]int{}}
+	rec := NewRecorder(store, time.Hour, 3)
+	for _, viewer := range []string{"a", "b", "c"} {
+		rec.Record(1, viewer)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for store.total(1) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("views = %v a second after the buffer filled, want 3", store.total(1))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Action names something a subject wants to do to a resource
+
+type Action string
+
+const (
+	ActionCreateChirp Action = "chirp:create"
+	ActionDeleteChirp Action = "chirp:delete"
+	ActionPinChirp    Action = "chirp:pin"
+	ActionUpdateUser  Action = "user:update"
+	ActionDeleteUser  Action = "user:delete"
+	ActionExportUser  Action = "user:export"
+	ActionUpgradeUser Action = "user:upgrade"
+	ActionSetRole     Action = "user:set_role"
+	ActionManageUser  Action = "user:manage"
+	ActionImpersonate Action = "user:impersonate"
+)
+
+// ErrForbidden is matched by every *DeniedError so handlers can map denials to 403
+
+var ErrForbidden = errors.New("forbidden")
+
+type DeniedError struct {
+	Action Action
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return e.Reason
+}
+
+func (e *DeniedError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// Subject is who is acting, built from the stored user rather than token claims so it is always current
+
+type Subject struct {
+	ID       int
+	Role     Role
+	Premium  bool
+	Verified bool
+}
+
+// Resource is what is acted on, Owner is 0 for resources nobody owns such as a chirp not yet created
+
+type Resource struct {
+	Owner int
+}
+
+/* Rule says who may perform an action:
+the owner may when Owner is set and any subject may when Anyone is set, as long as they meet RequireVerified and RequirePremium,
+anyone with at least Role may regardless of ownership and the Require fields */
+
+type Rule struct {
+	Role            Role
+	Owner           bool
+	Anyone          bool
+	RequireVerified bool
+	RequirePremium  bool
+}
+
+// Grant says how an action was allowed, since some callers record actions taken through a role differently
+
+type Grant struct {
+	ByRole bool
+}
+
+type Policy struct {
+	rules map[Action]Rule
+}
+
+func NewPolicy(rules map[Action]Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// DefaultPolicy holds the rules chirpy enforces
+
+func DefaultPolicy() *Policy {
+	return NewPolicy(map[Action]Rule{
+		ActionCreateChirp: {Anyone: true, RequireVerified: true},
+		ActionDeleteChirp: {Owner: true, Role: RoleModerator},
+		ActionPinChirp:    {Owner: true},
+		ActionUpdateUser:  {Owner: true},
+		ActionDeleteUser:  {Owner: true},
+		ActionExportUser:  {Owner: true},
+		ActionUpgradeUser: {Owner: true, RequireVerified: true},
+		ActionSetRole:     {Role: RoleAdmin},
+		ActionManageUser:  {Role: RoleAdmin},
+		ActionImpersonate: {Role: RoleAdmin},
+	})
+}
+
+/* Can answers whether subject may perform action on resource, returning a *DeniedError explaining why not
+the owner or anyone rule is tried first so the grant only reports ByRole when the role was actually needed */
+
+func (p *Policy) Can(subject Subject, action Action, resource Resource) (Grant, error) {
+	rule, ok := p.rules[action]
+	if !ok {
+		return Grant{}, &DeniedError{Action: action, Reason: fmt.Sprintf("no policy allows %v", action)}
+	}
+
+	denied := rule.check(subject, resource)
+	if denied == "" {
+		return Grant{}, nil
+	}
+	if rule.Role != "" && subject.Role.AtLeast(rule.Role) {
+		return Grant{ByRole: true}, nil
+	}
+	return Grant{}, &DeniedError{Action: action, Reason: denied}
+}
+
+// check returns why the rule refuses subject without considering the role, or "" if it allows them
+
+func (rule Rule) check(subject Subject, resource Resource) string {
+	isOwner := subject.ID != 0 && resource.Owner == subject.ID
+	switch {
+	case !rule.Anyone && !rule.Owner:
+		return fmt.Sprintf("requires the %v role", rule.Role)
+	case !rule.Anyone && !isOwner:
+		return "you don't own this resource"
+	case rule.RequireVerified && !subject.Verified:
+		return "verify your email address first"
+	case rule.RequirePremium && !subject.Premium:
+		return "requires Chirpy Red"
+	}
+	return ""
+}
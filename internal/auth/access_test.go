@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyCan(t *testing.T) {
+	owner := Subject{ID: 1, Role: RoleUser, Verified: true}
+	unverifiedOwner := Subject{ID: 1, Role: RoleUser}
+	stranger := Subject{ID: 2, Role: RoleUser, Verified: true}
+	moderator := Subject{ID: 3, Role: RoleModerator, Verified: true}
+	admin := Subject{ID: 4, Role: RoleAdmin}
+	anonymous := Subject{}
+
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource Resource
+		allowed  bool
+		byRole   bool
+	}{
+		{name: "verified user creates a chirp", subject: owner, action: ActionCreateChirp, allowed: true},
+		{name: "unverified user can't create a chirp", subject: unverifiedOwner, action: ActionCreateChirp},
+		{name: "admin role doesn't skip verification when anyone may act", subject: Subject{ID: 4, Role: RoleAdmin}, action: ActionCreateChirp},
+		{name: "owner deletes their chirp", subject: owner, action: ActionDeleteChirp, resource: Resource{Owner: 1}, allowed: true},
+		{name: "stranger can't delete a chirp", subject: stranger, action: ActionDeleteChirp, resource: Resource{Owner: 1}},
+		{name: "moderator deletes through their role", subject: moderator, action: ActionDeleteChirp, resource: Resource{Owner: 1}, allowed: true, byRole: true},
+		{name: "moderator deleting their own chirp needs no role", subject: moderator, action: ActionDeleteChirp, resource: Resource{Owner: 3}, allowed: true},
+		{name: "admin outranks moderator", subject: admin, action: ActionDeleteChirp, resource: Resource{Owner: 1}, allowed: true, byRole: true},
+		{name: "anonymous never owns an unowned resource", subject: anonymous, action: ActionPinChirp, resource: Resource{}},
+		{name: "moderator can't pin others' chirps", subject: moderator, action: ActionPinChirp, resource: Resource{Owner: 1}},
+		{name: "unverified owner can't upgrade", subject: unverifiedOwner, action: ActionUpgradeUser, resource: Resource{Owner: 1}},
+		{name: "verified owner upgrades", subject: owner, action: ActionUpgradeUser, resource: Resource{Owner: 1}, allowed: true},
+		{name: "user can't set roles on themselves", subject: owner, action: ActionSetRole, resource: Resource{Owner: 1}},
+		{name: "moderator can't set roles", subject: moderator, action: ActionSetRole, resource: Resource{Owner: 1}},
+		{name: "admin sets roles", subject: admin, action: ActionSetRole, resource: Resource{Owner: 1}, allowed: true, byRole: true},
+		{name: "unknown role has no privileges", subject: Subject{ID: 5, Role: "root"}, action: ActionManageUser, resource: Resource{Owner: 1}},
+		{name: "actions without a rule are denied", subject: admin, action: Action("chirp:launch"), resource: Resource{Owner: 4}},
+	}
+
+	policy := DefaultPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant, err := policy.Can(tt.subject, tt.action, tt.resource)
+			if !tt.allowed {
+				if !errors.Is(err, ErrForbidden) {
+					t.Fatalf("Can() error = %v, want ErrForbidden", err)
+				}
+				denied := &DeniedError{}
+				if !errors.As(err, &denied) || denied.Action != tt.action || denied.Reason == "" {
+					t.Errorf("Can() error = %#v, want a *DeniedError for %v with a reason", err, tt.action)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Can() error = %v, want nil", err)
+			}
+			if grant.ByRole != tt.byRole {
+				t.Errorf("Can() grant.ByRole = %v, want %v", grant.ByRole, tt.byRole)
+			}
+		})
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role  Role
+		other Role
+		want  bool
+	}{
+		{role: RoleUser, other: RoleUser, want: true},
+		{role: RoleUser, other: RoleModerator, want: false},
+		{role: RoleModerator, other: RoleUser, want: true},
+		{role: RoleAdmin, other: RoleModerator, want: true},
+		{role: RoleModerator, other: RoleAdmin, want: false},
+		{role: Role("root"), other: RoleUser, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%v.AtLeast(%v) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Role
+		ok   bool
+	}{
+		{in: "", want: RoleUser, ok: true},
+		{in: "user", want: RoleUser, ok: true},
+		{in: "moderator", want: RoleModerator, ok: true},
+		{in: "admin", want: RoleAdmin, ok: true},
+		{in: "Admin", ok: false},
+		{in: "root", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseRole(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseRole(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* BreachedList answers whether a password appears in a breach corpus using SHA-1 hash ranges,
+the same k-anonymity layout as the Pwned Passwords range API:
+the first 5 hex characters of the hash pick a range and the remaining 35 are looked up inside it.
+
+The list is either a single file with one HASH or HASH:COUNT per line, which is loaded into memory,
+or a directory of range files named PREFIX.txt holding SUFFIX:COUNT lines, which are read on demand */
+
+type BreachedList struct {
+	dir    string
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachedList opens the list at path, returning nil when path is empty
+
+func LoadBreachedList(path string) (*BreachedList, error) {
+	if path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &BreachedList{
+		ranges: map[string]map[string]struct{}{},
+	}
+	if info.IsDir() {
+		list.dir = path
+		return list, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+		if len(hash) != 40 {
+			return nil, fmt.Errorf("breached list %v line %d: expected a SHA-1 hash", path, line)
+		}
+		hash = strings.ToUpper(hash)
+		list.add(hash[:5], hash[5:])
+	}
+	return list, scanner.Err()
+}
+
+func (l *BreachedList) add(prefix, suffix string) {
+	suffixes, ok := l.ranges[prefix]
+	if !ok {
+		suffixes = map[string]struct{}{}
+		l.ranges[prefix] = suffixes
+	}
+	suffixes[suffix] = struct{}{}
+}
+
+// Contains reports whether password is in the list
+
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := l.rangeFor(hash[:5])
+	if err != nil {
+		return false, err
+	}
+	_, ok := suffixes[hash[5:]]
+	return ok, nil
+}
+
+func (l *BreachedList) rangeFor(prefix string) (map[string]struct{}, error) {
+	suffixes, ok := l.ranges[prefix]
+	if ok || l.dir == "" {
+		return suffixes, nil
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	suffixes = map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix != "" {
+			suffixes[strings.ToUpper(suffix)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return suffixes, nil
+}
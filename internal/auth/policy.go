@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything after 72 bytes, so longer passwords would silently be truncated
+
+const bcryptMaxBytes = 72
+
+type PasswordPolicy struct {
+	MinLength int `json:"min_length"`
+	// MinClasses is how many of lowercase, uppercase, digits and symbols a password must mix
+	MinClasses int `json:"min_classes"`
+	// RejectEmail refuses passwords that contain, or are contained in, the local part of the email address
+	RejectEmail bool `json:"reject_email"`
+	// Breached is checked when set, see LoadBreachedList
+	Breached *BreachedList `json:"-"`
+}
+
+// Violation is one reason a password was refused, Code is stable for clients to match on
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke so users can fix them all at once
+
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   10,
+		MinClasses:  3,
+		RejectEmail: true,
+	}
+}
+
+// LoadPasswordPolicy reads a policy from path, falling back to DefaultPasswordPolicy when the file does not exist
+
+func LoadPasswordPolicy(path string) (PasswordPolicy, error) {
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("AUTH: %v not found, using default password policy", path)
+		return DefaultPasswordPolicy(), nil
+	}
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+
+	policy := DefaultPasswordPolicy()
+	err = json.Unmarshal(dat, &policy)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	return policy, nil
+}
+
+// Check returns a *PolicyError describing every rule password breaks, or nil if it is acceptable
+
+func (p PasswordPolicy) Check(password string, email string) error {
+	violations := []Violation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("must be at least %d characters", p.MinLength),
+		})
+	}
+	if len(password) > bcryptMaxBytes {
+		violations = append(violations, Violation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("must be at most %d bytes", bcryptMaxBytes),
+		})
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, Violation{
+			Code:    "too_few_classes",
+			Message: fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses),
+		})
+	}
+
+	if p.RejectEmail && similarToEmail(password, email) {
+		violations = append(violations, Violation{
+			Code:    "similar_to_email",
+			Message: "must not contain your email address",
+		})
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			log.Printf("AUTH: Could not check breached passwords: %v", err)
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Code:    "breached",
+				Message: "appears in a list of breached passwords",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// similarToEmail compares case-insensitively against the local part, ignoring parts too short to matter
+
+func similarToEmail(password string, email string) bool {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if len(local) < 3 {
+		return false
+	}
+	pw := strings.ToLower(password)
+	return strings.Contains(pw, local) || (len(pw) >= 3 && strings.Contains(local, pw))
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	sum := sha1.Sum([]byte("Correct-Horse-1"))
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(list, []byte(strings.ToLower(hex.EncodeToString(sum[:]))+":42\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breached, err := LoadBreachedList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := DefaultPasswordPolicy()
+	policy.Breached = breached
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{name: "acceptable", password: "Tr0ub4dor&3x", email: "walt@example.com", want: nil},
+		{name: "too short", password: "Ab1!", email: "walt@example.com", want: []string{"too_short"}},
+		{name: "length counts characters not bytes", password: "Ünïcödé1234", email: "walt@example.com", want: nil},
+		{name: "too long for bcrypt", password: strings.Repeat("Ab1", 25), email: "walt@example.com", want: []string{"too_long"}},
+		{name: "too few classes", password: "alllowercase", email: "walt@example.com", want: []string{"too_few_classes"}},
+		{name: "contains the email", password: "Walter-White-99", email: "walter@example.com", want: []string{"similar_to_email"}},
+		{name: "contained in the email", password: "Smi!1", email: "Smi!1th.jones@example.com", want: []string{"too_short", "similar_to_email"}},
+		{name: "short local parts are ignored", password: "Al-Capone-1920", email: "al@example.com", want: nil},
+		{name: "breached", password: "Correct-Horse-1", email: "walt@example.com", want: []string{"breached"}},
+		{name: "every violation is listed", password: "walt", email: "walt@example.com", want: []string{"too_short", "too_few_classes", "similar_to_email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.email)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check() error = %v, want nil", err)
+				}
+				return
+			}
+			policyErr := &PolicyError{}
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Check() error = %v, want a *PolicyError", err)
+			}
+			codes := []string{}
+			for _, v := range policyErr.Violations {
+				codes = append(codes, v.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check() violations = %v, want %v", codes, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachedListRanges(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(strings.ToLower(hash[5:])+":3\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "hunter2", want: true},
+		{password: "hunter3", want: false},
+	}
+	for _, tt := range tests {
+		got, err := list.Contains(tt.password)
+		if err != nil {
+			t.Fatalf("Contains(%q) error = %v", tt.password, err)
+		}
+		if got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+// Role is a user's place in the admin hierarchy, each role can do everything the roles below it can
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ParseRole maps the empty role stored for accounts created before roles existed to RoleUser
+
+func ParseRole(s string) (Role, bool) {
+	if s == "" {
+		return RoleUser, true
+	}
+	role := Role(s)
+	_, ok := roleRanks[role]
+	return role, ok
+}
+
+// AtLeast reports whether r is other or a more privileged role, unknown roles have no privileges
+
+func (r Role) AtLeast(other Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[other]
+}
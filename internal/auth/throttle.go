@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottleConfig describes how quickly repeated failures for one key are slowed down and then locked out
+
+type ThrottleConfig struct {
+	// FreeAttempts failures are allowed before any delay is imposed
+	FreeAttempts int
+	// BaseDelay doubles with each failure past FreeAttempts, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures block the key for LockoutFor
+	LockoutAfter int
+	LockoutFor   time.Duration
+	// failures are forgotten once a key has been quiet for ForgetAfter
+	ForgetAfter time.Duration
+}
+
+/* maxThrottleEntries bounds memory when many distinct keys are tried: stale entries are swept once it is reached,
+and if every entry is still fresh the least recently used ones are evicted */
+
+const maxThrottleEntries = 10000
+
+type attempts struct {
+	failures     int
+	inFlight     int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// Throttle tracks failed attempts per key in memory, so counts reset when the server restarts
+
+type Throttle struct {
+	cfg        ThrottleConfig
+	mu         *sync.Mutex
+	entries    map[string]*attempts
+	maxEntries int
+}
+
+func NewThrottle(cfg ThrottleConfig) *Throttle {
+	return &Throttle{
+		cfg:        cfg,
+		mu:         &sync.Mutex{},
+		entries:    map[string]*attempts{},
+		maxEntries: maxThrottleEntries,
+	}
+}
+
+// Attempt is an attempt reserved by Begin, it ends with Fail, Succeed or Release and later calls do nothing
+
+type Attempt struct {
+	throttle *Throttle
+	key      string
+	done     bool
+}
+
+/* Begin reserves an attempt for key, or returns how long the key must wait before trying again
+the reserved attempt counts as in flight until it ends, and once the free attempts are used up only one
+attempt may be in flight, so parallel guesses can't all start before the first failure is recorded */
+
+func (t *Throttle) Begin(key string, now time.Time) (*Attempt, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(key, now)
+	if now.Before(entry.blockedUntil) {
+		return nil, entry.blockedUntil.Sub(now)
+	}
+	if entry.inFlight > 0 && entry.failures+entry.inFlight >= t.cfg.FreeAttempts {
+		return nil, t.cfg.BaseDelay
+	}
+	entry.inFlight++
+	entry.last = now
+	return &Attempt{throttle: t, key: key}, 0
+}
+
+// Fail records the attempt as failed, returning true when it locked the key out
+
+func (a *Attempt) Fail(now time.Time) bool {
+	if a.done {
+		return false
+	}
+	a.done = true
+
+	t := a.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(a.key, now)
+	if entry.inFlight > 0 {
+		entry.inFlight--
+	}
+	entry.failures++
+	entry.last = now
+
+	switch {
+	case entry.failures >= t.cfg.LockoutAfter:
+		entry.blockedUntil = now.Add(t.cfg.LockoutFor)
+		return true
+	case entry.failures > t.cfg.FreeAttempts:
+		delay := t.cfg.BaseDelay << (entry.failures - t.cfg.FreeAttempts - 1)
+		if delay <= 0 || delay > t.cfg.MaxDelay {
+			delay = t.cfg.MaxDelay
+		}
+		entry.blockedUntil = now.Add(delay)
+	}
+	return false
+}
+
+// Succeed ends the attempt and forgets the key's failures
+
+func (a *Attempt) Succeed() {
+	if a.done {
+		return
+	}
+	a.done = true
+	a.throttle.Reset(a.key)
+}
+
+// Release ends the attempt without counting it either way, for attempts that never got to check a credential
+
+func (a *Attempt) Release() {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	t := a.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[a.key]
+	if !ok {
+		return
+	}
+	if entry.inFlight > 0 {
+		entry.inFlight--
+	}
+	if entry.inFlight == 0 && entry.failures == 0 {
+		delete(t.entries, a.key)
+	}
+}
+
+// Reset forgets the failures of a key, after a successful attempt or when an admin unlocks it
+
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	delete(t.entries, key)
+	t.mu.Unlock()
+}
+
+// entry returns the attempts of key, starting afresh once old failures should be forgotten; callers hold t.mu
+
+func (t *Throttle) entry(key string, now time.Time) *attempts {
+	entry, ok := t.entries[key]
+	if ok && t.stale(entry, now) {
+		entry.failures = 0
+	}
+	if ok {
+		return entry
+	}
+
+	if len(t.entries) >= t.maxEntries {
+		t.evict(now)
+	}
+	entry = &attempts{last: now}
+	t.entries[key] = entry
+	return entry
+}
+
+func (t *Throttle) stale(entry *attempts, now time.Time) bool {
+	return entry.inFlight == 0 && now.Sub(entry.last) > t.cfg.ForgetAfter && !now.Before(entry.blockedUntil)
+}
+
+// evict sweeps stale entries, then drops the least recently used ones with nothing in flight until there is room
+
+func (t *Throttle) evict(now time.Time) {
+	for key, entry := range t.entries {
+		if t.stale(entry, now) {
+			delete(t.entries, key)
+		}
+	}
+	for len(t.entries) >= t.maxEntries {
+		oldest := ""
+		for key, entry := range t.entries {
+			if entry.inFlight > 0 {
+				continue
+			}
+			if oldest == "" || entry.last.Before(t.entries[oldest].last) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		delete(t.entries, oldest)
+	}
+}
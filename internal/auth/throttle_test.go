@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testThrottleConfig = ThrottleConfig{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	LockoutAfter: 8,
+	LockoutFor:   time.Hour,
+	ForgetAfter:  time.Hour,
+}
+
+func fail(t *testing.T, th *Throttle, key string, now time.Time) bool {
+	t.Helper()
+	attempt, wait := th.Begin(key, now)
+	if wait > 0 {
+		t.Fatalf("Begin(%q) asked to wait %v", key, wait)
+	}
+	return attempt.Fail(now)
+}
+
+// waitFor returns how long key must wait, releasing the attempt if one could start
+
+func waitFor(th *Throttle, key string, now time.Time) time.Duration {
+	attempt, wait := th.Begin(key, now)
+	if attempt != nil {
+		attempt.Release()
+	}
+	return wait
+}
+
+func TestThrottleBackoffCurve(t *testing.T) {
+	// the wait imposed after each failure: free attempts, then doubling up to MaxDelay, then the lockout
+	tests := []struct {
+		failures int
+		wait     time.Duration
+		locked   bool
+	}{
+		{failures: 1, wait: 0},
+		{failures: 2, wait: 0},
+		{failures: 3, wait: 0},
+		{failures: 4, wait: time.Second},
+		{failures: 5, wait: 2 * time.Second},
+		{failures: 6, wait: 4 * time.Second},
+		{failures: 7, wait: 8 * time.Second},
+		{failures: 8, wait: time.Hour, locked: true},
+	}
+
+	th := NewThrottle(testThrottleConfig)
+	now := time.Unix(1_700_000_000, 0)
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("failure %d", tt.failures), func(t *testing.T) {
+			locked := fail(t, th, "key", now)
+			if locked != tt.locked {
+				t.Errorf("Fail() locked = %v, want %v", locked, tt.locked)
+			}
+			wait := waitFor(th, "key", now)
+			if wait != tt.wait {
+				t.Errorf("wait = %v, want %v", wait, tt.wait)
+			}
+			if wait == 0 {
+				return
+			}
+			// the key may try again as soon as the delay has passed
+			attempt, wait := th.Begin("key", now.Add(tt.wait))
+			if wait != 0 {
+				t.Fatalf("wait after the delay = %v, want 0", wait)
+			}
+			attempt.Release()
+			now = now.Add(tt.wait)
+		})
+	}
+}
+
+func TestThrottleDelayIsCapped(t *testing.T) {
+	cfg := testThrottleConfig
+	cfg.LockoutAfter = 100
+	th := NewThrottle(cfg)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 70; i++ {
+		fail(t, th, "key", now)
+		wait := waitFor(th, "key", now)
+		if wait > cfg.MaxDelay {
+			t.Fatalf("wait after %d failures = %v, more than MaxDelay", i+1, wait)
+		}
+		now = now.Add(cfg.MaxDelay)
+	}
+}
+
+func TestThrottleSucceedResets(t *testing.T) {
+	th := NewThrottle(testThrottleConfig)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 5; i++ {
+		fail(t, th, "key", now)
+		now = now.Add(time.Minute)
+	}
+	attempt, wait := th.Begin("key", now)
+	if wait != 0 {
+		t.Fatalf("Begin() wait = %v, want 0", wait)
+	}
+	attempt.Succeed()
+
+	// the next failure is free again
+	fail(t, th, "key", now)
+	if wait := waitFor(th, "key", now); wait != 0 {
+		t.Errorf("wait after a success and one failure = %v, want 0", wait)
+	}
+}
+
+func TestThrottleResetUnlocks(t *testing.T) {
+	th := NewThrottle(testThrottleConfig)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < testThrottleConfig.LockoutAfter; i++ {
+		fail(t, th, "key", now)
+		now = now.Add(testThrottleConfig.MaxDelay)
+	}
+	if wait := waitFor(th, "key", now); wait == 0 {
+		t.Fatal("key is not locked out")
+	}
+	th.Reset("key")
+	if wait := waitFor(th, "key", now); wait != 0 {
+		t.Errorf("wait after Reset = %v, want 0", wait)
+	}
+}
+
+func TestThrottleForgetsQuietKeys(t *testing.T) {
+	th := NewThrottle(testThrottleConfig)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < testThrottleConfig.FreeAttempts; i++ {
+		fail(t, th, "key", now)
+	}
+	now = now.Add(testThrottleConfig.ForgetAfter + time.Second)
+	fail(t, th, "key", now)
+	if wait := waitFor(th, "key", now); wait != 0 {
+		t.Errorf("old failures still counted, wait = %v", wait)
+	}
+}
+
+func TestThrottleLimitsAttemptsInFlight(t *testing.T) {
+	th := NewThrottle(testThrottleConfig)
+	now := time.Unix(1_700_000_000, 0)
+
+	// every free attempt may run at once
+	inFlight := []*Attempt{}
+	for i := 0; i < testThrottleConfig.FreeAttempts; i++ {
+		attempt, wait := th.Begin("key", now)
+		if wait != 0 {
+			t.Fatalf("attempt %d asked to wait %v", i+1, wait)
+		}
+		inFlight = append(inFlight, attempt)
+	}
+	if wait := waitFor(th, "key", now); wait == 0 {
+		t.Fatal("an attempt past the free ones started while the others were in flight")
+	}
+
+	// failing them all imposes the delay, released attempts don't count
+	inFlight[0].Release()
+	inFlight[1].Fail(now)
+	inFlight[2].Fail(now)
+	inFlight[2].Release()
+	attempt, wait := th.Begin("key", now)
+	if wait != 0 {
+		t.Fatalf("wait after two failures = %v, want 0", wait)
+	}
+	attempt.Fail(now)
+	attempt, wait = th.Begin("key", now)
+	if wait != 0 {
+		t.Fatalf("wait after three failures = %v, want 0", wait)
+	}
+
+	// with the free attempts used up only one attempt at a time
+	if wait := waitFor(th, "key", now); wait == 0 {
+		t.Fatal("a second attempt started past the free attempts")
+	}
+	attempt.Fail(now)
+	if wait := waitFor(th, "key", now); wait != testThrottleConfig.BaseDelay {
+		t.Errorf("wait after four failures = %v, want %v", wait, testThrottleConfig.BaseDelay)
+	}
+}
+
+func TestThrottleEvictsLeastRecentlyUsed(t *testing.T) {
+	th := NewThrottle(testThrottleConfig)
+	th.maxEntries = 3
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 3; i++ {
+		fail(t, th, fmt.Sprintf("key%d", i), now.Add(time.Duration(i)*time.Second))
+	}
+	fail(t, th, "key3", now.Add(3*time.Second))
+
+	if len(th.entries) > th.maxEntries {
+		t.Fatalf("%d entries kept, want at most %d", len(th.entries), th.maxEntries)
+	}
+	if _, ok := th.entries["key0"]; ok {
+		t.Error("least recently used key was kept")
+	}
+	if _, ok := th.entries["key3"]; !ok {
+		t.Error("newest key was evicted")
+	}
+}
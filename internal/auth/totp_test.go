@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the ASCII key "12345678901234567890" from the RFC 6238 test vectors
+
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%v) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%v) = %v, want %v", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / int64(TOTPPeriod.Seconds())
+	code := func(at time.Time) string {
+		c, err := TOTPCode(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current period", secret: rfcSecret, code: code(now), wantStep: step, wantOK: true},
+		{name: "previous period", secret: rfcSecret, code: code(now.Add(-TOTPPeriod)), wantStep: step - 1, wantOK: true},
+		{name: "next period", secret: rfcSecret, code: code(now.Add(TOTPPeriod)), wantStep: step + 1, wantOK: true},
+		{name: "two periods old", secret: rfcSecret, code: code(now.Add(-2 * TOTPPeriod))},
+		{name: "spaces are ignored", secret: rfcSecret, code: " " + code(now)[:3] + " " + code(now)[3:], wantStep: step, wantOK: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: code(now), wantStep: step, wantOK: true},
+		{name: "wrong code", secret: rfcSecret, code: "000000"},
+		{name: "too short", secret: rfcSecret, code: code(now)[:5]},
+		{name: "too long", secret: rfcSecret, code: code(now) + "0"},
+		{name: "empty", secret: rfcSecret, code: ""},
+		{name: "invalid secret", secret: "not base32!", code: code(now)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = %v, %v, want %v, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %v characters, want 32", secret, len(secret))
+	}
+	if _, err := TOTPCode(secret, time.Now()); err != nil {
+		t.Errorf("generated secret can't be used: %v", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %v codes and %v hashes, want 10 of each", len(codes), len(hashes))
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 14 || code[4] != '-' || code[9] != '-' {
+			t.Errorf("code %q is not formatted as xxxx-xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q was generated twice", code)
+		}
+		seen[code] = true
+		if HashRecoveryCode(code) != hashes[i] {
+			t.Errorf("hash of code %v does not match the stored hash", i)
+		}
+	}
+
+	// codes can be typed without separators, with spaces or in capitals
+	code := codes[0]
+	tests := []struct {
+		name  string
+		typed string
+		match bool
+	}{
+		{name: "as shown", typed: code, match: true},
+		{name: "uppercase", typed: strings.ToUpper(code), match: true},
+		{name: "no separators", typed: strings.ReplaceAll(code, "-", ""), match: true},
+		{name: "spaces", typed: strings.ReplaceAll(code, "-", " "), match: true},
+		{name: "another code", typed: codes[1]},
+		{name: "truncated", typed: code[:len(code)-1]},
+	}
+	for _, tt := range tests {
+		if got := HashRecoveryCode(tt.typed) == hashes[0]; got != tt.match {
+			t.Errorf("%v: %q matches = %v, want %v", tt.name, tt.typed, got, tt.match)
+		}
+	}
+}
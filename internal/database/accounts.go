@@ -0,0 +1,214 @@
+package database
+
+import (
+	"log"
+	"sort"
+)
+
+// UserData is everything stored about one user, gathered for a data export
+
+type UserData struct {
+	User            User
+	Chirps          []Chirp
+	Following       []Follow
+	Followers       []Follow
+	Bookmarks       []Bookmark
+	Votes           map[int]int
+	Reports         []Report
+	Decisions       []Decision
+	RemoteFollowers []RemoteFollower
+	Blocks          []Block
+	Mutes           []Mute
+}
+
+// ExportUser collects the user's account, chirps and every record that refers to them
+
+func (db *DB) ExportUser(id int) (UserData, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return UserData{}, err
+	}
+	user, ok := dbStructure.Users[id]
+	if !ok {
+		return UserData{}, ErrNotExist
+	}
+
+	data := UserData{
+		User:            user,
+		Chirps:          []Chirp{},
+		Following:       []Follow{},
+		Followers:       []Follow{},
+		Bookmarks:       []Bookmark{},
+		Votes:           map[int]int{},
+		Reports:         []Report{},
+		Decisions:       []Decision{},
+		RemoteFollowers: []RemoteFollower{},
+		Blocks:          []Block{},
+		Mutes:           []Mute{},
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.Author == id {
+			data.Chirps = append(data.Chirps, chirp)
+		}
+		if chirp.Poll != nil {
+			if option, ok := chirp.Poll.Votes[id]; ok {
+				data.Votes[chirp.ID] = option
+			}
+		}
+	}
+	for _, f := range dbStructure.Follows {
+		if f.Follower == id {
+			data.Following = append(data.Following, f)
+		}
+		if f.Followee == id {
+			data.Followers = append(data.Followers, f)
+		}
+	}
+	for _, b := range dbStructure.Bookmarks {
+		if b.UserID == id {
+			data.Bookmarks = append(data.Bookmarks, b)
+		}
+	}
+	for _, r := range dbStructure.Reports {
+		if r.Reporter == id {
+			data.Reports = append(data.Reports, r)
+		}
+	}
+	for _, d := range dbStructure.Decisions {
+		if d.Moderator == id {
+			data.Decisions = append(data.Decisions, d)
+		}
+	}
+	for _, f := range dbStructure.RemoteFollowers {
+		if f.UserID == id {
+			data.RemoteFollowers = append(data.RemoteFollowers, f)
+		}
+	}
+	for _, b := range dbStructure.Blocks {
+		if b.Blocker == id {
+			data.Blocks = append(data.Blocks, b)
+		}
+	}
+	for _, m := range dbStructure.Mutes {
+		if m.Muter == id {
+			data.Mutes = append(data.Mutes, m)
+		}
+	}
+
+	sort.Slice(data.Chirps, func(i, j int) bool { return data.Chirps[i].ID < data.Chirps[j].ID })
+	sort.Slice(data.Following, func(i, j int) bool { return data.Following[i].ID < data.Following[j].ID })
+	sort.Slice(data.Followers, func(i, j int) bool { return data.Followers[i].ID < data.Followers[j].ID })
+	sort.Slice(data.Bookmarks, func(i, j int) bool { return data.Bookmarks[i].ID < data.Bookmarks[j].ID })
+	sort.Slice(data.Reports, func(i, j int) bool { return data.Reports[i].ID < data.Reports[j].ID })
+	sort.Slice(data.Decisions, func(i, j int) bool { return data.Decisions[i].ID < data.Decisions[j].ID })
+	sort.Slice(data.RemoteFollowers, func(i, j int) bool { return data.RemoteFollowers[i].ID < data.RemoteFollowers[j].ID })
+	sort.Slice(data.Blocks, func(i, j int) bool { return data.Blocks[i].ID < data.Blocks[j].ID })
+	sort.Slice(data.Mutes, func(i, j int) bool { return data.Mutes[i].ID < data.Mutes[j].ID })
+	return data, nil
+}
+
+/* DeleteUser removes the user, their chirps, tokens, follows, blocks, mutes, bookmarks and votes in a single write
+reports they filed and moderation and admin actions they took are kept for the record with the user ID cleared,
+the deleted user is returned so callers can clean up files such as their avatar */
+
+func (db *DB) DeleteUser(id int) (User, error) {
+	user := User{}
+	removed := []Chirp{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		// 1: the user's own chirps go entirely, along with the bookmarks and views that point at them
+
+		for chirpID, chirp := range dbStructure.Chirps {
+			if chirp.Author == id {
+				removed = append(removed, chirp)
+				dbStructure.removeChirp(chirpID)
+			}
+		}
+
+		// 2: their votes and place among direct recipients come off everyone else's chirps
+
+		for chirpID, chirp := range dbStructure.Chirps {
+			if chirp.Poll != nil {
+				delete(chirp.Poll.Votes, id)
+			}
+			chirp.Recipients = removeID(chirp.Recipients, id)
+			dbStructure.Chirps[chirpID] = chirp
+		}
+
+		// 3: relations and credentials
+
+		for followID, f := range dbStructure.Follows {
+			if f.Follower == id || f.Followee == id {
+				delete(dbStructure.Follows, followID)
+			}
+		}
+		for blockID, b := range dbStructure.Blocks {
+			if b.Blocker == id || b.Blocked == id {
+				delete(dbStructure.Blocks, blockID)
+			}
+		}
+		for muteID, m := range dbStructure.Mutes {
+			if m.Muter == id || m.Muted == id {
+				delete(dbStructure.Mutes, muteID)
+			}
+		}
+		for bookmarkID, b := range dbStructure.Bookmarks {
+			if b.UserID == id {
+				delete(dbStructure.Bookmarks, bookmarkID)
+			}
+		}
+		for body, token := range dbStructure.Tokens {
+			if token.ID == id {
+				delete(dbStructure.Tokens, body)
+			}
+		}
+		for hash, reset := range dbStructure.PasswordResets {
+			if reset.UserID == id {
+				delete(dbStructure.PasswordResets, hash)
+			}
+		}
+		for followerID, f := range dbStructure.RemoteFollowers {
+			if f.UserID == id {
+				delete(dbStructure.RemoteFollowers, followerID)
+			}
+		}
+		delete(dbStructure.ActorKeys, id)
+
+		// 4: anonymize the moderation and admin records
+
+		for reportID, r := range dbStructure.Reports {
+			if r.Reporter == id {
+				r.Reporter = 0
+				dbStructure.Reports[reportID] = r
+			}
+		}
+		for decisionID, d := range dbStructure.Decisions {
+			if d.Moderator == id {
+				d.Moderator = 0
+				dbStructure.Decisions[decisionID] = d
+			}
+		}
+		for actionID, a := range dbStructure.AdminActions {
+			if a.Admin == id {
+				a.Admin = 0
+				dbStructure.AdminActions[actionID] = a
+			}
+		}
+
+		dbStructure.NextUserID = dbStructure.nextUserID()
+		delete(dbStructure.Users, id)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	log.Printf("DB: Deleted user %v and %v chirps", id, len(removed))
+	db.emit(ChangeChirpDeleted, removed...)
+	return user, nil
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// accountFixture is a user connected to other users through every kind of record the database keeps about them
+
+type accountFixture struct {
+	db       *DB
+	user     User
+	other    User
+	third    User
+	own      Chirp
+	poll     Chirp
+	direct   Chirp
+	decision Decision
+}
+
+func newAccountFixture(t *testing.T) accountFixture {
+	t.Helper()
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("other@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := db.CreateUser("third@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	own, err := db.CreateChirp(Chirp{Author: user.ID, Body: "mine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll, err := db.CreateChirp(Chirp{Author: other.ID, Body: "vote", Poll: &Poll{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := db.CreateChirp(Chirp{Author: other.ID, Body: "psst", Visibility: VisibilityDirect, Recipients: []int{user.ID, third.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Vote(poll.ID, user.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range [][2]int{{user.ID, other.ID}, {other.ID, user.ID}} {
+		_, err = db.CreateFollow(f[0], f[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.CreateBlock(user.ID, third.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateMute(other.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateBookmark(user.ID, poll.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateBookmark(other.ID, own.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateReport(direct.ID, user.ID, "spam", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decision, err := db.ModerateChirp(direct.ID, user.ID, DecisionDismiss, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.RecordAdminAction(AdminAction{Admin: user.ID, Target: other.ID, Action: AdminActionLogout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddViews(map[int]map[string]int{own.ID: {"2026-01-01": 3}, poll.ID: {"2026-01-01": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []struct {
+		body string
+		id   int
+	}{{"user-session", user.ID}, {"other-session", other.ID}} {
+		_, err = db.CreateToken(token.body, token.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.CreatePasswordReset(user.ID, "reset", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return accountFixture{db: db, user: user, other: other, third: third, own: own, poll: poll, direct: direct, decision: decision}
+}
+
+func TestExportUser(t *testing.T) {
+	f := newAccountFixture(t)
+
+	data, err := f.db.ExportUser(f.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.User.ID != f.user.ID {
+		t.Errorf("user = %v, want %v", data.User.ID, f.user.ID)
+	}
+	if len(data.Chirps) != 1 || data.Chirps[0].ID != f.own.ID {
+		t.Errorf("chirps = %+v, want only chirp %v", data.Chirps, f.own.ID)
+	}
+	if len(data.Following) != 1 || data.Following[0].Followee != f.other.ID {
+		t.Errorf("following = %+v", data.Following)
+	}
+	if len(data.Followers) != 1 || data.Followers[0].Follower != f.other.ID {
+		t.Errorf("followers = %+v", data.Followers)
+	}
+	if len(data.Bookmarks) != 1 || data.Bookmarks[0].ChirpID != f.poll.ID {
+		t.Errorf("bookmarks = %+v, want only their own", data.Bookmarks)
+	}
+	if len(data.Votes) != 1 || data.Votes[f.poll.ID] != 1 {
+		t.Errorf("votes = %v", data.Votes)
+	}
+	if len(data.Reports) != 1 || len(data.Decisions) != 1 || len(data.Blocks) != 1 {
+		t.Errorf("reports, decisions, blocks = %+v, %+v, %+v", data.Reports, data.Decisions, data.Blocks)
+	}
+	// a mute is private to the muter, so it only shows up in their own export
+	if len(data.Mutes) != 0 {
+		t.Errorf("mutes = %+v, want none", data.Mutes)
+	}
+
+	if _, err := f.db.ExportUser(404); !errors.Is(err, ErrNotExist) {
+		t.Errorf("ExportUser(404) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	f := newAccountFixture(t)
+	deleted := []int{}
+	f.db.OnChange(func(change Change) {
+		if change.Type == ChangeChirpDeleted {
+			deleted = append(deleted, change.Chirp.ID)
+		}
+	})
+
+	got, err := f.db.DeleteUser(f.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != f.user.ID {
+		t.Errorf("DeleteUser() = %v, want the deleted user", got.ID)
+	}
+	if len(deleted) != 1 || deleted[0] != f.own.ID {
+		t.Errorf("deleted chirps = %v, want %v", deleted, f.own.ID)
+	}
+	if _, err := f.db.DeleteUser(f.user.ID); !errors.Is(err, ErrNotExist) {
+		t.Errorf("second DeleteUser() error = %v, want ErrNotExist", err)
+	}
+
+	dbStructure, err := f.db.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dbStructure.Users[f.user.ID]; ok {
+		t.Error("user survived")
+	}
+	if _, ok := dbStructure.Chirps[f.own.ID]; ok || dbStructure.Views[f.own.ID] != nil {
+		t.Error("their chirp or its views survived")
+	}
+	if dbStructure.Views[f.poll.ID]["2026-01-01"] != 2 {
+		t.Errorf("views of other chirps = %v, want them kept", dbStructure.Views)
+	}
+	if _, voted := dbStructure.Chirps[f.poll.ID].Poll.Votes[f.user.ID]; voted {
+		t.Error("their vote survived")
+	}
+	if recipients := dbStructure.Chirps[f.direct.ID].Recipients; len(recipients) != 1 || recipients[0] == f.user.ID {
+		t.Errorf("recipients = %v, want only the third user", recipients)
+	}
+	if len(dbStructure.Follows) != 0 || len(dbStructure.Blocks) != 0 || len(dbStructure.Mutes) != 0 || len(dbStructure.Bookmarks) != 0 {
+		t.Errorf("follows, blocks, mutes, bookmarks = %v, %v, %v, %v, want all gone", dbStructure.Follows, dbStructure.Blocks, dbStructure.Mutes, dbStructure.Bookmarks)
+	}
+	if _, ok := dbStructure.Tokens["other-session"]; len(dbStructure.Tokens) != 1 || !ok {
+		t.Errorf("refresh tokens = %v, want only the other user's", dbStructure.Tokens)
+	}
+	if len(dbStructure.PasswordResets) != 0 {
+		t.Errorf("password resets = %v", dbStructure.PasswordResets)
+	}
+
+	// the records of what they did stay, without saying who did it
+	for _, r := range dbStructure.Reports {
+		if r.Reporter != 0 {
+			t.Errorf("report %v still names reporter %v", r.ID, r.Reporter)
+		}
+	}
+	if d := dbStructure.Decisions[f.decision.ID]; d.ID == 0 || d.Moderator != 0 {
+		t.Errorf("decision = %+v, want kept with the moderator cleared", d)
+	}
+	if len(dbStructure.AdminActions) != 1 {
+		t.Errorf("admin actions = %v, want kept", dbStructure.AdminActions)
+	}
+	for _, a := range dbStructure.AdminActions {
+		if a.Admin != 0 {
+			t.Errorf("admin action %v still names admin %v", a.ID, a.Admin)
+		}
+	}
+
+	// the newest ID is never handed to a new account either, which would inherit anything still pointing at it
+	_, err = f.db.DeleteUser(f.third.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := f.db.CreateUser("new@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID <= f.third.ID {
+		t.Errorf("new user ID = %v, want above %v", user.ID, f.third.ID)
+	}
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	AdminActionSuspend     = "suspend"
+	AdminActionBan         = "ban"
+	AdminActionReinstate   = "reinstate"
+	AdminActionLogout      = "logout"
+	AdminActionImpersonate = "impersonate"
+)
+
+// AdminAction is an entry in the audit log of what admins did to user accounts
+
+type AdminAction struct {
+	ID        int        `json:"id"`
+	Admin     int        `json:"admin_id"`
+	Target    int        `json:"target_id"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Suspended reports whether the user is banned or their suspension has not yet ended
+
+func (u User) Suspended(now time.Time) bool {
+	return u.Banned || (u.SuspendedUntil != nil && now.Before(*u.SuspendedUntil))
+}
+
+// SuspendUser suspends the user until the given time and signs them out everywhere
+
+func (db *DB) SuspendUser(id int, admin int, until time.Time, reason string) (User, error) {
+	return db.applyAdminAction(AdminAction{
+		Admin:     admin,
+		Target:    id,
+		Action:    AdminActionSuspend,
+		Reason:    reason,
+		ExpiresAt: &until,
+	}, func(user *User) {
+		user.SuspendedUntil = &until
+		user.SuspensionReason = reason
+	})
+}
+
+// BanUser suspends the user indefinitely and signs them out everywhere
+
+func (db *DB) BanUser(id int, admin int, reason string) (User, error) {
+	return db.applyAdminAction(AdminAction{
+		Admin:  admin,
+		Target: id,
+		Action: AdminActionBan,
+		Reason: reason,
+	}, func(user *User) {
+		user.Banned = true
+		user.SuspensionReason = reason
+	})
+}
+
+// ReinstateUser lifts a suspension or ban
+
+func (db *DB) ReinstateUser(id int, admin int, reason string) (User, error) {
+	return db.applyAdminAction(AdminAction{
+		Admin:  admin,
+		Target: id,
+		Action: AdminActionReinstate,
+		Reason: reason,
+	}, func(user *User) {
+		user.Banned = false
+		user.SuspendedUntil = nil
+		user.SuspensionReason = ""
+	})
+}
+
+// LogoutUser revokes every refresh token of the user, ending their sessions once current access tokens expire
+
+func (db *DB) LogoutUser(id int, admin int, reason string) (User, error) {
+	return db.applyAdminAction(AdminAction{
+		Admin:  admin,
+		Target: id,
+		Action: AdminActionLogout,
+		Reason: reason,
+	}, nil)
+}
+
+// RecordAdminAction adds an action which changes nothing in the database, such as an impersonation, to the audit log
+
+func (db *DB) RecordAdminAction(action AdminAction) (AdminAction, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[action.Target]; !ok {
+			return ErrNotExist
+		}
+		action = dbStructure.addAdminAction(action)
+		return nil
+	})
+	if err != nil {
+		return AdminAction{}, err
+	}
+	return action, nil
+}
+
+// GetAdminActions returns the whole audit log
+
+func (db *DB) GetAdminActions() ([]AdminAction, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]AdminAction, 0, len(dbStructure.AdminActions))
+	for _, a := range dbStructure.AdminActions {
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+/* applyAdminAction updates the target user, revokes their refresh tokens unless the action is a reinstatement
+and records the action, all in a single write; update may be nil for actions that only revoke tokens */
+
+func (db *DB) applyAdminAction(action AdminAction, update func(user *User)) (User, error) {
+	user := User{}
+	revoked := 0
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[action.Target]
+		if !ok {
+			return ErrNotExist
+		}
+		if update != nil {
+			update(&user)
+			dbStructure.Users[user.ID] = user
+		}
+
+		if action.Action != AdminActionReinstate {
+			for body, token := range dbStructure.Tokens {
+				if token.ID == user.ID {
+					delete(dbStructure.Tokens, body)
+					revoked++
+				}
+			}
+		}
+		dbStructure.addAdminAction(action)
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	log.Printf("DB: Admin %v applied %v to user %v, revoked %v refresh tokens", action.Admin, action.Action, user.ID, revoked)
+	return user, nil
+}
+
+func (dbStructure *DBStructure) addAdminAction(action AdminAction) AdminAction {
+	id := 1
+	for existing := range dbStructure.AdminActions {
+		if existing >= id {
+			id = existing + 1
+		}
+	}
+	action.ID = id
+	action.CreatedAt = time.Now().UTC()
+	dbStructure.AdminActions[id] = action
+	return action
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuspended(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	tests := []struct {
+		name string
+		user User
+		want bool
+	}{
+		{name: "active"},
+		{name: "suspended", user: User{SuspendedUntil: &future}, want: true},
+		{name: "suspension over", user: User{SuspendedUntil: &past}},
+		{name: "banned", user: User{Banned: true}, want: true},
+		{name: "banned after a suspension ended", user: User{Banned: true, SuspendedUntil: &past}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.Suspended(now); got != tt.want {
+				t.Errorf("Suspended() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const admin = 99
+	until := time.Now().Add(time.Hour).UTC()
+
+	// the cases run in order against the same user, each starting with a fresh session to see which actions end it
+	tests := []struct {
+		name        string
+		action      string
+		apply       func() (User, error)
+		wantBanned  bool
+		wantUntil   bool
+		wantRevoked bool
+	}{
+		{name: "suspend", action: AdminActionSuspend, apply: func() (User, error) { return db.SuspendUser(user.ID, admin, until, "spam") }, wantUntil: true, wantRevoked: true},
+		{name: "ban", action: AdminActionBan, apply: func() (User, error) { return db.BanUser(user.ID, admin, "spam") }, wantBanned: true, wantUntil: true, wantRevoked: true},
+		{name: "reinstate", action: AdminActionReinstate, apply: func() (User, error) { return db.ReinstateUser(user.ID, admin, "appeal") }},
+		{name: "logout", action: AdminActionLogout, apply: func() (User, error) { return db.LogoutUser(user.ID, admin, "") }, wantRevoked: true},
+	}
+	for i, tt := range tests {
+		session := tt.name + "-session"
+		_, err := db.CreateToken(session, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := tt.apply()
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if got.Banned != tt.wantBanned || (got.SuspendedUntil != nil) != tt.wantUntil {
+			t.Errorf("%v: banned = %v, suspended until %v", tt.name, got.Banned, got.SuspendedUntil)
+		}
+		if _, err := db.GetToken(session); (err != nil) != tt.wantRevoked {
+			t.Errorf("%v: GetToken() error = %v, want revoked %v", tt.name, err, tt.wantRevoked)
+		}
+
+		actions, err := db.GetAdminActions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actions) != i+1 {
+			t.Fatalf("%v: %v audit entries, want %v", tt.name, len(actions), i+1)
+		}
+		for _, a := range actions {
+			if a.ID == i+1 && (a.Action != tt.action || a.Admin != admin || a.Target != user.ID || a.CreatedAt.IsZero()) {
+				t.Errorf("%v: audit entry = %+v", tt.name, a)
+			}
+		}
+	}
+
+	stored, err := db.GetSingleUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Suspended(time.Now()) || stored.SuspensionReason != "" {
+		t.Errorf("user after reinstating = %+v, want active", stored)
+	}
+
+	// nothing is recorded against users who don't exist
+	for name, apply := range map[string]func() (User, error){
+		"suspend":   func() (User, error) { return db.SuspendUser(404, admin, until, "") },
+		"ban":       func() (User, error) { return db.BanUser(404, admin, "") },
+		"reinstate": func() (User, error) { return db.ReinstateUser(404, admin, "") },
+		"logout":    func() (User, error) { return db.LogoutUser(404, admin, "") },
+		"record": func() (User, error) {
+			_, err := db.RecordAdminAction(AdminAction{Admin: admin, Target: 404, Action: AdminActionImpersonate})
+			return User{}, err
+		},
+	} {
+		if _, err := apply(); !errors.Is(err, ErrNotExist) {
+			t.Errorf("%v of a missing user error = %v, want ErrNotExist", name, err)
+		}
+	}
+	if actions, err := db.GetAdminActions(); err != nil || len(actions) != len(tests) {
+		t.Errorf("GetAdminActions() = %v entries, %v, want %v", len(actions), err, len(tests))
+	}
+}
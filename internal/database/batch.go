@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrBatchFailed = errors.New("batch contains invalid operations, nothing was applied")
+
+// BatchOp is a single create or delete inside a batch; Create is nil for deletes
+
+type BatchOp struct {
+	Create *Chirp
+	Delete int
+}
+
+type BatchResult struct {
+	Chirp Chirp
+	Err   error
+}
+
+/* ApplyBatch runs every operation inside one locked update, so the batch sees and replaces a single consistent copy
+deletes are checked against that copy with canDelete, and if any operation fails nothing is written
+and ErrBatchFailed is returned alongside the per-item results */
+
+func (db *DB) ApplyBatch(subject int, ops []BatchOp, canDelete func(chirp Chirp) error) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	err := db.update(func(dbStructure *DBStructure) error {
+		nextID := dbStructure.nextChirpID()
+		now := time.Now().UTC()
+		failed := false
+		for i, op := range ops {
+			if op.Create != nil {
+				chirp := *op.Create
+				chirp.ID = nextID
+				chirp.Author = subject
+				chirp.CreatedAt = now
+				chirp.Flagged = len(chirp.FlagReasons) > 0
+				if chirp.Visibility == "" {
+					chirp.Visibility = VisibilityPublic
+				}
+				dbStructure.Chirps[chirp.ID] = chirp
+				dbStructure.touchFeed(subject)
+				nextID++
+				dbStructure.NextChirpID = nextID
+				results[i] = BatchResult{Chirp: chirp}
+				continue
+			}
+
+			chirp, ok := dbStructure.Chirps[op.Delete]
+			if !ok {
+				results[i] = BatchResult{Err: ErrNotExist}
+				failed = true
+				continue
+			}
+			err := canDelete(chirp)
+			if err != nil {
+				results[i] = BatchResult{Err: err}
+				failed = true
+				continue
+			}
+			dbStructure.removeChirp(op.Delete)
+			results[i] = BatchResult{Chirp: chirp}
+		}
+
+		if failed {
+			return ErrBatchFailed
+		}
+		return nil
+	})
+	if errors.Is(err, ErrBatchFailed) {
+		return results, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("DB: Applied batch of %v operations for user %v", len(ops), subject)
+	for i, op := range ops {
+		if op.Create != nil {
+			db.emit(ChangeChirpCreated, results[i].Chirp)
+		} else {
+			db.emit(ChangeChirpDeleted, results[i].Chirp)
+		}
+	}
+	return results, nil
+}
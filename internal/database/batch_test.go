@@ -0,0 +1,109 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyBatch(t *testing.T) {
+	errNotYours := errors.New("not yours")
+	tests := []struct {
+		name       string
+		ops        func(own int, other int) []BatchOp
+		wantErr    error
+		wantErrs   []error
+		wantChirps int
+	}{
+		{
+			name: "creates and deletes",
+			ops: func(own int, other int) []BatchOp {
+				return []BatchOp{{Create: &Chirp{Body: "one"}}, {Delete: own}, {Create: &Chirp{Body: "two"}}}
+			},
+			wantErrs:   []error{nil, nil, nil},
+			wantChirps: 3,
+		},
+		{
+			name: "missing chirp rolls back",
+			ops: func(own int, other int) []BatchOp {
+				return []BatchOp{{Create: &Chirp{Body: "one"}}, {Delete: own}, {Delete: 404}}
+			},
+			wantErr:    ErrBatchFailed,
+			wantErrs:   []error{nil, nil, ErrNotExist},
+			wantChirps: 2,
+		},
+		{
+			name: "refused delete rolls back",
+			ops: func(own int, other int) []BatchOp {
+				return []BatchOp{{Delete: own}, {Delete: other}, {Create: &Chirp{Body: "one"}}}
+			},
+			wantErr:    ErrBatchFailed,
+			wantErrs:   []error{nil, errNotYours, nil},
+			wantChirps: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			own, err := db.CreateChirp(Chirp{Author: 1, Body: "mine"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := db.CreateChirp(Chirp{Author: 2, Body: "theirs"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes := 0
+			db.OnChange(func(Change) { changes++ })
+
+			ops := tt.ops(own.ID, other.ID)
+			results, err := db.ApplyBatch(1, ops, func(chirp Chirp) error {
+				if chirp.Author != 1 {
+					return errNotYours
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ApplyBatch() error = %v, want %v", err, tt.wantErr)
+			}
+			for i, result := range results {
+				if !errors.Is(result.Err, tt.wantErrs[i]) {
+					t.Errorf("result %v error = %v, want %v", i, result.Err, tt.wantErrs[i])
+				}
+				if ops[i].Create != nil && tt.wantErr == nil && (result.Chirp.ID == 0 || result.Chirp.Author != 1 || result.Chirp.Visibility != VisibilityPublic) {
+					t.Errorf("created chirp %v = %+v", i, result.Chirp)
+				}
+			}
+
+			chirps, err := db.GetChirps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != tt.wantChirps {
+				t.Errorf("chirps = %+v, want %v", chirps, tt.wantChirps)
+			}
+			wantChanges := len(ops)
+			if tt.wantErr != nil {
+				wantChanges = 0
+			}
+			if changes != wantChanges {
+				t.Errorf("changes = %v, want %v", changes, wantChanges)
+			}
+		})
+	}
+}
+
+func TestApplyBatchNeverReusesIDs(t *testing.T) {
+	db := newTestDB(t)
+	chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "newest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := db.ApplyBatch(1, []BatchOp{{Delete: chirp.ID}, {Create: &Chirp{Body: "one"}}, {Create: &Chirp{Body: "two"}}}, func(Chirp) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1].Chirp.ID != chirp.ID+1 || results[2].Chirp.ID != chirp.ID+2 {
+		t.Errorf("created IDs = %v and %v after deleting %v", results[1].Chirp.ID, results[2].Chirp.ID, chirp.ID)
+	}
+}
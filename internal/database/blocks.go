@@ -0,0 +1,197 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrAlreadyBlocked = errors.New("already blocking user")
+	ErrAlreadyMuted   = errors.New("already muting user")
+	ErrBlocked        = errors.New("one of these users has blocked the other")
+)
+
+type Block struct {
+	ID        int       `json:"id"`
+	Blocker   int       `json:"blocker_id"`
+	Blocked   int       `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Mute struct {
+	ID        int       `json:"id"`
+	Muter     int       `json:"muter_id"`
+	Muted     int       `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateBlock blocks a user and removes any follows between the two in the same write
+
+func (db *DB) CreateBlock(blocker int, blocked int) (Block, error) {
+	block := Block{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[blocked]; !ok {
+			return ErrNotExist
+		}
+
+		id := 1
+		for _, b := range dbStructure.Blocks {
+			if b.Blocker == blocker && b.Blocked == blocked {
+				return ErrAlreadyBlocked
+			}
+			if b.ID >= id {
+				id = b.ID + 1
+			}
+		}
+
+		block = Block{
+			ID:        id,
+			Blocker:   blocker,
+			Blocked:   blocked,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Blocks[id] = block
+		for followID, f := range dbStructure.Follows {
+			if (f.Follower == blocker && f.Followee == blocked) || (f.Follower == blocked && f.Followee == blocker) {
+				delete(dbStructure.Follows, followID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Block{}, err
+	}
+
+	log.Printf("DB: User %v blocked user %v", blocker, blocked)
+	return block, nil
+}
+
+func (db *DB) DeleteBlock(blocker int, blocked int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for id, b := range dbStructure.Blocks {
+			if b.Blocker == blocker && b.Blocked == blocked {
+				delete(dbStructure.Blocks, id)
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+func (db *DB) CreateMute(muter int, muted int) (Mute, error) {
+	mute := Mute{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[muted]; !ok {
+			return ErrNotExist
+		}
+
+		id := 1
+		for _, m := range dbStructure.Mutes {
+			if m.Muter == muter && m.Muted == muted {
+				return ErrAlreadyMuted
+			}
+			if m.ID >= id {
+				id = m.ID + 1
+			}
+		}
+
+		mute = Mute{
+			ID:        id,
+			Muter:     muter,
+			Muted:     muted,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Mutes[id] = mute
+		return nil
+	})
+	if err != nil {
+		return Mute{}, err
+	}
+
+	log.Printf("DB: User %v muted user %v", muter, muted)
+	return mute, nil
+}
+
+func (db *DB) DeleteMute(muter int, muted int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for id, m := range dbStructure.Mutes {
+			if m.Muter == muter && m.Muted == muted {
+				delete(dbStructure.Mutes, id)
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+// GetBlocks returns the blocks the user has made
+
+func (db *DB) GetBlocks(blocker int) ([]Block, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []Block{}
+	for _, b := range dbStructure.Blocks {
+		if b.Blocker == blocker {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+// GetMutes returns the mutes the user has made
+
+func (db *DB) GetMutes(muter int) ([]Mute, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	mutes := []Mute{}
+	for _, m := range dbStructure.Mutes {
+		if m.Muter == muter {
+			mutes = append(mutes, m)
+		}
+	}
+	return mutes, nil
+}
+
+/* GetHiddenUsers returns the users hidden from userID:
+blocked holds everyone userID has blocked or been blocked by, since a block separates both users,
+muted holds everyone userID has muted */
+
+func (db *DB) GetHiddenUsers(userID int) (map[int]struct{}, map[int]struct{}, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocked := map[int]struct{}{}
+	for _, b := range dbStructure.Blocks {
+		if b.Blocker == userID {
+			blocked[b.Blocked] = struct{}{}
+		}
+		if b.Blocked == userID {
+			blocked[b.Blocker] = struct{}{}
+		}
+	}
+	muted := map[int]struct{}{}
+	for _, m := range dbStructure.Mutes {
+		if m.Muter == userID {
+			muted[m.Muted] = struct{}{}
+		}
+	}
+	return blocked, muted, nil
+}
+
+func (dbStructure *DBStructure) isBlocked(a int, b int) bool {
+	for _, block := range dbStructure.Blocks {
+		if (block.Blocker == a && block.Blocked == b) || (block.Blocker == b && block.Blocked == a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateBlock(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("other@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range [][2]int{{user.ID, other.ID}, {other.ID, user.ID}} {
+		_, err = db.CreateFollow(f[0], f[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the cases run in order against the same database
+	tests := []struct {
+		name    string
+		blocked int
+		wantErr error
+	}{
+		{name: "block", blocked: other.ID},
+		{name: "block twice", blocked: other.ID, wantErr: ErrAlreadyBlocked},
+		{name: "missing user", blocked: 404, wantErr: ErrNotExist},
+	}
+	for _, tt := range tests {
+		block, err := db.CreateBlock(user.ID, tt.blocked)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: CreateBlock() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (block.ID == 0 || block.Blocker != user.ID || block.Blocked != tt.blocked) {
+			t.Errorf("%v: CreateBlock() = %+v", tt.name, block)
+		}
+	}
+
+	// blocking drops the follows in both directions and stops either user following the other again
+	for _, id := range []int{user.ID, other.ID} {
+		following, err := db.GetFollowing(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(following) != 0 {
+			t.Errorf("user %v still follows %v", id, following)
+		}
+	}
+	for _, f := range [][2]int{{user.ID, other.ID}, {other.ID, user.ID}} {
+		if _, err := db.CreateFollow(f[0], f[1]); !errors.Is(err, ErrBlocked) {
+			t.Errorf("CreateFollow(%v, %v) error = %v, want ErrBlocked", f[0], f[1], err)
+		}
+	}
+
+	blocks, err := db.GetBlocks(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Blocked != other.ID {
+		t.Errorf("GetBlocks() = %+v", blocks)
+	}
+	if blocks, err := db.GetBlocks(other.ID); err != nil || len(blocks) != 0 {
+		t.Errorf("GetBlocks() for the blocked user = %+v, %v, want none", blocks, err)
+	}
+
+	err = db.DeleteBlock(user.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteBlock(user.ID, other.ID); !errors.Is(err, ErrNotExist) {
+		t.Errorf("second DeleteBlock() error = %v, want ErrNotExist", err)
+	}
+	if _, err := db.CreateFollow(other.ID, user.ID); err != nil {
+		t.Errorf("CreateFollow() after unblocking error = %v", err)
+	}
+}
+
+func TestCreateMute(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("other@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateFollow(user.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same database
+	tests := []struct {
+		name    string
+		muted   int
+		wantErr error
+	}{
+		{name: "mute", muted: other.ID},
+		{name: "mute twice", muted: other.ID, wantErr: ErrAlreadyMuted},
+		{name: "missing user", muted: 404, wantErr: ErrNotExist},
+	}
+	for _, tt := range tests {
+		_, err := db.CreateMute(user.ID, tt.muted)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: CreateMute() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// muting is quieter than blocking and leaves the follow in place
+	following, err := db.GetFollowing(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := following[other.ID]; !ok {
+		t.Error("muting removed the follow")
+	}
+
+	err = db.DeleteMute(user.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteMute(user.ID, other.ID); !errors.Is(err, ErrNotExist) {
+		t.Errorf("second DeleteMute() error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestGetHiddenUsers(t *testing.T) {
+	db := newTestDB(t)
+	ids := []int{}
+	for _, email := range []string{"user@example.com", "blocked@example.com", "blocker@example.com", "muted@example.com", "muter@example.com"} {
+		u, err := db.CreateUser(email, "hash", false, ActorKey{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+	}
+	user, blocked, blocker, muted, muter := ids[0], ids[1], ids[2], ids[3], ids[4]
+	for _, b := range [][2]int{{user, blocked}, {blocker, user}} {
+		_, err := db.CreateBlock(b[0], b[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range [][2]int{{user, muted}, {muter, user}} {
+		_, err := db.CreateMute(m[0], m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gotBlocked, gotMuted, err := db.GetHiddenUsers(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a block separates both users whoever made it, a mute only hides the muted user from the muter
+	_, hasBlocked := gotBlocked[blocked]
+	_, hasBlocker := gotBlocked[blocker]
+	if len(gotBlocked) != 2 || !hasBlocked || !hasBlocker {
+		t.Errorf("blocked = %v, want %v and %v", gotBlocked, blocked, blocker)
+	}
+	if _, ok := gotMuted[muted]; len(gotMuted) != 1 || !ok {
+		t.Errorf("muted = %v, want only %v", gotMuted, muted)
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrAlreadyBookmarked = errors.New("chirp already bookmarked")
+
+type Bookmark struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ChirpID   int       `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateBookmark(userID int, chirpID int) (Bookmark, error) {
+	bookmark := Bookmark{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Chirps[chirpID]; !ok {
+			return ErrNotExist
+		}
+
+		id := 1
+		for _, b := range dbStructure.Bookmarks {
+			if b.UserID == userID && b.ChirpID == chirpID {
+				return ErrAlreadyBookmarked
+			}
+			if b.ID >= id {
+				id = b.ID + 1
+			}
+		}
+
+		bookmark = Bookmark{
+			ID:        id,
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Bookmarks[id] = bookmark
+		return nil
+	})
+	if err != nil {
+		return Bookmark{}, err
+	}
+	return bookmark, nil
+}
+
+func (db *DB) DeleteBookmark(userID int, chirpID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for id, b := range dbStructure.Bookmarks {
+			if b.UserID == userID && b.ChirpID == chirpID {
+				delete(dbStructure.Bookmarks, id)
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+// GetBookmarks returns the user's bookmarks along with the chirps they point at
+
+func (db *DB) GetBookmarks(userID int) ([]Bookmark, map[int]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookmarks := []Bookmark{}
+	chirps := map[int]Chirp{}
+	for _, b := range dbStructure.Bookmarks {
+		if b.UserID != userID {
+			continue
+		}
+		chirp, ok := dbStructure.Chirps[b.ChirpID]
+		if !ok {
+			continue
+		}
+		bookmarks = append(bookmarks, b)
+		chirps[chirp.ID] = chirp
+	}
+	return bookmarks, chirps, nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	db := newTestDB(t)
+	chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "saved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same database
+	tests := []struct {
+		name    string
+		action  func() error
+		wantErr error
+	}{
+		{name: "bookmark", action: func() error {
+			_, err := db.CreateBookmark(2, chirp.ID)
+			return err
+		}},
+		{name: "bookmark again", wantErr: ErrAlreadyBookmarked, action: func() error {
+			_, err := db.CreateBookmark(2, chirp.ID)
+			return err
+		}},
+		{name: "another user bookmarks it", action: func() error {
+			_, err := db.CreateBookmark(3, chirp.ID)
+			return err
+		}},
+		{name: "missing chirp", wantErr: ErrNotExist, action: func() error {
+			_, err := db.CreateBookmark(2, 404)
+			return err
+		}},
+		{name: "remove", action: func() error {
+			return db.DeleteBookmark(3, chirp.ID)
+		}},
+		{name: "remove again", wantErr: ErrNotExist, action: func() error {
+			return db.DeleteBookmark(3, chirp.ID)
+		}},
+	}
+	for _, tt := range tests {
+		err := tt.action()
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	bookmarks, chirps, err := db.GetBookmarks(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].ChirpID != chirp.ID || chirps[chirp.ID].Body != "saved" {
+		t.Errorf("GetBookmarks() = %+v, %+v", bookmarks, chirps)
+	}
+	bookmarks, _, err = db.GetBookmarks(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 0 {
+		t.Errorf("GetBookmarks() after removing = %+v, want none", bookmarks)
+	}
+}
+
+func TestPinChirp(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("pinner@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for i := 0; i < 3; i++ {
+		chirp, err := db.CreateChirp(Chirp{Author: user.ID, Body: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, chirp.ID)
+	}
+
+	// the cases run in order against the same user, with a limit of two pins
+	tests := []struct {
+		name    string
+		pin     bool
+		chirpID int
+		want    []int
+		wantErr error
+	}{
+		{name: "first pin", pin: true, chirpID: ids[0], want: []int{ids[0]}},
+		{name: "second pin", pin: true, chirpID: ids[1], want: []int{ids[0], ids[1]}},
+		{name: "pinning twice keeps one pin", pin: true, chirpID: ids[1], want: []int{ids[0], ids[1]}},
+		{name: "over the limit", pin: true, chirpID: ids[2], wantErr: ErrTooManyPins},
+		{name: "missing chirp", pin: true, chirpID: 404, wantErr: ErrNotExist},
+		{name: "unpin", chirpID: ids[0], want: []int{ids[1]}},
+		{name: "unpin a chirp that isn't pinned", chirpID: ids[0], wantErr: ErrNotExist},
+		{name: "pin after making room", pin: true, chirpID: ids[2], want: []int{ids[1], ids[2]}},
+	}
+	for _, tt := range tests {
+		var got User
+		var err error
+		if tt.pin {
+			got, err = db.PinChirp(user.ID, tt.chirpID, 2)
+		} else {
+			got, err = db.UnpinChirp(user.ID, tt.chirpID)
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && fmt.Sprint(got.Pinned) != fmt.Sprint(tt.want) {
+			t.Errorf("%v: pinned = %v, want %v", tt.name, got.Pinned, tt.want)
+		}
+	}
+}
+
+func TestDeleteChirpRemovesBookmarksAndPins(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("pinner@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := db.CreateChirp(Chirp{Author: user.ID, Body: "short-lived"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.PinChirp(user.ID, chirp.ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateBookmark(user.ID, chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteChirp(chirp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = db.GetSingleUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Pinned) != 0 {
+		t.Errorf("pinned = %v after deleting the chirp", user.Pinned)
+	}
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dbStructure.Bookmarks) != 0 {
+		t.Errorf("bookmarks = %+v after deleting the chirp", dbStructure.Bookmarks)
+	}
+}
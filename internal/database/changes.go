@@ -0,0 +1,27 @@
+package database
+
+const (
+	ChangeChirpCreated = "chirp.created"
+	ChangeChirpDeleted = "chirp.deleted"
+)
+
+// Change describes a chirp that was created or removed once the write reached disk
+
+type Change struct {
+	Type  string
+	Chirp Chirp
+}
+
+// OnChange registers fn to be called after every committed chirp change; register listeners before serving requests
+
+func (db *DB) OnChange(fn func(Change)) {
+	db.listeners = append(db.listeners, fn)
+}
+
+func (db *DB) emit(changeType string, chirps ...Chirp) {
+	for _, chirp := range chirps {
+		for _, fn := range db.listeners {
+			fn(Change{Type: changeType, Chirp: chirp})
+		}
+	}
+}
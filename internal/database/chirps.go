@@ -3,32 +3,31 @@ package database
 import (
 	"errors"
 	"log"
+	"time"
 )
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		log.Print("Could not load db.")
-		return Chirp{}, err
-	}
-
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:     id,
-		Body:   body,
-		Author: authorID,
-	}
-	dbStructure.Chirps[id] = chirp
-
-	db.mu.Lock()
-	err = db.writeDB(dbStructure)
-	db.mu.Unlock()
+// CreateChirp assigns the next free ID to chirp and saves it
 
+func (db *DB) CreateChirp(chirp Chirp) (Chirp, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		id := dbStructure.nextChirpID()
+		dbStructure.NextChirpID = id + 1
+		chirp.ID = id
+		chirp.CreatedAt = time.Now().UTC()
+		chirp.Flagged = len(chirp.FlagReasons) > 0
+		if chirp.Visibility == "" {
+			chirp.Visibility = VisibilityPublic
+		}
+		dbStructure.Chirps[id] = chirp
+		dbStructure.touchFeed(chirp.Author)
+		return nil
+	})
 	if err != nil {
 		log.Print("Could not write db.")
 		return Chirp{}, err
 	}
 
+	db.emit(ChangeChirpCreated, chirp)
 	return chirp, nil
 }
 
@@ -47,6 +46,46 @@ func (db *DB) GetChirps() ([]Chirp, error) {
 	return chirps, nil
 }
 
+// GetQuoted returns the chirps with the given ids and their authors from a single read, leaving out ids that don't exist
+
+func (db *DB) GetQuoted(ids []int) (map[int]Chirp, map[int]User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chirps := map[int]Chirp{}
+	authors := map[int]User{}
+	for _, id := range ids {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok {
+			continue
+		}
+		chirps[id] = chirp
+		if author, ok := dbStructure.Users[chirp.Author]; ok {
+			authors[author.ID] = author
+		}
+	}
+	return chirps, authors, nil
+}
+
+// GetQuotes returns every chirp quoting the chirp with the given id
+
+func (db *DB) GetQuotes(id int) ([]Chirp, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := []Chirp{}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.QuoteOf == id {
+			quotes = append(quotes, chirp)
+		}
+	}
+	return quotes, nil
+}
+
 func (db *DB) GetChirp(id int) (Chirp, error) {
 	dbStructure, err := db.loadDB()
 	if err != nil {
@@ -59,23 +98,122 @@ func (db *DB) GetChirp(id int) (Chirp, error) {
 	return chirp, nil
 }
 
-func (db *DB) DeleteChirp(id int, subject int) (int, error) {
-	dbStructure, err := db.loadDB()
+func (db *DB) DeleteChirp(id int) error {
+	chirp := Chirp{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		log.Printf("DB: Attempting to delete chirp id %v with author %v", id, chirp.Author)
+		dbStructure.removeChirp(id)
+		return nil
+	})
 	if err != nil {
-		return 500, err
+		return err
 	}
-	if dbStructure.Chirps[id].Author != subject {
-		return 403, errors.New("unauthorized")
+
+	db.emit(ChangeChirpDeleted, chirp)
+	return nil
+}
+
+// Expired reports whether the chirp's time to live has passed
+
+func (c Chirp) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// DeleteExpiredChirps removes every chirp whose time to live has passed in one locked update, returning how many were deleted
+
+func (db *DB) DeleteExpiredChirps(now time.Time) (int, error) {
+	expired := []Chirp{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		for _, chirp := range dbStructure.Chirps {
+			if chirp.Expired(now) {
+				expired = append(expired, chirp)
+			}
+		}
+		if len(expired) == 0 {
+			return errNothingToWrite
+		}
+
+		for _, chirp := range expired {
+			dbStructure.removeChirp(chirp.ID)
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingToWrite) {
+		return 0, nil
 	}
-	log.Printf("DB: Attempting to delete chirp id %v with author %v", id, subject)
+	if err != nil {
+		return 0, err
+	}
+
+	db.emit(ChangeChirpDeleted, expired...)
+	return len(expired), nil
+}
+
+// nextChirpID returns an ID no chirp has ever had, including chirps since deleted, so references such as quotes never point at a different chirp
+
+func (dbStructure *DBStructure) nextChirpID() int {
+	id := max(dbStructure.NextChirpID, 1)
+	for existing := range dbStructure.Chirps {
+		if existing >= id {
+			id = existing + 1
+		}
+	}
+	return id
+}
+
+// removeChirp deletes a chirp along with any bookmarks and pins referencing it, and resolves its open reports
+
+func (dbStructure *DBStructure) removeChirp(id int) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok {
+		return
+	}
+	dbStructure.NextChirpID = dbStructure.nextChirpID()
 	delete(dbStructure.Chirps, id)
-	db.mu.Lock()
-	err = db.writeDB(dbStructure)
-	db.mu.Unlock()
+	delete(dbStructure.Views, id)
 
-	if err != nil {
-		return 500, err
+	for bookmarkID, b := range dbStructure.Bookmarks {
+		if b.ChirpID == id {
+			delete(dbStructure.Bookmarks, bookmarkID)
+		}
+	}
+
+	if author, ok := dbStructure.Users[chirp.Author]; ok {
+		author.Pinned = removeID(author.Pinned, id)
+		author.FeedChangedAt = time.Now().UTC()
+		dbStructure.Users[author.ID] = author
+	}
+
+	for reportID, r := range dbStructure.Reports {
+		if r.ChirpID == id && !r.Resolved {
+			r.Resolved = true
+			dbStructure.Reports[reportID] = r
+		}
 	}
+}
+
+// touchFeed records that the author's public feed changed, feeds send it as Last-Modified
 
-	return 200, nil
+func (dbStructure *DBStructure) touchFeed(author int) {
+	user, ok := dbStructure.Users[author]
+	if !ok {
+		return
+	}
+	user.FeedChangedAt = time.Now().UTC()
+	dbStructure.Users[author] = user
+}
+
+func removeID(ids []int, id int) []int {
+	kept := []int{}
+	for _, existing := range ids {
+		if existing != id {
+			kept = append(kept, existing)
+		}
+	}
+	return kept
 }
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDeleteExpiredChirps(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("author@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	ids := map[string]int{}
+	for _, chirp := range []Chirp{
+		{Body: "permanent"},
+		{Body: "expired", ExpiresAt: &past},
+		{Body: "expires now", ExpiresAt: &now},
+		{Body: "still live", ExpiresAt: &future},
+	} {
+		chirp.Author = user.ID
+		chirp, err := db.CreateChirp(chirp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[chirp.Body] = chirp.ID
+	}
+	_, err = db.PinChirp(user.ID, ids["expired"], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateBookmark(user.ID, ids["expired"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := []int{}
+	db.OnChange(func(c Change) {
+		if c.Type == ChangeChirpDeleted {
+			deleted = append(deleted, c.Chirp.ID)
+		}
+	})
+
+	n, err := db.DeleteExpiredChirps(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(deleted)
+	if want := []int{ids["expired"], ids["expires now"]}; n != 2 || fmt.Sprint(deleted) != fmt.Sprint(want) {
+		t.Errorf("DeleteExpiredChirps() = %v deleting %v, want 2 deleting %v", n, deleted, want)
+	}
+
+	chirps, err := db.GetChirps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := []string{}
+	for _, chirp := range chirps {
+		remaining = append(remaining, chirp.Body)
+	}
+	sort.Strings(remaining)
+	if fmt.Sprint(remaining) != "[permanent still live]" {
+		t.Errorf("remaining chirps = %v", remaining)
+	}
+	user, err = db.GetSingleUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmarks, _, err := db.GetBookmarks(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Pinned) != 0 || len(bookmarks) != 0 {
+		t.Errorf("pins = %v and bookmarks = %+v still point at expired chirps", user.Pinned, bookmarks)
+	}
+
+	// a run with nothing to reap neither writes nor notifies
+	deleted = nil
+	n, err = db.DeleteExpiredChirps(now)
+	if err != nil || n != 0 || len(deleted) != 0 {
+		t.Errorf("second DeleteExpiredChirps() = %v, %v with changes %v", n, err, deleted)
+	}
+}
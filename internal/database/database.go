@@ -6,32 +6,88 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 var ErrNotExist = errors.New("resource does not exist")
 
+// errNothingToWrite lets an update skip the write when it finds nothing to change
+var errNothingToWrite = errors.New("nothing to write")
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityDirect    = "direct"
+)
+
 type DB struct {
-	path string
-	mu   *sync.RWMutex
+	path      string
+	mu        *sync.RWMutex
+	listeners []func(Change)
 }
 
 type DBStructure struct {
-	Chirps map[int]Chirp    `json:"chirps"`
-	Users  map[int]User     `json:"users"`
-	Tokens map[string]Token `json:"tokens"`
+	Chirps          map[int]Chirp            `json:"chirps"`
+	Users           map[int]User             `json:"users"`
+	Tokens          map[string]Token         `json:"tokens"`
+	Reports         map[int]Report           `json:"reports"`
+	Decisions       map[int]Decision         `json:"decisions"`
+	Follows         map[int]Follow           `json:"follows"`
+	Bookmarks       map[int]Bookmark         `json:"bookmarks"`
+	Views           map[int]map[string]int   `json:"views"`
+	ActorKeys       map[int]ActorKey         `json:"actor_keys"`
+	RemoteFollowers map[int]RemoteFollower   `json:"remote_followers"`
+	PasswordResets  map[string]PasswordReset `json:"password_resets"`
+	Blocks          map[int]Block            `json:"blocks"`
+	Mutes           map[int]Mute             `json:"mutes"`
+	AdminActions    map[int]AdminAction      `json:"admin_actions"`
+	// NextUserID and NextChirpID keep IDs of deleted accounts and chirps from being handed out again
+	NextUserID  int `json:"next_user_id"`
+	NextChirpID int `json:"next_chirp_id"`
 }
 
 type Chirp struct {
-	ID     int    `json:"id"`
-	Body   string `json:"body"`
-	Author int    `json:"author_id"`
+	ID          int        `json:"id"`
+	Body        string     `json:"body"`
+	Author      int        `json:"author_id"`
+	Flagged     bool       `json:"flagged,omitempty"`
+	FlagReasons []string   `json:"flag_reasons,omitempty"`
+	Hidden      bool       `json:"hidden,omitempty"`
+	Visibility  string     `json:"visibility,omitempty"`
+	Recipients  []int      `json:"recipients,omitempty"`
+	Poll        *Poll      `json:"poll,omitempty"`
+	QuoteOf     int        `json:"quote_of,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type User struct {
-	Email    string
-	Password string
-	ID       int
-	Premium  bool
+	Email       string
+	Password    string
+	ID          int
+	Premium     bool
+	Pinned      []int
+	Role        string
+	Handle      string
+	DisplayName string
+	Bio         string
+	Avatar      string
+	// Unverified is only set on accounts created since email verification was introduced
+	Unverified        bool
+	VerificationNonce string
+	// TOTPSecret is only set once enrollment has been confirmed with a code
+	TOTPSecret    string
+	TOTPPending   string
+	TOTPLastStep  int64
+	RecoveryCodes []string
+	// MFAChallenge is the nonce of the newest login challenge waiting for a second factor
+	MFAChallenge string
+	// SuspendedUntil and Banned are set by admins, SuspensionReason explains either
+	SuspendedUntil   *time.Time
+	Banned           bool
+	SuspensionReason string
+	// FeedChangedAt is when a chirp or profile change last altered the user's public feed
+	FeedChangedAt time.Time
 }
 
 type Token struct {
@@ -49,15 +105,12 @@ func NewDB(path string) (*DB, error) {
 }
 
 func (db *DB) createDB() error {
-	dbStructure := DBStructure{
-		Chirps: map[int]Chirp{},
-		Users:  map[int]User{},
-		Tokens: map[string]Token{},
-	}
+	dbStructure := DBStructure{}
+	dbStructure.ensureMaps()
 
-	db.mu.RLock()
+	db.mu.Lock()
 	err := db.writeDB(dbStructure)
-	db.mu.RUnlock()
+	db.mu.Unlock()
 
 	return err
 }
@@ -71,12 +124,36 @@ func (db *DB) ensureDB() error {
 }
 
 func (db *DB) loadDB() (DBStructure, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.readDB()
+}
+
+/* update loads the database, applies fn and writes the result while holding the write lock for the whole time,
+so writes can't overwrite each other with stale copies; nothing is written when fn returns an error */
+
+func (db *DB) update(fn func(dbStructure *DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dbStructure, err := db.readDB()
+	if err != nil {
+		return err
+	}
+	err = fn(&dbStructure)
+	if err != nil {
+		return err
+	}
+	return db.writeDB(dbStructure)
+}
+
+// readDB reads and decodes the database file, callers hold db.mu
+
+func (db *DB) readDB() (DBStructure, error) {
 	dbStructure := DBStructure{}
 
-	db.mu.RLock()
 	dat, err := os.ReadFile(db.path)
-	db.mu.RUnlock()
-
 	if errors.Is(err, os.ErrNotExist) {
 		log.Printf("Could not read file: %v", db.path)
 		return dbStructure, err
@@ -88,6 +165,7 @@ func (db *DB) loadDB() (DBStructure, error) {
 		log.Printf("Could not unmarshal data: %v", dat)
 		return dbStructure, err
 	}
+	dbStructure.ensureMaps()
 
 	return dbStructure, nil
 }
@@ -107,3 +185,50 @@ func (db *DB) writeDB(dbStructure DBStructure) error {
 	}
 	return nil
 }
+
+// ensureMaps initializes collections missing from database files written by older versions
+
+func (dbStructure *DBStructure) ensureMaps() {
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = map[int]Chirp{}
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = map[int]User{}
+	}
+	if dbStructure.Tokens == nil {
+		dbStructure.Tokens = map[string]Token{}
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = map[int]Report{}
+	}
+	if dbStructure.Decisions == nil {
+		dbStructure.Decisions = map[int]Decision{}
+	}
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = map[int]Follow{}
+	}
+	if dbStructure.Bookmarks == nil {
+		dbStructure.Bookmarks = map[int]Bookmark{}
+	}
+	if dbStructure.Views == nil {
+		dbStructure.Views = map[int]map[string]int{}
+	}
+	if dbStructure.ActorKeys == nil {
+		dbStructure.ActorKeys = map[int]ActorKey{}
+	}
+	if dbStructure.RemoteFollowers == nil {
+		dbStructure.RemoteFollowers = map[int]RemoteFollower{}
+	}
+	if dbStructure.PasswordResets == nil {
+		dbStructure.PasswordResets = map[string]PasswordReset{}
+	}
+	if dbStructure.Blocks == nil {
+		dbStructure.Blocks = map[int]Block{}
+	}
+	if dbStructure.Mutes == nil {
+		dbStructure.Mutes = map[int]Mute{}
+	}
+	if dbStructure.AdminActions == nil {
+		dbStructure.AdminActions = map[int]AdminAction{}
+	}
+}
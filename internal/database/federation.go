@@ -0,0 +1,143 @@
+package database
+
+import (
+	"time"
+)
+
+// ActorKey is the key pair a user's ActivityPub actor signs deliveries with
+
+type ActorKey struct {
+	UserID        int    `json:"user_id"`
+	PublicKeyPEM  string `json:"public_key_pem"`
+	PrivateKeyPEM string `json:"private_key_pem"`
+}
+
+// RemoteFollower is an actor on another server following a local user
+
+type RemoteFollower struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Actor     string    `json:"actor"`
+	Inbox     string    `json:"inbox"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetActorKey returns the user's key pair, which is created along with the user
+
+func (db *DB) GetActorKey(userID int) (ActorKey, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return ActorKey{}, err
+	}
+	key, ok := dbStructure.ActorKeys[userID]
+	if !ok {
+		return ActorKey{}, ErrNotExist
+	}
+	return key, nil
+}
+
+/* EnsureActorKeys gives every user without a key pair one made by generate, for accounts created before keys
+were made at signup; it returns how many keys were created */
+
+func (db *DB) EnsureActorKeys(generate func() (string, string, error)) (int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := map[int]ActorKey{}
+	for id := range dbStructure.Users {
+		if _, ok := dbStructure.ActorKeys[id]; ok {
+			continue
+		}
+		priv, pub, err := generate()
+		if err != nil {
+			return 0, err
+		}
+		keys[id] = ActorKey{
+			UserID:        id,
+			PublicKeyPEM:  pub,
+			PrivateKeyPEM: priv,
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	created := 0
+	err = db.update(func(dbStructure *DBStructure) error {
+		for id, key := range keys {
+			_, exists := dbStructure.ActorKeys[id]
+			_, ok := dbStructure.Users[id]
+			if exists || !ok {
+				continue
+			}
+			dbStructure.ActorKeys[id] = key
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+// AddRemoteFollower records a remote actor following userID; following twice is not an error
+
+func (db *DB) AddRemoteFollower(userID int, actor string, inbox string) (RemoteFollower, error) {
+	follower := RemoteFollower{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		id := 1
+		for _, f := range dbStructure.RemoteFollowers {
+			if f.UserID == userID && f.Actor == actor {
+				follower = f
+				return nil
+			}
+			if f.ID >= id {
+				id = f.ID + 1
+			}
+		}
+
+		follower = RemoteFollower{
+			ID:        id,
+			UserID:    userID,
+			Actor:     actor,
+			Inbox:     inbox,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.RemoteFollowers[id] = follower
+		return nil
+	})
+	if err != nil {
+		return RemoteFollower{}, err
+	}
+	return follower, nil
+}
+
+func (db *DB) RemoveRemoteFollower(userID int, actor string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for id, f := range dbStructure.RemoteFollowers {
+			if f.UserID == userID && f.Actor == actor {
+				delete(dbStructure.RemoteFollowers, id)
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+func (db *DB) GetRemoteFollowers(userID int) ([]RemoteFollower, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	followers := []RemoteFollower{}
+	for _, f := range dbStructure.RemoteFollowers {
+		if f.UserID == userID {
+			followers = append(followers, f)
+		}
+	}
+	return followers, nil
+}
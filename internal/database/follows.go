@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrAlreadyFollowing = errors.New("already following user")
+
+type Follow struct {
+	ID        int       `json:"id"`
+	Follower  int       `json:"follower_id"`
+	Followee  int       `json:"followee_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateFollow(follower int, followee int) (Follow, error) {
+	follow := Follow{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[followee]; !ok {
+			return ErrNotExist
+		}
+		if dbStructure.isBlocked(follower, followee) {
+			return ErrBlocked
+		}
+
+		id := 1
+		for _, f := range dbStructure.Follows {
+			if f.Follower == follower && f.Followee == followee {
+				return ErrAlreadyFollowing
+			}
+			if f.ID >= id {
+				id = f.ID + 1
+			}
+		}
+
+		follow = Follow{
+			ID:        id,
+			Follower:  follower,
+			Followee:  followee,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Follows[id] = follow
+		return nil
+	})
+	if err != nil {
+		return Follow{}, err
+	}
+
+	log.Printf("DB: User %v now follows user %v", follower, followee)
+	return follow, nil
+}
+
+func (db *DB) DeleteFollow(follower int, followee int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for id, f := range dbStructure.Follows {
+			if f.Follower == follower && f.Followee == followee {
+				delete(dbStructure.Follows, id)
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+// GetFollowing returns the set of user IDs followed by follower
+
+func (db *DB) GetFollowing(follower int) (map[int]struct{}, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	following := map[int]struct{}{}
+	for _, f := range dbStructure.Follows {
+		if f.Follower == follower {
+			following[f.Followee] = struct{}{}
+		}
+	}
+	return following, nil
+}
+
+// GetFollowers returns the IDs of every user following followee
+
+func (db *DB) GetFollowers(followee int) ([]int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	followers := []int{}
+	for _, f := range dbStructure.Follows {
+		if f.Followee == followee {
+			followers = append(followers, f.Follower)
+		}
+	}
+	return followers, nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+var (
+	ErrCodeReused       = errors.New("code has already been used")
+	ErrInvalidCode      = errors.New("code is invalid")
+	ErrMFANotActive     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidChallenge = errors.New("challenge is invalid or has already been used")
+)
+
+// SetMFAChallenge records the nonce of the newest login challenge, invalidating earlier challenges
+
+func (db *DB) SetMFAChallenge(id int, nonce string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.MFAChallenge = nonce
+		return nil
+	})
+}
+
+// ConsumeMFAChallenge uses up the user's login challenge if nonce belongs to it, so each challenge completes one login
+
+func (db *DB) ConsumeMFAChallenge(id int, nonce string) error {
+	_, err := db.updateUser(id, func(user *User) error {
+		if nonce == "" || user.MFAChallenge != nonce {
+			return ErrInvalidChallenge
+		}
+		user.MFAChallenge = ""
+		return nil
+	})
+	if errors.Is(err, ErrNotExist) {
+		return ErrInvalidChallenge
+	}
+	return err
+}
+
+// SetPendingTOTP stores a secret awaiting confirmation, replacing any earlier unconfirmed enrollment
+
+func (db *DB) SetPendingTOTP(id int, secret string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.TOTPPending = secret
+		return nil
+	})
+}
+
+// EnableTOTP activates the pending secret and replaces the user's recovery codes with hashes
+
+func (db *DB) EnableTOTP(id int, step int64, recoveryHashes []string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		if user.TOTPPending == "" {
+			return ErrMFANotActive
+		}
+		user.TOTPSecret = user.TOTPPending
+		user.TOTPPending = ""
+		user.TOTPLastStep = step
+		user.RecoveryCodes = recoveryHashes
+		return nil
+	})
+}
+
+func (db *DB) DisableTOTP(id int) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.TOTPSecret = ""
+		user.TOTPPending = ""
+		user.TOTPLastStep = 0
+		user.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// UseTOTPStep records the time step of an accepted code, refusing steps at or before the last one used
+
+func (db *DB) UseTOTPStep(id int, step int64) error {
+	_, err := db.updateUser(id, func(user *User) error {
+		if step <= user.TOTPLastStep {
+			return ErrCodeReused
+		}
+		user.TOTPLastStep = step
+		return nil
+	})
+	return err
+}
+
+// UseRecoveryCode consumes the recovery code with the given hash
+
+func (db *DB) UseRecoveryCode(id int, hash string) error {
+	_, err := db.updateUser(id, func(user *User) error {
+		remaining := removeString(user.RecoveryCodes, hash)
+		if len(remaining) == len(user.RecoveryCodes) {
+			return ErrInvalidCode
+		}
+		user.RecoveryCodes = remaining
+		log.Printf("DB: User %v used a recovery code, %v left", id, len(remaining))
+		return nil
+	})
+	return err
+}
+
+func removeString(values []string, value string) []string {
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoPoll        = errors.New("chirp has no poll")
+	ErrPollClosed    = errors.New("poll is closed")
+	ErrAlreadyVoted  = errors.New("already voted in this poll")
+	ErrInvalidOption = errors.New("poll option does not exist")
+)
+
+type Poll struct {
+	Options  []string    `json:"options"`
+	ClosesAt time.Time   `json:"closes_at"`
+	Votes    map[int]int `json:"votes"`
+}
+
+func (p Poll) Closed(now time.Time) bool {
+	return !now.Before(p.ClosesAt)
+}
+
+// Tally counts the votes cast for each option
+
+func (p Poll) Tally() []int {
+	tally := make([]int, len(p.Options))
+	for _, option := range p.Votes {
+		if option >= 0 && option < len(tally) {
+			tally[option]++
+		}
+	}
+	return tally
+}
+
+// Vote records userID's single vote for option on the chirp's poll, checking for an earlier vote in the same locked update
+
+func (db *DB) Vote(chirpID int, userID int, option int) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+		if chirp.Poll == nil {
+			return ErrNoPoll
+		}
+		if chirp.Poll.Closed(time.Now()) {
+			return ErrPollClosed
+		}
+		if option < 0 || option >= len(chirp.Poll.Options) {
+			return ErrInvalidOption
+		}
+		if _, ok := chirp.Poll.Votes[userID]; ok {
+			return ErrAlreadyVoted
+		}
+
+		if chirp.Poll.Votes == nil {
+			chirp.Poll.Votes = map[int]int{}
+		}
+		chirp.Poll.Votes[userID] = option
+		dbStructure.Chirps[chirpID] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
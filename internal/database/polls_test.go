@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVote(t *testing.T) {
+	db := newTestDB(t)
+	newChirp := func(poll *Poll) int {
+		t.Helper()
+		chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "question", Poll: poll})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp.ID
+	}
+	open := newChirp(&Poll{Options: []string{"yes", "no", "maybe"}, ClosesAt: time.Now().Add(time.Hour)})
+	closed := newChirp(&Poll{Options: []string{"yes", "no"}, ClosesAt: time.Now().Add(-time.Second)})
+	plain := newChirp(nil)
+
+	// the cases run in order against the same polls
+	tests := []struct {
+		name    string
+		chirpID int
+		voter   int
+		option  int
+		want    []int
+		wantErr error
+	}{
+		{name: "first vote", chirpID: open, voter: 2, option: 0, want: []int{1, 0, 0}},
+		{name: "second voter", chirpID: open, voter: 3, option: 2, want: []int{1, 0, 1}},
+		{name: "voting twice", chirpID: open, voter: 2, option: 1, wantErr: ErrAlreadyVoted},
+		{name: "option out of range", chirpID: open, voter: 4, option: 3, wantErr: ErrInvalidOption},
+		{name: "negative option", chirpID: open, voter: 4, option: -1, wantErr: ErrInvalidOption},
+		{name: "closed poll", chirpID: closed, voter: 2, option: 0, wantErr: ErrPollClosed},
+		{name: "chirp without a poll", chirpID: plain, voter: 2, option: 0, wantErr: ErrNoPoll},
+		{name: "missing chirp", chirpID: 404, voter: 2, option: 0, wantErr: ErrNotExist},
+		{name: "the author can vote", chirpID: open, voter: 1, option: 0, want: []int{2, 0, 1}},
+	}
+	for _, tt := range tests {
+		chirp, err := db.Vote(tt.chirpID, tt.voter, tt.option)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: Vote() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr != nil {
+			continue
+		}
+		if got := chirp.Poll.Tally(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v: tally = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// refused votes are never saved
+	chirp, err := db.GetChirp(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirp.Poll.Votes[2] != 0 || len(chirp.Poll.Votes) != 3 {
+		t.Errorf("stored votes = %v", chirp.Poll.Votes)
+	}
+}
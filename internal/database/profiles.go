@@ -0,0 +1,83 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrHandleTaken = errors.New("handle is already taken")
+
+// Profile holds the public, user-editable fields of a user
+
+type Profile struct {
+	Handle      string
+	DisplayName string
+	Bio         string
+}
+
+// UpdateProfile replaces a user's profile, keeping handles unique regardless of case
+
+func (db *DB) UpdateProfile(id int, profile Profile) (User, error) {
+	user := User{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		if profile.Handle != "" {
+			for _, other := range dbStructure.Users {
+				if other.ID != id && strings.EqualFold(other.Handle, profile.Handle) {
+					return ErrHandleTaken
+				}
+			}
+		}
+
+		user.Handle = profile.Handle
+		user.DisplayName = profile.DisplayName
+		user.Bio = profile.Bio
+		// feeds are titled with the display name and handle
+		user.FeedChangedAt = time.Now().UTC()
+		dbStructure.Users[id] = user
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	log.Printf("DB: Updated profile of user %v", id)
+	return user, nil
+}
+
+// SetAvatar records the stored avatar file of a user, returning the user along with the file it replaced
+
+func (db *DB) SetAvatar(id int, avatar string) (User, string, error) {
+	previous := ""
+	user, err := db.updateUser(id, func(user *User) error {
+		previous = user.Avatar
+		user.Avatar = avatar
+		return nil
+	})
+	if err != nil {
+		return User{}, "", err
+	}
+	return user, previous, nil
+}
+
+// GetUserByHandle finds a user by handle, ignoring case
+
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for _, u := range dbStructure.Users {
+		if u.Handle != "" && strings.EqualFold(u.Handle, handle) {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotExist
+}
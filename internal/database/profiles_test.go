@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	db := newTestDB(t)
+	first, err := db.CreateUser("first@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.CreateUser("second@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same database
+	tests := []struct {
+		name    string
+		id      int
+		profile Profile
+		wantErr error
+	}{
+		{name: "claim a handle", id: first.ID, profile: Profile{Handle: "Chirper", DisplayName: "First", Bio: "hello"}},
+		{name: "same handle in another case", id: second.ID, profile: Profile{Handle: "chirper"}, wantErr: ErrHandleTaken},
+		{name: "keep your own handle", id: first.ID, profile: Profile{Handle: "CHIRPER", DisplayName: "First"}},
+		{name: "no handle never conflicts", id: second.ID, profile: Profile{DisplayName: "Second"}},
+		{name: "another handle", id: second.ID, profile: Profile{Handle: "second"}},
+		{name: "missing user", id: 404, profile: Profile{Handle: "ghost"}, wantErr: ErrNotExist},
+	}
+	for _, tt := range tests {
+		user, err := db.UpdateProfile(tt.id, tt.profile)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: UpdateProfile() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (user.Handle != tt.profile.Handle || user.DisplayName != tt.profile.DisplayName || user.Bio != tt.profile.Bio) {
+			t.Errorf("%v: UpdateProfile() = %+v, want %+v", tt.name, user, tt.profile)
+		}
+	}
+
+	lookups := []struct {
+		handle  string
+		want    int
+		wantErr error
+	}{
+		{handle: "chirper", want: first.ID},
+		{handle: "Second", want: second.ID},
+		{handle: "ghost", wantErr: ErrNotExist},
+		{handle: "", wantErr: ErrNotExist},
+	}
+	for _, lookup := range lookups {
+		user, err := db.GetUserByHandle(lookup.handle)
+		if !errors.Is(err, lookup.wantErr) || user.ID != lookup.want {
+			t.Errorf("GetUserByHandle(%q) = %v, %v, want %v, %v", lookup.handle, user.ID, err, lookup.want, lookup.wantErr)
+		}
+	}
+}
+
+func TestSetAvatar(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		avatar       string
+		wantPrevious string
+	}{
+		{avatar: "first.png"},
+		{avatar: "second.jpg", wantPrevious: "first.png"},
+	}
+	for _, tt := range tests {
+		got, previous, err := db.SetAvatar(user.ID, tt.avatar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Avatar != tt.avatar || previous != tt.wantPrevious {
+			t.Errorf("SetAvatar(%q) = %q replacing %q, want %q replacing %q", tt.avatar, got.Avatar, previous, tt.avatar, tt.wantPrevious)
+		}
+	}
+	if _, _, err := db.SetAvatar(404, "ghost.png"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("SetAvatar() of a missing user error = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	DecisionHide    = "hide"
+	DecisionDelete  = "delete"
+	DecisionDismiss = "dismiss"
+)
+
+var ErrAlreadyReported = errors.New("chirp already reported by this user")
+
+type Report struct {
+	ID        int       `json:"id"`
+	ChirpID   int       `json:"chirp_id"`
+	Reporter  int       `json:"reporter_id"`
+	Reason    string    `json:"reason"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Resolved  bool      `json:"resolved"`
+}
+
+type Decision struct {
+	ID        int       `json:"id"`
+	ChirpID   int       `json:"chirp_id"`
+	Moderator int       `json:"moderator_id"`
+	Action    string    `json:"action"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QueueItem is a chirp awaiting review along with its open reports
+
+type QueueItem struct {
+	Chirp   Chirp
+	Reports []Report
+}
+
+func (db *DB) CreateReport(chirpID int, reporter int, reason string, details string) (Report, error) {
+	report := Report{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Chirps[chirpID]; !ok {
+			return ErrNotExist
+		}
+
+		id := 1
+		for _, r := range dbStructure.Reports {
+			if r.ChirpID == chirpID && r.Reporter == reporter && !r.Resolved {
+				return ErrAlreadyReported
+			}
+			if r.ID >= id {
+				id = r.ID + 1
+			}
+		}
+
+		report = Report{
+			ID:        id,
+			ChirpID:   chirpID,
+			Reporter:  reporter,
+			Reason:    reason,
+			Details:   details,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Reports[id] = report
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	log.Printf("DB: Chirp %v reported by user %v (%v)", chirpID, reporter, reason)
+	return report, nil
+}
+
+// GetModerationQueue returns every chirp that was flagged by the moderation pipeline or has unresolved reports
+
+func (db *DB) GetModerationQueue() ([]QueueItem, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[int]*QueueItem{}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.Flagged {
+			items[chirp.ID] = &QueueItem{Chirp: chirp}
+		}
+	}
+	for _, report := range dbStructure.Reports {
+		if report.Resolved {
+			continue
+		}
+		chirp, ok := dbStructure.Chirps[report.ChirpID]
+		if !ok {
+			continue
+		}
+		item, ok := items[chirp.ID]
+		if !ok {
+			item = &QueueItem{Chirp: chirp}
+			items[chirp.ID] = item
+		}
+		item.Reports = append(item.Reports, report)
+	}
+
+	queue := make([]QueueItem, 0, len(items))
+	for _, item := range items {
+		queue = append(queue, *item)
+	}
+	return queue, nil
+}
+
+/* ModerateChirp applies a moderator's decision to a chirp, resolves its open reports and records the decision
+hide keeps the chirp but removes it from public reads, delete removes it and dismiss clears it from the queue */
+
+func (db *DB) ModerateChirp(chirpID int, moderator int, action string, note string) (Decision, error) {
+	chirp := Chirp{}
+	decision := Decision{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+
+		switch action {
+		case DecisionHide:
+			chirp.Hidden = true
+			chirp.Flagged = false
+			dbStructure.Chirps[chirpID] = chirp
+			dbStructure.touchFeed(chirp.Author)
+		case DecisionDismiss:
+			chirp.Flagged = false
+			dbStructure.Chirps[chirpID] = chirp
+		case DecisionDelete:
+			dbStructure.removeChirp(chirpID)
+		default:
+			return errors.New("unknown moderation action")
+		}
+
+		for id, report := range dbStructure.Reports {
+			if report.ChirpID == chirpID && !report.Resolved {
+				report.Resolved = true
+				dbStructure.Reports[id] = report
+			}
+		}
+
+		id := 1
+		for _, d := range dbStructure.Decisions {
+			if d.ID >= id {
+				id = d.ID + 1
+			}
+		}
+		decision = Decision{
+			ID:        id,
+			ChirpID:   chirpID,
+			Moderator: moderator,
+			Action:    action,
+			Note:      note,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Decisions[id] = decision
+		return nil
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	log.Printf("DB: Moderator %v applied %v to chirp %v", moderator, action, chirpID)
+	if action == DecisionHide || action == DecisionDelete {
+		db.emit(ChangeChirpDeleted, chirp)
+	}
+	return decision, nil
+}
+
+func (db *DB) GetDecisions() ([]Decision, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, 0, len(dbStructure.Decisions))
+	for _, d := range dbStructure.Decisions {
+		decisions = append(decisions, d)
+	}
+	return decisions, nil
+}
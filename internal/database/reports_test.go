@@ -0,0 +1,141 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateReport(t *testing.T) {
+	db := newTestDB(t)
+	chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "reported"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := db.CreateChirp(Chirp{Author: 1, Body: "already reviewed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateReport(resolved.ID, 2, "spam", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ModerateChirp(resolved.ID, 9, DecisionDismiss, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same database
+	tests := []struct {
+		name     string
+		chirpID  int
+		reporter int
+		wantErr  error
+	}{
+		{name: "first report", chirpID: chirp.ID, reporter: 2},
+		{name: "same reporter again", chirpID: chirp.ID, reporter: 2, wantErr: ErrAlreadyReported},
+		{name: "another reporter", chirpID: chirp.ID, reporter: 3},
+		{name: "missing chirp", chirpID: 404, reporter: 2, wantErr: ErrNotExist},
+		{name: "again after the last report was resolved", chirpID: resolved.ID, reporter: 2},
+	}
+	for _, tt := range tests {
+		report, err := db.CreateReport(tt.chirpID, tt.reporter, "spam", "details")
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: CreateReport() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (report.ID == 0 || report.Resolved || report.Reporter != tt.reporter) {
+			t.Errorf("%v: CreateReport() = %+v", tt.name, report)
+		}
+	}
+
+	queue, err := db.GetModerationQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := map[int]int{}
+	for _, item := range queue {
+		reports[item.Chirp.ID] = len(item.Reports)
+	}
+	if reports[chirp.ID] != 2 || reports[resolved.ID] != 1 || len(reports) != 2 {
+		t.Errorf("open reports per chirp = %v, want 2 on chirp %v and 1 on chirp %v", reports, chirp.ID, resolved.ID)
+	}
+}
+
+func TestModerateChirp(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		missing    bool
+		wantErr    bool
+		wantExists bool
+		wantHidden bool
+	}{
+		{name: "hide", action: DecisionHide, wantExists: true, wantHidden: true},
+		{name: "dismiss", action: DecisionDismiss, wantExists: true},
+		{name: "delete", action: DecisionDelete},
+		{name: "unknown action", action: "shadowban", wantErr: true, wantExists: true},
+		{name: "missing chirp", action: DecisionHide, missing: true, wantErr: true, wantExists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "flagged", FlagReasons: []string{"review"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.CreateReport(chirp.ID, 2, "abuse", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes := []Change{}
+			db.OnChange(func(c Change) { changes = append(changes, c) })
+
+			target := chirp.ID
+			if tt.missing {
+				target = 404
+			}
+			decision, err := db.ModerateChirp(target, 9, tt.action, "note")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ModerateChirp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			stored, err := db.GetChirp(chirp.ID)
+			if exists := err == nil; exists != tt.wantExists {
+				t.Fatalf("chirp exists = %v, want %v", exists, tt.wantExists)
+			}
+			if tt.wantExists && stored.Hidden != tt.wantHidden {
+				t.Errorf("chirp hidden = %v, want %v", stored.Hidden, tt.wantHidden)
+			}
+
+			queue, err := db.GetModerationQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decisions, err := db.GetDecisions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				// a refused decision changes nothing
+				if len(queue) != 1 || len(queue[0].Reports) != 1 || len(decisions) != 0 || len(changes) != 0 {
+					t.Errorf("queue = %+v, decisions = %+v, changes = %+v after a refused decision", queue, decisions, changes)
+				}
+				return
+			}
+			if len(queue) != 0 {
+				t.Errorf("queue = %+v, want the chirp and its reports cleared", queue)
+			}
+			if len(decisions) != 1 || decisions[0] != decision || decision.Action != tt.action || decision.Moderator != 9 || decision.Note != "note" {
+				t.Errorf("decisions = %+v, want only %+v", decisions, decision)
+			}
+			// hiding and deleting take the chirp out of live timelines, dismissing leaves it alone
+			wantChanges := 1
+			if tt.action == DecisionDismiss {
+				wantChanges = 0
+			}
+			if len(changes) != wantChanges || (wantChanges == 1 && changes[0].Type != ChangeChirpDeleted) {
+				t.Errorf("changes = %+v, want %v chirp deletion", changes, wantChanges)
+			}
+		})
+	}
+}
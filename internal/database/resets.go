@@ -0,0 +1,100 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrInvalidReset = errors.New("reset token is invalid or has expired")
+
+// PasswordReset is keyed by the hash of the emailed token, so a copy of the database can't be used to reset passwords
+
+type PasswordReset struct {
+	UserID    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreatePasswordReset stores a reset token hash for the user, replacing any earlier unused reset
+
+func (db *DB) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return ErrNotExist
+		}
+		for hash, reset := range dbStructure.PasswordResets {
+			if reset.UserID == userID || reset.ExpiresAt.Before(time.Now()) {
+				delete(dbStructure.PasswordResets, hash)
+			}
+		}
+		dbStructure.PasswordResets[tokenHash] = PasswordReset{
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		}
+		return nil
+	})
+}
+
+// GetPasswordReset returns the user a reset token belongs to without consuming it
+
+func (db *DB) GetPasswordReset(tokenHash string, now time.Time) (User, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+
+	reset, ok := dbStructure.PasswordResets[tokenHash]
+	if !ok || now.After(reset.ExpiresAt) {
+		return User{}, ErrInvalidReset
+	}
+	user, ok := dbStructure.Users[reset.UserID]
+	if !ok {
+		return User{}, ErrInvalidReset
+	}
+	return user, nil
+}
+
+/* ResetPassword consumes a reset token and replaces the user's password hash in a single write,
+revoking every refresh token of the user so sessions started with the old password end */
+
+func (db *DB) ResetPassword(tokenHash string, passwordHash string, now time.Time) (User, error) {
+	user := User{}
+	revoked := 0
+	expired := false
+	err := db.update(func(dbStructure *DBStructure) error {
+		reset, ok := dbStructure.PasswordResets[tokenHash]
+		if !ok {
+			return ErrInvalidReset
+		}
+		delete(dbStructure.PasswordResets, tokenHash)
+		if now.After(reset.ExpiresAt) {
+			// the expired token is still consumed
+			expired = true
+			return nil
+		}
+
+		user, ok = dbStructure.Users[reset.UserID]
+		if !ok {
+			return ErrInvalidReset
+		}
+		user.Password = passwordHash
+		dbStructure.Users[user.ID] = user
+
+		for body, token := range dbStructure.Tokens {
+			if token.ID == user.ID {
+				delete(dbStructure.Tokens, body)
+				revoked++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if expired {
+		return User{}, ErrInvalidReset
+	}
+
+	log.Printf("DB: Reset password of user %v, revoked %v refresh tokens", user.ID, revoked)
+	return user, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPasswordReset(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "old", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("other@example.com", "old", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"session-1", "session-2"} {
+		_, err = db.CreateToken(body, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.CreateToken("other-session", other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	resets := []struct {
+		hash    string
+		userID  int
+		expires time.Time
+		wantErr error
+	}{
+		{hash: "superseded", userID: user.ID, expires: now.Add(time.Hour)},
+		{hash: "current", userID: user.ID, expires: now.Add(time.Hour)},
+		{hash: "expired", userID: other.ID, expires: now.Add(-time.Minute)},
+		{hash: "ghost", userID: 404, expires: now.Add(time.Hour), wantErr: ErrNotExist},
+	}
+	for _, reset := range resets {
+		err := db.CreatePasswordReset(reset.userID, reset.hash, reset.expires)
+		if !errors.Is(err, reset.wantErr) {
+			t.Fatalf("CreatePasswordReset(%q) error = %v, want %v", reset.hash, err, reset.wantErr)
+		}
+	}
+
+	lookups := []struct {
+		hash    string
+		want    int
+		wantErr error
+	}{
+		{hash: "current", want: user.ID},
+		{hash: "superseded", wantErr: ErrInvalidReset},
+		{hash: "expired", wantErr: ErrInvalidReset},
+		{hash: "unknown", wantErr: ErrInvalidReset},
+	}
+	for _, lookup := range lookups {
+		got, err := db.GetPasswordReset(lookup.hash, now)
+		if !errors.Is(err, lookup.wantErr) || got.ID != lookup.want {
+			t.Errorf("GetPasswordReset(%q) = %v, %v, want %v, %v", lookup.hash, got.ID, err, lookup.want, lookup.wantErr)
+		}
+	}
+
+	// the cases run in order, so a consumed token stays consumed
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+	}{
+		{name: "expired token", hash: "expired", wantErr: ErrInvalidReset},
+		{name: "expired token is consumed anyway", hash: "expired", wantErr: ErrInvalidReset},
+		{name: "current token", hash: "current"},
+		{name: "token used twice", hash: "current", wantErr: ErrInvalidReset},
+	}
+	for _, tt := range tests {
+		_, err := db.ResetPassword(tt.hash, "new", now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: ResetPassword() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbStructure.Users[user.ID].Password != "new" || dbStructure.Users[other.ID].Password != "old" {
+		t.Errorf("passwords = %q and %q, want only the reset user's changed", dbStructure.Users[user.ID].Password, dbStructure.Users[other.ID].Password)
+	}
+	if len(dbStructure.PasswordResets) != 0 {
+		t.Errorf("resets = %+v, want every token consumed or replaced", dbStructure.PasswordResets)
+	}
+	// resetting signs the user out everywhere without touching anyone else's sessions
+	if _, ok := dbStructure.Tokens["other-session"]; len(dbStructure.Tokens) != 1 || !ok {
+		t.Errorf("refresh tokens = %+v, want only the other user's", dbStructure.Tokens)
+	}
+}
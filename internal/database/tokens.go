@@ -6,19 +6,13 @@ import (
 )
 
 func (db *DB) CreateToken(body string, id int) (Token, error) {
-	db.mu.RLock()
-	dbStructure, err := db.loadDB()
-	db.mu.RUnlock()
-	if err != nil {
-		return Token{}, err
-	}
 	tk := Token{}
 	tk.Body = body
 	tk.ID = id
-	dbStructure.Tokens[body] = tk
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	err = db.writeDB(dbStructure)
+	err := db.update(func(dbStructure *DBStructure) error {
+		dbStructure.Tokens[body] = tk
+		return nil
+	})
 	if err != nil {
 		return Token{}, err
 	}
@@ -30,9 +24,7 @@ func (db *DB) CreateToken(body string, id int) (Token, error) {
 }
 
 func (db *DB) GetToken(body string) (Token, error) {
-	db.mu.RLock()
 	dbStructure, err := db.loadDB()
-	db.mu.RUnlock()
 	if err != nil {
 		return Token{}, err
 	}
@@ -43,25 +35,22 @@ func (db *DB) GetToken(body string) (Token, error) {
 }
 
 func (db *DB) DeleteToken(body string) error {
-
-	db.mu.RLock()
-	dbStructure, err := db.loadDB()
-	db.mu.RUnlock()
-	if err != nil {
-		return err
-	}
-	if _, ok := dbStructure.Tokens[body]; ok {
+	errNotFound := errors.New("DB error: resource not found")
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Tokens[body]; !ok {
+			return errNotFound
+		}
 		log.Println("DB: refresh token found. deleting.")
 		delete(dbStructure.Tokens, body)
-		db.mu.Lock()
-		defer db.mu.Unlock()
-		err = db.writeDB(dbStructure)
-		if err != nil {
-			return err
-		}
-		log.Println("DB: Successfully deleted refresh token")
 		return nil
+	})
+	if errors.Is(err, errNotFound) {
+		log.Println("DB: Refresh token was not found")
+		return err
+	}
+	if err != nil {
+		return err
 	}
-	log.Println("DB: Refresh token was not found")
-	return errors.New("DB error: resource not found")
+	log.Println("DB: Successfully deleted refresh token")
+	return nil
 }
@@ -3,72 +3,77 @@ package database
 import (
 	"errors"
 	"log"
+	"strings"
+	"time"
 )
 
-func (db *DB) CreateUser(email string, password string, premium bool) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		log.Print("Couldn't load db while creating users")
-		return User{}, err
-	}
+var ErrEmailTaken = errors.New("email is already in use")
 
-	for i := range dbStructure.Users {
-		if dbStructure.Users[i].Email == email {
-			return User{}, errors.New("user already exists")
-		}
-	}
+// CreateUser stores a new unverified user along with the key pair their ActivityPub actor signs with
 
-	id := len(dbStructure.Users) + 1
+func (db *DB) CreateUser(email string, password string, premium bool, key ActorKey) (User, error) {
+	user := User{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		if dbStructure.emailTaken(email, 0) {
+			return ErrEmailTaken
+		}
 
-	user := User{
-		Email:    email,
-		ID:       id,
-		Password: password,
-		Premium:  premium,
-	}
+		id := dbStructure.nextUserID()
+		dbStructure.NextUserID = id + 1
 
-	dbStructure.Users[id] = user
+		user = User{
+			Email:         email,
+			ID:            id,
+			Password:      password,
+			Premium:       premium,
+			Unverified:    true,
+			FeedChangedAt: time.Now().UTC(),
+		}
 
-	db.mu.RLock()
-	err = db.writeDB(dbStructure)
-	db.mu.RUnlock()
+		dbStructure.Users[id] = user
+		key.UserID = id
+		dbStructure.ActorKeys[id] = key
+		return nil
+	})
 
 	if err != nil {
-		log.Print("Couldn't write user to db")
+		log.Printf("Couldn't write user to db: %v", err)
 		return User{}, err
 	}
 
 	return user, nil
 }
 
-func (db *DB) UpdateUser(id int, email string, password string, premium bool) (User, error) {
+// UpdateUser changes a user's email and password hash, leaving everything else such as their membership as stored
 
-	db.mu.RLock()
-	dbStructure, err := db.loadDB()
-	db.mu.RUnlock()
-
-	if err != nil {
-		log.Print("Couldn't load db while updating users")
-		return User{}, err
-	}
-
-	user, ok := dbStructure.Users[id]
-
-	if !ok {
-		return User{}, errors.New("user not found")
-	}
+func (db *DB) UpdateUser(id int, email string, password string) (User, error) {
+	user := User{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
 
-	user.Email = email
-	user.Password = password
-	user.ID = id
-	user.Premium = premium
+		if !ok {
+			return errors.New("user not found")
+		}
 
-	dbStructure.Users[id] = user
+		if dbStructure.emailTaken(email, id) {
+			return ErrEmailTaken
+		}
+		if !strings.EqualFold(user.Email, email) {
+			// a new address has to be verified again and links sent to the old one stop working
+			user.Unverified = true
+			user.VerificationNonce = ""
+		}
+		user.Email = email
+		user.Password = password
+		user.ID = id
 
-	err = db.writeDB(dbStructure)
+		dbStructure.Users[id] = user
+		return nil
+	})
 
 	if err != nil {
-		return User{}, errors.New("could not write database")
+		return User{}, err
 	}
 
 	return user, nil
@@ -101,15 +106,145 @@ func (db *DB) GetSingleUser(id int) (User, error) {
 	return user, nil
 }
 
+/* GetUserByEmail ignores case like the uniqueness check does, preferring an exact match
+because accounts differing only in case may exist from before that check */
+
 func (db *DB) GetUserByEmail(email string) (User, error) {
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return User{}, err
 	}
+	found := User{}
 	for _, u := range dbStructure.Users {
 		if u.Email == email {
 			return u, nil
 		}
+		if strings.EqualFold(u.Email, email) && (found.ID == 0 || u.ID < found.ID) {
+			found = u
+		}
+	}
+	if found.ID == 0 {
+		return User{}, ErrNotExist
+	}
+	return found, nil
+}
+
+// SetRole changes the user's role, validation of the role name is left to the auth package
+
+func (db *DB) SetRole(id int, role string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.Role = role
+		return nil
+	})
+}
+
+// SetPremium sets whether the user has a Chirpy Red membership
+
+func (db *DB) SetPremium(id int, premium bool) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.Premium = premium
+		return nil
+	})
+}
+
+// SetVerified marks a user's email as verified without a verification link, for accounts created by an operator
+
+func (db *DB) SetVerified(id int) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.Unverified = false
+		user.VerificationNonce = ""
+		return nil
+	})
+}
+
+// updateUser applies update to a user and saves it, leaving the database untouched if update fails
+
+func (db *DB) updateUser(id int, update func(user *User) error) (User, error) {
+	user := User{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		err := update(&user)
+		if err != nil {
+			return err
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+var ErrTooManyPins = errors.New("too many pinned chirps")
+
+// PinChirp pins a chirp to the user's profile, keeping at most limit pins; callers check the user may pin it
+
+func (db *DB) PinChirp(userID int, chirpID int, limit int) (User, error) {
+	user := User{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[userID]
+		if !ok {
+			return ErrNotExist
+		}
+		if _, ok := dbStructure.Chirps[chirpID]; !ok {
+			return ErrNotExist
+		}
+
+		for _, pinned := range user.Pinned {
+			if pinned == chirpID {
+				return nil
+			}
+		}
+		if len(user.Pinned) >= limit {
+			return ErrTooManyPins
+		}
+
+		user.Pinned = append(user.Pinned, chirpID)
+		dbStructure.Users[userID] = user
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (db *DB) UnpinChirp(userID int, chirpID int) (User, error) {
+	return db.updateUser(userID, func(user *User) error {
+		pinned := removeID(user.Pinned, chirpID)
+		if len(pinned) == len(user.Pinned) {
+			return ErrNotExist
+		}
+		user.Pinned = pinned
+		return nil
+	})
+}
+
+// emailTaken reports whether a user other than except already has the email, since accounts are looked up by email
+
+func (dbStructure *DBStructure) emailTaken(email string, except int) bool {
+	for _, u := range dbStructure.Users {
+		if u.ID != except && strings.EqualFold(u.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextUserID returns an ID no account has ever had, including accounts since deleted
+
+func (dbStructure *DBStructure) nextUserID() int {
+	id := max(dbStructure.NextUserID, 1)
+	for existing := range dbStructure.Users {
+		if existing >= id {
+			id = existing + 1
+		}
 	}
-	return User{}, ErrNotExist
+	return id
 }
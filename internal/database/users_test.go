@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	db := newTestDB(t)
+	alice, err := db.CreateUser("alice@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// accounts differing only in case can only exist in databases from before the uniqueness check
+	err = db.update(func(dbStructure *DBStructure) error {
+		dbStructure.Users[7] = User{ID: 7, Email: "Bob@example.com"}
+		dbStructure.Users[8] = User{ID: 8, Email: "bob@example.com"}
+		dbStructure.Users[9] = User{ID: 9, Email: "CAROL@example.com"}
+		dbStructure.Users[10] = User{ID: 10, Email: "Carol@example.com"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email  string
+		wantID int
+	}{
+		{email: "alice@example.com", wantID: alice.ID},
+		{email: "Alice@Example.com", wantID: alice.ID},
+		{email: "ALICE@EXAMPLE.COM", wantID: alice.ID},
+		{email: "bob@example.com", wantID: 8},
+		{email: "Bob@example.com", wantID: 7},
+		{email: "BOB@example.com", wantID: 7},
+		{email: "carol@example.com", wantID: 9},
+		{email: "alice@example.org", wantID: 0},
+		{email: "", wantID: 0},
+	}
+	for _, tt := range tests {
+		user, err := db.GetUserByEmail(tt.email)
+		if tt.wantID == 0 {
+			if !errors.Is(err, ErrNotExist) {
+				t.Errorf("GetUserByEmail(%q) = %v, %v, want ErrNotExist", tt.email, user.ID, err)
+			}
+			continue
+		}
+		if err != nil || user.ID != tt.wantID {
+			t.Errorf("GetUserByEmail(%q) = %v, %v, want %v", tt.email, user.ID, err, tt.wantID)
+		}
+	}
+}
+
+func TestEmailUniqueness(t *testing.T) {
+	db := newTestDB(t)
+	alice, err := db.CreateUser("alice@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := db.CreateUser("bob@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SetVerified(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		id           int
+		email        string
+		wantErr      error
+		wantVerified bool
+	}{
+		{name: "another account's address", id: bob.ID, email: "Alice@example.com", wantErr: ErrEmailTaken},
+		{name: "own address in another case", id: alice.ID, email: "ALICE@example.com", wantVerified: true},
+		{name: "new address", id: alice.ID, email: "alice@example.org", wantVerified: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := db.UpdateUser(tt.id, tt.email, "hash")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("UpdateUser() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Unverified == tt.wantVerified {
+				t.Errorf("UpdateUser() verified = %v, want %v", !user.Unverified, tt.wantVerified)
+			}
+		})
+	}
+
+	_, err = db.CreateUser("BOB@example.com", "hash", false, ActorKey{})
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("CreateUser() error = %v, want ErrEmailTaken", err)
+	}
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+var ErrInvalidVerification = errors.New("verification link is invalid or has already been used")
+
+// SetVerificationNonce records the nonce of the newest verification link, invalidating earlier links
+
+func (db *DB) SetVerificationNonce(id int, nonce string) (User, error) {
+	return db.updateUser(id, func(user *User) error {
+		user.VerificationNonce = nonce
+		return nil
+	})
+}
+
+// VerifyEmail marks the user's email as verified if nonce belongs to their newest link, consuming it
+
+func (db *DB) VerifyEmail(id int, nonce string) (User, error) {
+	user, err := db.updateUser(id, func(user *User) error {
+		if nonce == "" || user.VerificationNonce != nonce {
+			return ErrInvalidVerification
+		}
+		user.Unverified = false
+		user.VerificationNonce = ""
+		return nil
+	})
+	if errors.Is(err, ErrNotExist) {
+		return User{}, ErrInvalidVerification
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	log.Printf("DB: Verified email of user %v", id)
+	return user, nil
+}
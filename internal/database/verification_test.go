@@ -0,0 +1,89 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Unverified {
+		t.Fatal("new user is already verified")
+	}
+	_, err = db.SetVerificationNonce(user.ID, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SetVerificationNonce(user.ID, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cases run in order against the same user
+	tests := []struct {
+		name    string
+		id      int
+		nonce   string
+		wantErr error
+	}{
+		{name: "empty nonce", id: user.ID, nonce: "", wantErr: ErrInvalidVerification},
+		{name: "superseded link", id: user.ID, nonce: "old", wantErr: ErrInvalidVerification},
+		{name: "missing user", id: 404, nonce: "new", wantErr: ErrInvalidVerification},
+		{name: "newest link", id: user.ID, nonce: "new"},
+		{name: "link used twice", id: user.ID, nonce: "new", wantErr: ErrInvalidVerification},
+	}
+	for _, tt := range tests {
+		got, err := db.VerifyEmail(tt.id, tt.nonce)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%v: VerifyEmail() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && (got.Unverified || got.VerificationNonce != "") {
+			t.Errorf("%v: VerifyEmail() = %+v, want verified with the nonce consumed", tt.name, got)
+		}
+	}
+}
+
+func TestChangingEmailNeedsVerification(t *testing.T) {
+	tests := []struct {
+		name           string
+		email          string
+		wantUnverified bool
+	}{
+		{name: "same address", email: "user@example.com"},
+		{name: "same address in another case", email: "User@Example.com"},
+		{name: "new address", email: "new@example.com", wantUnverified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			user, err := db.CreateUser("user@example.com", "hash", false, ActorKey{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.SetVerified(user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = db.SetVerificationNonce(user.ID, "pending")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err = db.UpdateUser(user.ID, tt.email, "hash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Unverified != tt.wantUnverified {
+				t.Errorf("unverified = %v, want %v", user.Unverified, tt.wantUnverified)
+			}
+			// links sent to the old address stop working once it changes
+			if tt.wantUnverified && user.VerificationNonce != "" {
+				t.Errorf("nonce = %q, want the old link invalidated", user.VerificationNonce)
+			}
+		})
+	}
+}
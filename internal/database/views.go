@@ -0,0 +1,39 @@
+package database
+
+// AddViews merges a batch of view counts, keyed by chirp ID then day, into the database in a single write
+
+func (db *DB) AddViews(views map[int]map[string]int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		for chirpID, days := range views {
+			// views of chirps deleted since they were recorded are dropped
+			if _, ok := dbStructure.Chirps[chirpID]; !ok {
+				continue
+			}
+			if dbStructure.Views[chirpID] == nil {
+				dbStructure.Views[chirpID] = map[string]int{}
+			}
+			for day, n := range days {
+				dbStructure.Views[chirpID][day] += n
+			}
+		}
+		return nil
+	})
+}
+
+// GetViews returns the daily view counts for each of the given chirps
+
+func (db *DB) GetViews(chirpIDs []int) (map[int]map[string]int, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	views := map[int]map[string]int{}
+	for _, id := range chirpIDs {
+		views[id] = map[string]int{}
+		for day, n := range dbStructure.Views[id] {
+			views[id][day] = n
+		}
+	}
+	return views, nil
+}
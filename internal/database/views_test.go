@@ -0,0 +1,41 @@
+package database
+
+import "testing"
+
+func TestAddViews(t *testing.T) {
+	db := newTestDB(t)
+	chirp, err := db.CreateChirp(Chirp{Author: 1, Body: "seen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := db.CreateChirp(Chirp{Author: 1, Body: "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.DeleteChirp(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := []map[int]map[string]int{
+		{chirp.ID: {"2024-01-01": 2}, deleted.ID: {"2024-01-01": 5}},
+		{chirp.ID: {"2024-01-01": 1, "2024-01-02": 3}},
+	}
+	for _, batch := range batches {
+		err := db.AddViews(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	views, err := db.GetViews([]int{chirp.ID, deleted.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views[chirp.ID]["2024-01-01"] != 3 || views[chirp.ID]["2024-01-02"] != 3 {
+		t.Errorf("views = %v, want batches merged per day", views[chirp.ID])
+	}
+	if len(views[deleted.ID]) != 0 {
+		t.Errorf("views of a deleted chirp = %v, want them dropped", views[deleted.ID])
+	}
+}
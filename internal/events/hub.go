@@ -0,0 +1,131 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// Event is a committed chirp change numbered in publish order
+
+type Event struct {
+	ID    uint64
+	Type  string
+	Chirp database.Chirp
+}
+
+/* Hub fans chirp changes out to live subscribers and keeps the most recent events
+so a reconnecting client can resume from the last event it saw */
+
+type Hub struct {
+	mu         *sync.Mutex
+	lastID     uint64
+	replay     []Event
+	replaySize int
+	bufferSize int
+	subs       map[*Subscription]struct{}
+}
+
+// Subscription receives events until it is closed or falls too far behind
+
+type Subscription struct {
+	hub *Hub
+	ch  chan Event
+}
+
+/* NewHub numbers events from the boot time in microseconds, so IDs keep increasing across restarts and a client
+resuming from an event of an earlier run is told to reset instead of being given this run's events as if they
+followed it; the IDs stay below 2^53 so JavaScript clients can hold them */
+
+func NewHub(replaySize int, bufferSize int) *Hub {
+	return newHub(replaySize, bufferSize, uint64(time.Now().UnixMicro()))
+}
+
+func newHub(replaySize int, bufferSize int, epoch uint64) *Hub {
+	return &Hub{
+		mu:         &sync.Mutex{},
+		lastID:     epoch,
+		replaySize: replaySize,
+		bufferSize: bufferSize,
+		subs:       map[*Subscription]struct{}{},
+	}
+}
+
+// Publish numbers a change and delivers it to every subscriber; subscribers whose buffer is full are dropped rather than blocking
+
+func (h *Hub) Publish(change database.Change) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event := Event{
+		ID:    h.lastID,
+		Type:  change.Type,
+		Chirp: change.Chirp,
+	}
+
+	h.replay = append(h.replay, event)
+	if len(h.replay) > h.replaySize {
+		h.replay = h.replay[len(h.replay)-h.replaySize:]
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+/* Subscribe registers a new subscriber and returns the buffered events after lastID
+complete is false when events after lastID have already been evicted from the replay buffer, or when lastID
+was never handed out by this hub, as happens for IDs from before a restart or from the future */
+
+func (h *Hub) Subscribe(lastID uint64) ([]Event, bool, *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	replay := []Event{}
+	complete := true
+	if lastID > h.lastID {
+		complete = false
+	} else if lastID > 0 && lastID < h.lastID {
+		oldest := h.lastID + 1
+		if len(h.replay) > 0 {
+			oldest = h.replay[0].ID
+		}
+		complete = oldest <= lastID+1
+		for _, event := range h.replay {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		hub: h,
+		ch:  make(chan Event, h.bufferSize),
+	}
+	h.subs[sub] = struct{}{}
+	return replay, complete, sub
+}
+
+// Events is closed when the subscription is closed or dropped for falling behind
+
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
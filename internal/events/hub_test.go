@@ -0,0 +1,74 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestSubscribeResume(t *testing.T) {
+	const epoch = 1000
+
+	// the hub keeps the last 3 of 5 events, numbered 1001 to 1005
+	tests := []struct {
+		name     string
+		lastID   uint64
+		replay   []uint64
+		complete bool
+	}{
+		{name: "fresh subscriber", lastID: 0, replay: []uint64{}, complete: true},
+		{name: "up to date", lastID: 1005, replay: []uint64{}, complete: true},
+		{name: "within the replay buffer", lastID: 1003, replay: []uint64{1004, 1005}, complete: true},
+		{name: "just before the replay buffer", lastID: 1002, replay: []uint64{1003, 1004, 1005}, complete: true},
+		{name: "evicted", lastID: 1001, replay: []uint64{1003, 1004, 1005}, complete: false},
+		{name: "from before a restart", lastID: 42, replay: []uint64{1003, 1004, 1005}, complete: false},
+		{name: "from the future", lastID: 2000, replay: []uint64{}, complete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := newHub(3, 8, epoch)
+			for i := 0; i < 5; i++ {
+				hub.Publish(database.Change{Type: database.ChangeChirpCreated})
+			}
+
+			replay, complete, sub := hub.Subscribe(tt.lastID)
+			defer sub.Close()
+			if complete != tt.complete {
+				t.Errorf("complete = %v, want %v", complete, tt.complete)
+			}
+			ids := []uint64{}
+			for _, event := range replay {
+				ids = append(ids, event.ID)
+			}
+			if len(ids) != len(tt.replay) {
+				t.Fatalf("replayed %v, want %v", ids, tt.replay)
+			}
+			for i := range ids {
+				if ids[i] != tt.replay[i] {
+					t.Fatalf("replayed %v, want %v", ids, tt.replay)
+				}
+			}
+		})
+	}
+}
+
+func TestEventIDsIncreaseAcrossRestarts(t *testing.T) {
+	before := NewHub(10, 8)
+	last := before.Publish(database.Change{Type: database.ChangeChirpCreated})
+
+	// a restart takes far longer than this, the hub only needs the clock to have moved on
+	time.Sleep(time.Millisecond)
+	after := NewHub(10, 8)
+	first := after.Publish(database.Change{Type: database.ChangeChirpCreated})
+	if first.ID <= last.ID {
+		t.Errorf("first event after a restart has ID %v, not above %v", first.ID, last.ID)
+	}
+
+	_, complete, sub := after.Subscribe(last.ID)
+	defer sub.Close()
+	if complete {
+		t.Error("resuming from an event of the earlier run was reported complete")
+	}
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	NotificationFollow = "follow"
+	NotificationQuote  = "quote"
+	NotificationDirect = "direct"
+)
+
+type Notification struct {
+	Type      string    `json:"type"`
+	Actor     int       `json:"actor_id"`
+	ChirpID   int       `json:"chirp_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notifier delivers live notifications to every connection a user has open; nothing is kept for offline users
+
+type Notifier struct {
+	mu         *sync.Mutex
+	bufferSize int
+	subs       map[int]map[*NotificationSubscription]struct{}
+}
+
+type NotificationSubscription struct {
+	notifier *Notifier
+	userID   int
+	ch       chan Notification
+}
+
+func NewNotifier(bufferSize int) *Notifier {
+	return &Notifier{
+		mu:         &sync.Mutex{},
+		bufferSize: bufferSize,
+		subs:       map[int]map[*NotificationSubscription]struct{}{},
+	}
+}
+
+// Notify sends n to userID's open connections, dropping it for connections that are not keeping up
+
+func (n *Notifier) Notify(userID int, notification Notification) {
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now().UTC()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for sub := range n.subs[userID] {
+		select {
+		case sub.ch <- notification:
+		default:
+		}
+	}
+}
+
+func (n *Notifier) Subscribe(userID int) *NotificationSubscription {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sub := &NotificationSubscription{
+		notifier: n,
+		userID:   userID,
+		ch:       make(chan Notification, n.bufferSize),
+	}
+	if n.subs[userID] == nil {
+		n.subs[userID] = map[*NotificationSubscription]struct{}{}
+	}
+	n.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *NotificationSubscription) Notifications() <-chan Notification {
+	return s.ch
+}
+
+func (s *NotificationSubscription) Close() {
+	s.notifier.mu.Lock()
+	defer s.notifier.mu.Unlock()
+
+	if _, ok := s.notifier.subs[s.userID][s]; ok {
+		delete(s.notifier.subs[s.userID], s)
+		if len(s.notifier.subs[s.userID]) == 0 {
+			delete(s.notifier.subs, s.userID)
+		}
+		close(s.ch)
+	}
+}
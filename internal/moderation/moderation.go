@@ -0,0 +1,316 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Action string
+
+const (
+	ActionMask   Action = "mask"
+	ActionReject Action = "reject"
+	ActionFlag   Action = "flag"
+)
+
+const mask = "****"
+
+var ErrTooLong = errors.New("Chirp is too long")
+
+// RejectedError is returned by Moderate when a word matches a rule with the reject action
+
+type RejectedError struct {
+	Rule string
+}
+
+func (e RejectedError) Error() string {
+	return fmt.Sprintf("Chirp rejected by moderation rule %q", e.Rule)
+}
+
+type Rule struct {
+	Name   string   `json:"name"`
+	Action Action   `json:"action"`
+	Words  []string `json:"words"`
+}
+
+type Config struct {
+	MaxLength int    `json:"max_length"`
+	Rules     []Rule `json:"rules"`
+}
+
+// Result holds the moderated body along with any rules that flagged it for review
+
+type Result struct {
+	Body    string
+	Flagged bool
+	Reasons []string
+}
+
+type Moderator struct {
+	path  string
+	mu    *sync.RWMutex
+	cfg   Config
+	words map[string]Rule
+}
+
+// DefaultConfig mirrors the filter chirpy shipped with before word lists were configurable
+
+func DefaultConfig() Config {
+	return Config{
+		MaxLength: 140,
+		Rules: []Rule{
+			{
+				Name:   "profanity",
+				Action: ActionMask,
+				Words:  []string{"kerfuffle", "sharbert", "fornax"},
+			},
+		},
+	}
+}
+
+// NewModerator loads the rules found at path, falling back to DefaultConfig when the file does not exist
+
+func NewModerator(path string) (*Moderator, error) {
+	m := &Moderator{
+		path: path,
+		mu:   &sync.RWMutex{},
+	}
+	err := m.Reload()
+	return m, err
+}
+
+/* Reload re-reads the config file so word lists can be changed without restarting the server
+a word may only belong to one rule, so a later rule can't quietly weaken an earlier one; on error the old rules stay in place */
+
+func (m *Moderator) Reload() error {
+	cfg, err := loadConfig(m.path)
+	if err != nil {
+		return err
+	}
+
+	words := map[string]Rule{}
+	for _, rule := range cfg.Rules {
+		switch rule.Action {
+		case ActionMask, ActionReject, ActionFlag:
+		default:
+			return fmt.Errorf("moderation: rule %q has unknown action %q", rule.Name, rule.Action)
+		}
+		for _, word := range rule.Words {
+			key := normalize(word)
+			if existing, ok := words[key]; ok && existing.Name != rule.Name {
+				return fmt.Errorf("moderation: word %q is in both rule %q and rule %q", word, existing.Name, rule.Name)
+			}
+			words[key] = rule
+		}
+	}
+
+	m.mu.Lock()
+	m.cfg = cfg
+	m.words = words
+	m.mu.Unlock()
+
+	log.Printf("MOD: Loaded %v rules (%v words)", len(cfg.Rules), len(words))
+	return nil
+}
+
+func loadConfig(path string) (Config, error) {
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("MOD: %v not found, using default rules", path)
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{}
+	err = json.Unmarshal(dat, &cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = DefaultConfig().MaxLength
+	}
+	return cfg, nil
+}
+
+/* Moderate runs body through the pipeline:
+length is measured in user-perceived characters rather than bytes,
+each word is normalized before matching so case, accents and compatibility forms can't dodge a rule,
+and punctuation around a word is preserved when it is masked */
+
+func (m *Moderator) Moderate(body string) (Result, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// 1: reject chirps over the configured length
+
+	if Length(body) > m.cfg.MaxLength {
+		return Result{}, ErrTooLong
+	}
+
+	// 2: walk the words of the body, applying the action of any matching rule
+
+	result := Result{}
+	var sb strings.Builder
+	var rejected error
+	flagged := map[string]struct{}{}
+
+	forEachWord(body, func(text string, isWord bool) {
+		if !isWord {
+			sb.WriteString(text)
+			return
+		}
+		rule, ok := m.words[normalize(text)]
+		if !ok {
+			sb.WriteString(text)
+			return
+		}
+		switch rule.Action {
+		case ActionMask:
+			sb.WriteString(mask)
+		case ActionReject:
+			if rejected == nil {
+				rejected = RejectedError{Rule: rule.Name}
+			}
+			sb.WriteString(text)
+		case ActionFlag:
+			if _, ok := flagged[rule.Name]; !ok {
+				flagged[rule.Name] = struct{}{}
+				result.Reasons = append(result.Reasons, rule.Name)
+			}
+			sb.WriteString(text)
+		}
+	})
+
+	// 3: a rejection wins over any other action
+
+	if rejected != nil {
+		return Result{}, rejected
+	}
+
+	result.Body = sb.String()
+	result.Flagged = len(result.Reasons) > 0
+	return result, nil
+}
+
+// forEachWord splits s into alternating runs of word and non-word text, calling fn for each run in order
+
+func forEachWord(s string, fn func(text string, isWord bool)) {
+	start := 0
+	inWord := false
+	for i, r := range s {
+		w := isWordRune(r)
+		if i == 0 {
+			inWord = w
+			continue
+		}
+		if w != inWord {
+			fn(s[start:i], inWord)
+			start = i
+			inWord = w
+		}
+	}
+	if start < len(s) {
+		fn(s[start:], inWord)
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.M, r)
+}
+
+// normalize folds compatibility forms, strips accents and lowercases a word before lookup
+
+func normalize(word string) string {
+	var sb strings.Builder
+	for _, r := range norm.NFKD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// maxCharacterRunes bounds how many runes one character can absorb, so stacked marks can't hide a long body behind a short length
+
+const maxCharacterRunes = 10
+
+/* Length counts user-perceived characters: combining marks, variation selectors, emoji modifiers and tags
+are counted with the character they attach to, as are pairs of regional indicators and
+zero width joiner sequences between two pictographs; a character longer than maxCharacterRunes counts again */
+
+func Length(s string) int {
+	count := 0
+	runes := 0
+	var base rune
+	joiner := false
+	for _, r := range norm.NFC.String(s) {
+		attached := false
+		switch {
+		case runes == 0 || runes >= maxCharacterRunes:
+		case r == '\u200d', isExtender(r):
+			attached = true
+		case joiner:
+			attached = isPictographic(base) && isPictographic(r)
+		case isRegionalIndicator(r):
+			// flags are made of two regional indicators
+			attached = runes == 1 && isRegionalIndicator(base)
+		}
+		if !attached {
+			count++
+			runes = 0
+		}
+		runes++
+		joiner = r == '\u200d'
+		if !joiner && !isExtender(r) {
+			base = r
+		}
+	}
+	return count
+}
+
+func isExtender(r rune) bool {
+	return unicode.Is(unicode.M, r) || isVariationSelector(r) || isEmojiModifier(r) || isTag(r)
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF)
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isTag matches the tag characters that follow a black flag in subdivision flags
+
+func isTag(r rune) bool {
+	return r >= 0xE0020 && r <= 0xE007F
+}
+
+// isPictographic approximates the Extended_Pictographic property, which the unicode package doesn't provide
+
+func isPictographic(r rune) bool {
+	switch {
+	case r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139, r == 0x3030, r == 0x303D:
+		return true
+	case r >= 0x2190 && r <= 0x21FF, r >= 0x2300 && r <= 0x23FF, r >= 0x25A0 && r <= 0x27BF, r >= 0x2900 && r <= 0x297F, r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	case isRegionalIndicator(r), isEmojiModifier(r):
+		return false
+	}
+	return r >= 0x1F000 && r <= 0x1FAFF
+}
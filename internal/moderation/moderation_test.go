@@ -0,0 +1,161 @@
+package moderation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestModerator(t *testing.T, config string) *Moderator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	err := os.WriteFile(path, []byte(config), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewModerator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{name: "ascii", s: "hello", want: 5},
+		{name: "empty", s: "", want: 0},
+		{name: "precomposed accent", s: "caf\u00e9", want: 4},
+		{name: "combining accent", s: "cafe\u0301", want: 4},
+		{name: "variation selector", s: "\u2764\ufe0f", want: 1},
+		{name: "skin tone modifier", s: "\U0001F44D\U0001F3FD", want: 1},
+		{name: "zero width joiner sequence", s: "\U0001F468\u200d\U0001F469\u200d\U0001F467", want: 1},
+		{name: "flag", s: "\U0001F1FA\U0001F1F8", want: 1},
+		{name: "two flags", s: "\U0001F1FA\U0001F1F8\U0001F1EC\U0001F1E7", want: 2},
+		{name: "cjk", s: "日本語", want: 3},
+		{name: "subdivision flag", s: "\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", want: 1},
+		{name: "kiss with skin tones", s: "\U0001F468\U0001F3FB\u200d\u2764\ufe0f\u200d\U0001F48B\u200d\U0001F468\U0001F3FC", want: 1},
+		{name: "joiners between letters", s: strings.Repeat("a\u200d", 1000) + "a", want: 1001},
+		{name: "joiner before a letter", s: "\U0001F468\u200da", want: 2},
+		{name: "stacked combining marks", s: "q" + strings.Repeat("\u0301", 29), want: 3},
+		{name: "three regional indicators", s: "\U0001F1FA\U0001F1F8\U0001F1EC", want: 2},
+	}
+	for _, tt := range tests {
+		if got := Length(tt.s); got != tt.want {
+			t.Errorf("%v: Length(%q) = %v, want %v", tt.name, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestModerate(t *testing.T) {
+	m := newTestModerator(t, `{
+		"max_length": 24,
+		"rules": [
+			{"name": "profanity", "action": "mask", "words": ["kerfuffle", "fornax"]},
+			{"name": "spam", "action": "reject", "words": ["casino"]},
+			{"name": "review", "action": "flag", "words": ["refund", "lawsuit"]}
+		]
+	}`)
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		reasons []string
+		err     error
+	}{
+		{name: "clean", body: "hello world", want: "hello world"},
+		{name: "masked", body: "what a kerfuffle", want: "what a ****"},
+		{name: "punctuation is kept", body: "Kerfuffle! (fornax)", want: "****! (****)"},
+		{name: "case and accents", body: "KE\u0301RFUFFLE", want: "****"},
+		{name: "compatibility forms", body: "ｆｏｒｎａｘ", want: "****"},
+		{name: "part of a word", body: "kerfuffles", want: "kerfuffles"},
+		{name: "flagged once per rule", body: "refund lawsuit refund", want: "refund lawsuit refund", reasons: []string{"review"}},
+		{name: "rejected", body: "casino kerfuffle", err: RejectedError{Rule: "spam"}},
+		{name: "at the limit", body: strings.Repeat("a", 24), want: strings.Repeat("a", 24)},
+		{name: "over the limit", body: strings.Repeat("a", 25), err: ErrTooLong},
+		{name: "joiners don't hide length", body: strings.Repeat("a\u200d", 24) + "a", err: ErrTooLong},
+		{name: "limit counts characters", body: strings.Repeat("\u2764\ufe0f", 24), want: strings.Repeat("\u2764\ufe0f", 24)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.Moderate(tt.body)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Moderate() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Moderate() error = %v", err)
+			}
+			if result.Body != tt.want {
+				t.Errorf("Moderate() body = %q, want %q", result.Body, tt.want)
+			}
+			if result.Flagged != (len(tt.reasons) > 0) || strings.Join(result.Reasons, ",") != strings.Join(tt.reasons, ",") {
+				t.Errorf("Moderate() flagged = %v %v, want %v", result.Flagged, result.Reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "valid", config: `{"rules": [{"name": "a", "action": "mask", "words": ["one"]}]}`},
+		{name: "unknown action", config: `{"rules": [{"name": "a", "action": "shout", "words": ["one"]}]}`, wantErr: true},
+		{name: "word in two rules", config: `{"rules": [{"name": "a", "action": "reject", "words": ["one"]}, {"name": "b", "action": "flag", "words": ["ONE"]}]}`, wantErr: true},
+		{name: "repeated word in one rule", config: `{"rules": [{"name": "a", "action": "mask", "words": ["one", "one"]}]}`},
+		{name: "malformed", config: `{"rules": [`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModerator(t, `{"rules": [{"name": "old", "action": "mask", "words": ["stale"]}]}`)
+			err := os.WriteFile(m.path, []byte(tt.config), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// a failed reload keeps the old rules in place
+			result, err := m.Moderate("stale")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if masked := result.Body == mask; masked != tt.wantErr {
+				t.Errorf("old rule still applied = %v, want %v", masked, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMissingConfigUsesDefaults(t *testing.T) {
+	m, err := NewModerator(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.Moderate("sharbert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Body != mask {
+		t.Errorf("Moderate() body = %q, want the default rules to mask it", result.Body)
+	}
+	if _, err := m.Moderate(strings.Repeat("a", DefaultConfig().MaxLength+1)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Moderate() error = %v, want ErrTooLong at the default length", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -27,3 +29,17 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	w.Write(dat)
 }
+
+// respondWithPolicyError lists each broken password rule so clients can show them next to the field
+
+func respondWithPolicyError(w http.ResponseWriter, err *auth.PolicyError) {
+	type errorResponse struct {
+		Error      string           `json:"error"`
+		Violations []auth.Violation `json:"violations"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:      "password does not meet the policy",
+		Violations: err.Violations,
+	})
+	log.Printf("API Error: %v: %v\n", http.StatusBadRequest, err)
+}
@@ -4,17 +4,39 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/clinto-bean/golang-servers/internal/activitypub"
+	"github.com/clinto-bean/golang-servers/internal/analytics"
+	"github.com/clinto-bean/golang-servers/internal/auth"
 	db "github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/events"
+	"github.com/clinto-bean/golang-servers/internal/mail"
+	"github.com/clinto-bean/golang-servers/internal/moderation"
 	godotenv "github.com/joho/godotenv"
 )
 
 type apiConfig struct {
-	fileserverHits int
-	DB             *db.DB
-	JWTSecret      string
-	Expiration     int
-	APIKey         string
+	fileserverHits  int
+	DB              *db.DB
+	JWTSecret       string
+	Expiration      int
+	APIKey          string
+	Moderator       *moderation.Moderator
+	Views           *analytics.Recorder
+	Federation      *activitypub.Client
+	Events          *events.Hub
+	Notifier        *events.Notifier
+	AvatarDir       string
+	Mailer          mail.Mailer
+	PasswordPolicy  auth.PasswordPolicy
+	AccountThrottle *auth.Throttle
+	IPThrottle      *auth.Throttle
+	ResetThrottle   *auth.Throttle
+	ResetIPThrottle *auth.Throttle
+	Policy          *auth.Policy
+	PublicURL       string
 }
 
 func main() {
@@ -27,11 +49,71 @@ func main() {
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 	polkaApiKey := os.Getenv("POLKA_API_KEY")
+	moderationPath := os.Getenv("MODERATION_CONFIG")
+	if moderationPath == "" {
+		moderationPath = "moderation.json"
+	}
+	avatarDir := os.Getenv("AVATAR_DIR")
+	if avatarDir == "" {
+		avatarDir = "avatars"
+	}
+	// PUBLIC_URL is where clients reach the server, used for links in emails instead of the request's Host header
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
 
 	db, err := db.NewDB("database.json")
 	if err != nil {
 		log.Fatal(err)
 	}
+	// accounts created before actor keys were made at signup get theirs now rather than on a remote server's request
+	created, err := db.EnsureActorKeys(activitypub.GenerateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if created > 0 {
+		log.Printf("Created ActivityPub keys for %v existing users", created)
+	}
+
+	// MAILER selects smtp, or file (MAIL_FILE) and stdout for local testing
+	var mailer mail.Mailer
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		mailer = mail.NewSMTPMailer(os.Getenv("SMTP_ADDR"), os.Getenv("MAIL_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		mailer = mail.NewFileMailer(os.Getenv("MAIL_FILE"))
+	default:
+		mailer = mail.NewFileMailer("-")
+	}
+
+	// PASSWORD_POLICY points at a JSON policy and BREACHED_PASSWORDS at an optional breached hash list
+	policyPath := os.Getenv("PASSWORD_POLICY")
+	if policyPath == "" {
+		policyPath = "password_policy.json"
+	}
+	passwordPolicy, err := auth.LoadPasswordPolicy(policyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwordPolicy.Breached, err = auth.LoadBreachedList(os.Getenv("BREACHED_PASSWORDS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// `chirpy create-admin -email EMAIL` promotes or creates the first admin then exits
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		err = createAdmin(db, passwordPolicy, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	moderator, err := moderation.NewModerator(moderationPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	apiCfg := apiConfig{
 		fileserverHits: 0,
@@ -39,35 +121,137 @@ func main() {
 		JWTSecret:      jwtSecret,
 		Expiration:     5,
 		APIKey:         polkaApiKey,
+		Moderator:      moderator,
+		Views:          analytics.NewRecorder(db, viewDedupWindow, maxPendingViews),
+		Federation:     activitypub.NewClient(),
+		Events:         events.NewHub(streamReplaySize, streamBufferSize),
+		Notifier:       events.NewNotifier(wsNotificationSize),
+		AvatarDir:      avatarDir,
+		Mailer:         mailer,
+		PasswordPolicy: passwordPolicy,
+		Policy:         auth.DefaultPolicy(),
+		AccountThrottle: auth.NewThrottle(auth.ThrottleConfig{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			LockoutAfter: 10,
+			LockoutFor:   15 * time.Minute,
+			ForgetAfter:  time.Hour,
+		}),
+		// addresses get more room than accounts since many users can share one behind a NAT
+		IPThrottle: auth.NewThrottle(auth.ThrottleConfig{
+			FreeAttempts: 20,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			LockoutAfter: 100,
+			LockoutFor:   time.Hour,
+			ForgetAfter:  time.Hour,
+		}),
+		// every reset request counts against the address it is for and the address it came from
+		ResetThrottle: auth.NewThrottle(auth.ThrottleConfig{
+			FreeAttempts: 3,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			LockoutAfter: 10,
+			LockoutFor:   time.Hour,
+			ForgetAfter:  24 * time.Hour,
+		}),
+		ResetIPThrottle: auth.NewThrottle(auth.ThrottleConfig{
+			FreeAttempts: 10,
+			BaseDelay:    time.Minute,
+			MaxDelay:     time.Hour,
+			LockoutAfter: 50,
+			LockoutFor:   24 * time.Hour,
+			ForgetAfter:  24 * time.Hour,
+		}),
+		PublicURL: publicURL,
 	}
+	db.OnChange(apiCfg.publishChange)
 
 	mux := http.NewServeMux()
 	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(root))))
 	mux.Handle("/app/*", fsHandler)
 
 	mux.HandleFunc("GET /api/healthz", apiCfg.handlerReadiness)
-	mux.HandleFunc("GET /api/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /api/reset", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerReset))
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetAllChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerGetSingleChirp)
 	mux.HandleFunc("GET /api/users/", apiCfg.handlerGetAllUsers)
 	mux.HandleFunc("GET /api/users/{userID}", apiCfg.handlerGetSingleUser)
 	mux.HandleFunc("POST /api/users", apiCfg.handleCreateUsers)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerMetrics))
 	mux.HandleFunc("POST /api/login", apiCfg.handlerUserLogin)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("DELETE /api/users", apiCfg.handlerDeleteUser)
+	mux.HandleFunc("GET /api/me/export", apiCfg.handlerExportUser)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerDeleteChirp)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUser)
+	mux.HandleFunc("POST /admin/moderation/reload", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerReloadModeration))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", apiCfg.handlerReportChirp)
+	mux.HandleFunc("GET /admin/moderation/queue", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerModerationQueue))
+	mux.HandleFunc("POST /admin/moderation/chirps/{chirpID}", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerModerateChirp))
+	mux.HandleFunc("GET /admin/moderation/decisions", apiCfg.requireRole(auth.RoleModerator, apiCfg.handlerModerationDecisions))
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.handlerFollowUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handlerUnfollowUser)
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.handlerBlockUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.handlerUnblockUser)
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.handlerMuteUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.handlerUnmuteUser)
+	mux.HandleFunc("GET /api/blocks", apiCfg.handlerGetBlocks)
+	mux.HandleFunc("GET /api/mutes", apiCfg.handlerGetMutes)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/bookmark", apiCfg.handlerBookmarkChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/bookmark", apiCfg.handlerDeleteBookmark)
+	mux.HandleFunc("GET /api/bookmarks", apiCfg.handlerGetBookmarks)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/pin", apiCfg.handlerPinChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/pin", apiCfg.handlerUnpinChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/vote", apiCfg.handlerVotePoll)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/quotes", apiCfg.handlerGetQuotes)
+	mux.HandleFunc("GET /api/me/analytics", apiCfg.handlerGetAnalytics)
+	mux.HandleFunc("POST /api/chirps/batch", apiCfg.handlerChirpsBatch)
+	mux.HandleFunc("GET /api/users/{userID}/{feed}", apiCfg.handlerUserFeeds)
+	mux.HandleFunc("GET /.well-known/webfinger", apiCfg.handlerWebFinger)
+	mux.HandleFunc("GET /ap/users/{userID}", apiCfg.handlerActor)
+	mux.HandleFunc("GET /ap/users/{userID}/outbox", apiCfg.handlerOutbox)
+	mux.HandleFunc("GET /ap/users/{userID}/followers", apiCfg.handlerFollowersCollection)
+	mux.HandleFunc("POST /ap/users/{userID}/inbox", apiCfg.handlerInbox)
+	mux.HandleFunc("GET /ap/chirps/{chirpID}", apiCfg.handlerNote)
+	mux.HandleFunc("GET /api/stream", apiCfg.handlerStream)
+	mux.HandleFunc("GET /api/ws", apiCfg.handlerWebsocket)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", apiCfg.handlerGetUserByHandle)
+	mux.HandleFunc("PUT /api/users/me/profile", apiCfg.handlerUpdateProfile)
+	mux.HandleFunc("PUT /api/users/me/avatar", apiCfg.handlerUploadAvatar)
+	mux.HandleFunc("GET /avatars/{file}", apiCfg.handlerGetAvatar)
+	mux.HandleFunc("GET /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerResendVerification)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerUnlockUser))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerSetRole))
+	mux.HandleFunc("GET /admin/users", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminListUsers))
+	mux.HandleFunc("POST /admin/users/{userID}/suspend", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerSuspendUser))
+	mux.HandleFunc("POST /admin/users/{userID}/ban", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerBanUser))
+	mux.HandleFunc("POST /admin/users/{userID}/reinstate", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerReinstateUser))
+	mux.HandleFunc("POST /admin/users/{userID}/logout", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerLogoutUser))
+	mux.HandleFunc("POST /admin/users/{userID}/impersonate", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerImpersonateUser))
+	mux.HandleFunc("GET /admin/audit", apiCfg.requireRole(auth.RoleAdmin, apiCfg.handlerAdminAudit))
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/mfa/totp/enroll", apiCfg.handlerEnrollTOTP)
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.handlerConfirmTOTP)
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.handlerDisableTOTP)
 
-	corsMux := middlewareCors(mux)
+	corsMux := middlewareCors(apiCfg.middlewareImpersonation(mux))
 
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: corsMux,
 	}
 
+	go apiCfg.reapExpiredChirps(reapInterval)
+	go apiCfg.Views.Run(viewFlushInterval)
+
 	log.Printf("Server running on port %v", port)
 	log.Fatal(srv.ListenAndServe())
 }
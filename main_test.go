@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/analytics"
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+	"github.com/clinto-bean/golang-servers/internal/events"
+	"github.com/clinto-bean/golang-servers/internal/mail"
+	"github.com/clinto-bean/golang-servers/internal/moderation"
+)
+
+// newTestConfig returns a config backed by a fresh database, with the services most handlers need
+
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator, err := moderation.NewModerator(filepath.Join(t.TempDir(), "moderation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		DB:             store,
+		JWTSecret:      "secret",
+		Moderator:      moderator,
+		Views:          analytics.NewRecorder(store, viewDedupWindow, maxPendingViews),
+		Policy:         auth.DefaultPolicy(),
+		PasswordPolicy: auth.DefaultPasswordPolicy(),
+		Mailer:         &outbox{},
+		Events:         events.NewHub(streamReplaySize, streamBufferSize),
+		Notifier:       events.NewNotifier(wsNotificationSize),
+		PublicURL:      "https://chirpy.example",
+	}
+}
+
+// newTestUser creates a verified user with the given role, an empty role is a plain user
+
+func newTestUser(t *testing.T, cfg *apiConfig, email string, role auth.Role) database.User {
+	t.Helper()
+	dbUser, err := cfg.DB.CreateUser(email, "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbUser, err = cfg.DB.SetVerified(dbUser.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "" {
+		dbUser, err = cfg.DB.SetRole(dbUser.ID, string(role))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbUser
+}
+
+// bearer returns an Authorization header value with an access token for the user
+
+func bearer(t *testing.T, cfg *apiConfig, dbUser database.User) string {
+	t.Helper()
+	token, err := cfg.generateUserToken(dbUser.ID, userRole(dbUser), time.Now().Add(time.Hour), "chirpy-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+// serve sends a request with an optional Authorization header through handler
+
+func serve(handler http.Handler, method string, path string, authorization string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// outbox is a mailer that keeps every message it is asked to send
+
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// link returns the first link in the newest message sent to, failing the test when there is none
+
+func (o *outbox) link(t *testing.T, to string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To != to {
+			continue
+		}
+		for _, field := range strings.Fields(o.messages[i].Body) {
+			if strings.HasPrefix(field, "https://") {
+				return field
+			}
+		}
+	}
+	t.Fatalf("no link was mailed to %v", to)
+	return ""
+}
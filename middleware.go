@@ -1,6 +1,16 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
 
 func middlewareCors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -15,3 +25,89 @@ func middlewareCors(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// principal is the authenticated caller of a handler wrapped by requireRole
+
+type principal struct {
+	ID   int
+	Role auth.Role
+}
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+func principalFrom(r *http.Request) principal {
+	p, _ := r.Context().Value(principalKey).(principal)
+	return p
+}
+
+// userRole returns the role of a database user, treating unknown roles as a plain user
+
+func userRole(dbUser database.User) auth.Role {
+	role, ok := auth.ParseRole(dbUser.Role)
+	if !ok {
+		return auth.RoleUser
+	}
+	return role
+}
+
+/* requireRole only calls next for requests with a valid access token from a user whose stored role is at least role,
+the role claim is ignored so demotions apply at once; the caller is then available to next through principalFrom */
+
+func (cfg *apiConfig) requireRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		subject, err := cfg.validateToken(authorization, "chirpy-access")
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		claims, err := cfg.tokenClaims(authorization)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if claims.Impersonator != 0 {
+			respondWithError(w, http.StatusForbidden, errImpersonationRefused.Error())
+			return
+		}
+
+		dbUser, err := cfg.DB.GetSingleUser(subject)
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusUnauthorized, errAccountGone.Error())
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		granted := userRole(dbUser)
+		if !granted.AtLeast(role) {
+			respondWithError(w, http.StatusForbidden, "requires the "+string(role)+" role")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey, principal{ID: subject, Role: granted})
+		next(w, r.WithContext(ctx))
+	}
+}
+
+/* middlewareImpersonation marks every response to a request made with an impersonation token
+and logs the request, so what an admin did while acting as a user can be traced */
+
+func (cfg *apiConfig) middlewareImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if strings.HasPrefix(authorization, "Bearer ") {
+			claims, err := cfg.tokenClaims(authorization)
+			if err == nil && claims.Impersonator != 0 && claims.Issuer == "chirpy-access" {
+				w.Header().Set("X-Chirpy-Impersonated-By", strconv.Itoa(claims.Impersonator))
+				log.Printf("API: Admin %v as user %v: %v %v", claims.Impersonator, claims.Subject, r.Method, r.URL.Path)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
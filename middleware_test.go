@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+)
+
+func TestRequireRole(t *testing.T) {
+	cfg := newTestConfig(t)
+	user := newTestUser(t, cfg, "user@example.com", "")
+	moderator := newTestUser(t, cfg, "moderator@example.com", auth.RoleModerator)
+	admin := newTestUser(t, cfg, "admin@example.com", auth.RoleAdmin)
+	demoted := newTestUser(t, cfg, "demoted@example.com", auth.RoleAdmin)
+	deleted := newTestUser(t, cfg, "deleted@example.com", auth.RoleAdmin)
+
+	// tokens are issued while both still hold the admin role
+	demotedToken := bearer(t, cfg, demoted)
+	deletedToken := bearer(t, cfg, deleted)
+	_, err := cfg.DB.SetRole(demoted.ID, string(auth.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.DB.DeleteUser(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impersonation, err := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims{
+		Role:         string(auth.RoleModerator),
+		Impersonator: admin.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy-access",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:   strconv.Itoa(moderator.ID),
+		},
+	}).SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got principal
+	handler := cfg.requireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		got = principalFrom(r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+		wantRole      auth.Role
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "malformed token", authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "plain user", authorization: bearer(t, cfg, user), want: http.StatusForbidden},
+		{name: "moderator", authorization: bearer(t, cfg, moderator), want: http.StatusNoContent, wantRole: auth.RoleModerator},
+		{name: "admin outranks moderator", authorization: bearer(t, cfg, admin), want: http.StatusNoContent, wantRole: auth.RoleAdmin},
+		{name: "demoted since the token was issued", authorization: demotedToken, want: http.StatusForbidden},
+		{name: "deleted since the token was issued", authorization: deletedToken, want: http.StatusUnauthorized},
+		{name: "impersonation token", authorization: "Bearer " + impersonation, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = principal{}
+			rec := serve(handler, http.MethodGet, "/admin/moderation/queue", tt.authorization, "")
+			if rec.Code != tt.want {
+				t.Fatalf("status = %v, want %v", rec.Code, tt.want)
+			}
+			if got.Role != tt.wantRole {
+				t.Errorf("principal role = %q, want %q", got.Role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination reads the optional page and per_page query parameters, returning the slice bounds for a list of n items
+
+func parsePagination(r *http.Request, n int) (int, int, error) {
+	q := r.URL.Query()
+
+	page := 1
+	if p := q.Get("page"); p != "" {
+		parsed, err := strconv.Atoi(p)
+		if err != nil || parsed < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
+		page = parsed
+	}
+
+	perPage := defaultPageSize
+	if p := q.Get("per_page"); p != "" {
+		parsed, err := strconv.Atoi(p)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, 0, errors.New("per_page must be between 1 and 100")
+		}
+		perPage = parsed
+	}
+
+	start := (page - 1) * perPage
+	if start > n {
+		start = n
+	}
+	end := start + perPage
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+/* audience is who a response is being serialized for
+fields of API types tagged visible:"owner" are only written for the user they describe (or an admin)
+and fields tagged visible:"admin" only for admins, so handlers never pick fields by hand */
+
+type audience int
+
+const (
+	audiencePublic audience = iota
+	audienceOwner
+	audienceAdmin
+)
+
+func (a audience) allows(visible string) bool {
+	switch visible {
+	case "":
+		return true
+	case "owner":
+		return a >= audienceOwner
+	default:
+		return a == audienceAdmin
+	}
+}
+
+/* presenter converts database users for one requester, whose role is looked up once when it is made
+so listings don't reload the database for every user they return */
+
+type presenter struct {
+	requester int
+	admin     bool
+}
+
+// presenterFor resolves the role of a requester, who is 0 when the request is anonymous
+
+func (cfg *apiConfig) presenterFor(requester int) presenter {
+	return presenter{
+		requester: requester,
+		admin:     requester != 0 && cfg.hasRole(requester, auth.RoleAdmin),
+	}
+}
+
+// presenter uses the role requireRole already loaded for the caller
+
+func (p principal) presenter() presenter {
+	return presenter{
+		requester: p.ID,
+		admin:     p.Role.AtLeast(auth.RoleAdmin),
+	}
+}
+
+// audienceFor returns the audience the requester belongs to when reading the user with id owner
+
+func (p presenter) audienceFor(owner int) audience {
+	switch {
+	case p.admin:
+		return audienceAdmin
+	case p.requester != 0 && p.requester == owner:
+		return audienceOwner
+	default:
+		return audiencePublic
+	}
+}
+
+func (p presenter) present(dbUser database.User) User {
+	user := newUser(dbUser)
+	user.audience = p.audienceFor(dbUser.ID)
+	return user
+}
+
+// presentUser converts a single database user for a requester, lists should make one presenter instead
+
+func (cfg *apiConfig) presentUser(dbUser database.User, requester int) User {
+	return cfg.presenterFor(requester).present(dbUser)
+}
+
+/* marshalVisible writes the exported fields of the struct v as a JSON object,
+leaving out fields the audience may not see and honouring the name and omitempty json options */
+
+func marshalVisible(v interface{}, aud audience) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	written := 0
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() || !aud.allows(field.Tag.Get("visible")) {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value := rv.Field(i)
+		if strings.Contains(options, "omitempty") && value.IsZero() {
+			continue
+		}
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		dat, err := json.Marshal(value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(dat)
+		written++
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
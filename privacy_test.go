@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestMarshalVisible(t *testing.T) {
+	type sample struct {
+		Public   string `json:"public"`
+		Renamed  int    `json:"renamed_field"`
+		Untagged bool
+		Empty    string `json:"empty,omitempty"`
+		Skipped  string `json:"-"`
+		Owner    string `json:"owner_only" visible:"owner"`
+		Admin    string `json:"admin_only,omitempty" visible:"admin"`
+		hidden   string
+	}
+	v := sample{Public: "p", Renamed: 7, Untagged: true, Skipped: "s", Owner: "o", Admin: "a", hidden: "h"}
+
+	tests := []struct {
+		name string
+		aud  audience
+		want string
+	}{
+		{name: "public", aud: audiencePublic, want: `{"public":"p","renamed_field":7,"Untagged":true}`},
+		{name: "owner", aud: audienceOwner, want: `{"public":"p","renamed_field":7,"Untagged":true,"owner_only":"o"}`},
+		{name: "admin", aud: audienceAdmin, want: `{"public":"p","renamed_field":7,"Untagged":true,"owner_only":"o","admin_only":"a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dat, err := marshalVisible(v, tt.aud)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dat) != tt.want {
+				t.Errorf("marshalVisible() = %s, want %s", dat, tt.want)
+			}
+			dat, err = marshalVisible(&v, tt.aud)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dat) != tt.want {
+				t.Errorf("marshalVisible() of a pointer = %s, want %s", dat, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresentUser(t *testing.T) {
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := store.CreateUser("subject@example.com", "hash", true, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := store.CreateUser("stranger@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator, err := store.CreateUser("moderator@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SetRole(moderator.ID, "moderator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := store.CreateUser("admin@example.com", "hash", false, database.ActorKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SetRole(admin.ID, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err = store.SuspendUser(subject.ID, admin.ID, time.Now().Add(time.Hour), "spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{DB: store}
+
+	public := []string{"id"}
+	owner := append([]string{"email", "is_chirpy_red", "is_verified", "role"}, public...)
+	all := append([]string{"suspended_until", "suspension_reason"}, owner...)
+
+	tests := []struct {
+		name      string
+		requester int
+		want      []string
+	}{
+		{name: "anonymous", requester: 0, want: public},
+		{name: "another user", requester: stranger.ID, want: public},
+		{name: "moderator", requester: moderator.ID, want: public},
+		{name: "the user", requester: subject.ID, want: owner},
+		{name: "admin", requester: admin.ID, want: all},
+		{name: "deleted requester", requester: 999, want: public},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dat, err := json.Marshal(cfg.presentUser(subject, tt.requester))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := map[string]interface{}{}
+			err = json.Unmarshal(dat, &fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for key := range fields {
+				got = append(got, key)
+			}
+			want := append([]string{}, tt.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("fields = %v, want %v", got, want)
+			}
+		})
+	}
+
+	// users built without presentUser, such as those nested in other responses, only show public fields
+	dat, err := json.Marshal([]User{newUser(subject)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dat), subject.Email) {
+		t.Errorf("newUser() leaked the email: %s", dat)
+	}
+}
+
+func TestPresenter(t *testing.T) {
+	store, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{DB: store}
+	owner := database.User{ID: 1, Email: "owner@example.com"}
+	other := database.User{ID: 2, Email: "other@example.com"}
+
+	tests := []struct {
+		name      string
+		present   presenter
+		wantOwner audience
+		wantOther audience
+	}{
+		{name: "anonymous", present: cfg.presenterFor(0), wantOwner: audiencePublic, wantOther: audiencePublic},
+		{name: "unknown requester", present: cfg.presenterFor(1), wantOwner: audienceOwner, wantOther: audiencePublic},
+		{name: "user principal", present: principal{ID: 1, Role: auth.RoleUser}.presenter(), wantOwner: audienceOwner, wantOther: audiencePublic},
+		{name: "moderator principal", present: principal{ID: 3, Role: auth.RoleModerator}.presenter(), wantOwner: audiencePublic, wantOther: audiencePublic},
+		{name: "admin principal", present: principal{ID: 3, Role: auth.RoleAdmin}.presenter(), wantOwner: audienceAdmin, wantOther: audienceAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.present.present(owner).audience; got != tt.wantOwner {
+				t.Errorf("audience for the owner = %v, want %v", got, tt.wantOwner)
+			}
+			if got := tt.present.present(other).audience; got != tt.wantOther {
+				t.Errorf("audience for another user = %v, want %v", got, tt.wantOther)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const reapInterval = time.Minute
+
+// reapExpiredChirps periodically deletes chirps whose time to live has passed; read paths already hide them in between runs
+
+func (cfg *apiConfig) reapExpiredChirps(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := cfg.DB.DeleteExpiredChirps(time.Now())
+		if err != nil {
+			log.Printf("REAPER: Could not delete expired chirps: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("REAPER: Deleted %v expired chirps", n)
+		}
+	}
+}
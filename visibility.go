@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+// viewer describes who is reading chirps so every read path applies the same visibility rules
+
+type viewer struct {
+	ID        int
+	following map[int]struct{}
+	blocked   map[int]struct{}
+	muted     map[int]struct{}
+}
+
+// loadViewer resolves the optional access token on a read request; anonymous callers get a zero viewer
+
+func (cfg *apiConfig) loadViewer(r *http.Request) (viewer, error) {
+	return cfg.viewerFor(cfg.optionalSubject(r))
+}
+
+// viewerFor loads who the user follows and who is hidden from them, id 0 is an anonymous viewer
+
+func (cfg *apiConfig) viewerFor(id int) (viewer, error) {
+	v := viewer{
+		ID:        id,
+		following: map[int]struct{}{},
+		blocked:   map[int]struct{}{},
+		muted:     map[int]struct{}{},
+	}
+	if v.ID == 0 {
+		return v, nil
+	}
+	following, err := cfg.DB.GetFollowing(v.ID)
+	if err != nil {
+		return v, err
+	}
+	v.following = following
+	blocked, muted, err := cfg.DB.GetHiddenUsers(v.ID)
+	if err != nil {
+		return v, err
+	}
+	v.blocked = blocked
+	v.muted = muted
+	return v, nil
+}
+
+// canSee reports whether the viewer may read chirp
+
+func (v viewer) canSee(chirp database.Chirp) bool {
+	if chirp.Expired(time.Now()) {
+		return false
+	}
+	if v.ID != 0 && chirp.Author == v.ID {
+		return true
+	}
+	if chirp.Hidden {
+		return false
+	}
+	if _, ok := v.blocked[chirp.Author]; ok {
+		return false
+	}
+
+	switch chirp.Visibility {
+	case database.VisibilityFollowers:
+		_, ok := v.following[chirp.Author]
+		return ok
+	case database.VisibilityDirect:
+		for _, recipient := range chirp.Recipients {
+			if v.ID != 0 && recipient == v.ID {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// inTimeline reports whether chirp belongs in the viewer's timelines, which leave out muted users on top of canSee
+
+func (v viewer) inTimeline(chirp database.Chirp) bool {
+	if _, ok := v.muted[chirp.Author]; ok {
+		return false
+	}
+	return v.canSee(chirp)
+}
+
+// hides reports whether the viewer has blocked, been blocked by or muted user, so notifications from them are dropped
+
+func (v viewer) hides(user int) bool {
+	_, blocked := v.blocked[user]
+	_, muted := v.muted[user]
+	return blocked || muted
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/clinto-bean/golang-servers/internal/database"
+)
+
+func TestCanSee(t *testing.T) {
+	const author, follower, recipient, stranger = 1, 2, 3, 4
+	viewers := map[string]viewer{
+		"anonymous": {},
+		"author":    {ID: author},
+		"follower":  {ID: follower, following: map[int]struct{}{author: {}}},
+		"recipient": {ID: recipient},
+		"stranger":  {ID: stranger},
+	}
+
+	tests := []struct {
+		name  string
+		chirp database.Chirp
+		want  []string
+	}{
+		{
+			name:  "public",
+			chirp: database.Chirp{Author: author, Visibility: database.VisibilityPublic},
+			want:  []string{"anonymous", "author", "follower", "recipient", "stranger"},
+		},
+		{
+			name:  "stored before visibility existed",
+			chirp: database.Chirp{Author: author},
+			want:  []string{"anonymous", "author", "follower", "recipient", "stranger"},
+		},
+		{
+			name:  "followers only",
+			chirp: database.Chirp{Author: author, Visibility: database.VisibilityFollowers},
+			want:  []string{"author", "follower"},
+		},
+		{
+			name:  "direct",
+			chirp: database.Chirp{Author: author, Visibility: database.VisibilityDirect, Recipients: []int{recipient}},
+			want:  []string{"author", "recipient"},
+		},
+		{
+			name:  "direct with no recipients",
+			chirp: database.Chirp{Author: author, Visibility: database.VisibilityDirect},
+			want:  []string{"author"},
+		},
+		{
+			name:  "hidden by a moderator",
+			chirp: database.Chirp{Author: author, Visibility: database.VisibilityPublic, Hidden: true},
+			want:  []string{"author"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := map[string]bool{}
+			for _, name := range tt.want {
+				allowed[name] = true
+			}
+			for name, v := range viewers {
+				if got := v.canSee(tt.chirp); got != allowed[name] {
+					t.Errorf("canSee() for %v = %v, want %v", name, got, allowed[name])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateVisibility(t *testing.T) {
+	cfg := newTestConfig(t)
+	recipient := newTestUser(t, cfg, "recipient@example.com", "")
+
+	tests := []struct {
+		name       string
+		visibility string
+		recipients []int
+		wantErr    bool
+	}{
+		{name: "public", visibility: database.VisibilityPublic},
+		{name: "followers", visibility: database.VisibilityFollowers},
+		{name: "direct", visibility: database.VisibilityDirect, recipients: []int{recipient.ID}},
+		{name: "unknown visibility", visibility: "friends", wantErr: true},
+		{name: "direct without recipients", visibility: database.VisibilityDirect, wantErr: true},
+		{name: "direct to a missing user", visibility: database.VisibilityDirect, recipients: []int{recipient.ID, 404}, wantErr: true},
+		{name: "recipients on a public chirp", visibility: database.VisibilityPublic, recipients: []int{recipient.ID}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cfg.validateVisibility(tt.visibility, tt.recipients)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateVisibility() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChirpReadsApplyVisibility(t *testing.T) {
+	cfg := newTestConfig(t)
+	author := newTestUser(t, cfg, "author@example.com", "")
+	follower := newTestUser(t, cfg, "follower@example.com", "")
+	recipient := newTestUser(t, cfg, "recipient@example.com", "")
+	_, err := cfg.DB.CreateFollow(follower.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]int{}
+	for _, chirp := range []database.Chirp{
+		{Body: "public", Visibility: database.VisibilityPublic},
+		{Body: "followers", Visibility: database.VisibilityFollowers},
+		{Body: "direct", Visibility: database.VisibilityDirect, Recipients: []int{recipient.ID}},
+	} {
+		chirp.Author = author.ID
+		chirp, err := cfg.DB.CreateChirp(chirp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[chirp.Body] = chirp.ID
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps", cfg.handlerGetAllChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetSingleChirp)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          []string
+	}{
+		{name: "anonymous", want: []string{"public"}},
+		{name: "malformed token reads anonymously", authorization: "Bearer nope", want: []string{"public"}},
+		{name: "follower", authorization: bearer(t, cfg, follower), want: []string{"public", "followers"}},
+		{name: "recipient", authorization: bearer(t, cfg, recipient), want: []string{"public", "direct"}},
+		{name: "author", authorization: bearer(t, cfg, author), want: []string{"public", "followers", "direct"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := map[string]bool{}
+			for _, body := range tt.want {
+				allowed[body] = true
+			}
+
+			rec := serve(mux, http.MethodGet, "/api/chirps", tt.authorization, "")
+			listed := []Chirp{}
+			err := json.Unmarshal(rec.Body.Bytes(), &listed)
+			if err != nil {
+				t.Fatalf("GET /api/chirps = %v %s", rec.Code, rec.Body)
+			}
+			got := []string{}
+			for _, chirp := range listed {
+				got = append(got, chirp.Body)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("listed chirps = %v, want %v", got, tt.want)
+			}
+
+			for body, id := range ids {
+				want := http.StatusNotFound
+				if allowed[body] {
+					want = http.StatusOK
+				}
+				rec := serve(mux, http.MethodGet, fmt.Sprintf("/api/chirps/%d", id), tt.authorization, "")
+				if rec.Code != want {
+					t.Errorf("GET %v chirp = %v, want %v", body, rec.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockedAndMutedAuthors(t *testing.T) {
+	const blocked, muted, followed = 1, 2, 3
+	v := viewer{
+		ID:        4,
+		following: map[int]struct{}{blocked: {}, muted: {}, followed: {}},
+		blocked:   map[int]struct{}{blocked: {}},
+		muted:     map[int]struct{}{muted: {}},
+	}
+
+	tests := []struct {
+		name         string
+		author       int
+		wantSee      bool
+		wantTimeline bool
+	}{
+		{name: "blocked author", author: blocked},
+		{name: "muted author can still be looked up", author: muted, wantSee: true},
+		{name: "followed author", author: followed, wantSee: true, wantTimeline: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, visibility := range []string{database.VisibilityPublic, database.VisibilityFollowers} {
+				chirp := database.Chirp{Author: tt.author, Visibility: visibility}
+				if got := v.canSee(chirp); got != tt.wantSee {
+					t.Errorf("canSee() of a %v chirp = %v, want %v", visibility, got, tt.wantSee)
+				}
+				if got := v.inTimeline(chirp); got != tt.wantTimeline {
+					t.Errorf("inTimeline() of a %v chirp = %v, want %v", visibility, got, tt.wantTimeline)
+				}
+			}
+			if got := v.hides(tt.author); got == tt.wantTimeline {
+				t.Errorf("hides() = %v, want %v", got, !tt.wantTimeline)
+			}
+		})
+	}
+}
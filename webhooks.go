@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+
+	"github.com/clinto-bean/golang-servers/internal/auth"
 )
 
 type webhookParams struct {
@@ -17,8 +19,8 @@ func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request)
 	params := webhookParams{}
 	err := decoder.Decode(&params)
 
-	auth := r.Header.Get("Authorization")
-	reqApiKey := strings.TrimPrefix(auth, "ApiKey ")
+	authorization := r.Header.Get("Authorization")
+	reqApiKey := strings.TrimPrefix(authorization, "ApiKey ")
 
 	if reqApiKey != cfg.APIKey {
 		respondWithError(w, http.StatusUnauthorized, "API: API Key is invalid")
@@ -48,9 +50,19 @@ func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		_, err = cfg.Policy.Can(subjectFor(dbUser), auth.ActionUpgradeUser, auth.Resource{Owner: user})
+
+		if err != nil {
+			respondWithError(w, http.StatusForbidden, "API: user can't be upgraded: "+err.Error())
+			return
+		}
+
 		if !dbUser.Premium {
-			dbUser.Premium = true
-			cfg.DB.UpdateUser(user, dbUser.Email, dbUser.Password, dbUser.Premium)
+			_, err = cfg.DB.SetPremium(user, true)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "API: could not upgrade user")
+				return
+			}
 		}
 
 		respondWithJSON(w, http.StatusOK, nil)